@@ -0,0 +1,168 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarFile is an entry of a layer tar built by a test
+type tarFile struct {
+	Name string
+	Body string
+	Dir  bool
+}
+
+// layerTar builds an uncompressed layer tar
+func layerTar(t *testing.T, files ...tarFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.Name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(file.Body))}
+		if file.Dir {
+			hdr = &tar.Header{Name: file.Name, Mode: 0o755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(file.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gzipped compresses a layer as registries and OCI layouts store it
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// imageConfigJSON returns an image config with the diff IDs of the layers and
+// the given history, whose entries without a layer set EmptyLayer
+func imageConfigJSON(t *testing.T, layers [][]byte, history []History) []byte {
+	t.Helper()
+	var cfg imageConfig
+	cfg.Architecture, cfg.OS = "amd64", "linux"
+	for _, layer := range layers {
+		cfg.RootFS.DiffIDs = append(cfg.RootFS.DiffIDs, digestOf(layer))
+	}
+	for i := range history {
+		cfg.History = append(cfg.History, &history[i])
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// writeOCILayout writes an OCI layout holding one image with gzipped layers
+func writeOCILayout(t *testing.T, config []byte, layers [][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	manifest := writeManifestJSON(t, dir, storeImage(t, dir, config, layers))
+	manifest.Annotations = map[string]string{"org.opencontainers.image.ref.name": "app:1"}
+	writeIndex(t, dir, manifest)
+	return dir
+}
+
+// storeImage stores the config and the gzipped layers of an image in an OCI
+// layout, and returns the image manifest naming them
+func storeImage(t *testing.T, dir string, config []byte, layers [][]byte) ociManifest {
+	t.Helper()
+	manifest := ociManifest{
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Config:    descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: writeBlob(t, dir, config), Size: int64(len(config))},
+	}
+	for _, layer := range layers {
+		compressed := gzipped(t, layer)
+		manifest.Layers = append(manifest.Layers, descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: writeBlob(t, dir, compressed), Size: int64(len(compressed))})
+	}
+	return manifest
+}
+
+// writeManifestJSON stores an image manifest and returns its descriptor
+func writeManifestJSON(t *testing.T, dir string, manifest ociManifest) descriptor {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return descriptor{MediaType: manifest.MediaType, Digest: writeBlob(t, dir, data), Size: int64(len(data))}
+}
+
+// writeBlob stores a blob of an OCI layout under its digest
+func writeBlob(t *testing.T, dir string, data []byte) string {
+	t.Helper()
+	digest := digestOf(data)
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", digest[len("sha256:"):]), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return digest
+}
+
+// writeIndex writes the index.json and oci-layout files of an OCI layout
+func writeIndex(t *testing.T, dir string, manifests ...descriptor) {
+	t.Helper()
+	index, err := json.Marshal(ociIndex{MediaType: mediaTypeOCIIndex, Manifests: manifests})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"index.json": index, "oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`)} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeDockerSave writes a docker save archive holding one image, with its
+// layers under the legacy <n>/layer.tar names
+func writeDockerSave(t *testing.T, config []byte, layers [][]byte) string {
+	t.Helper()
+	manifest := []dockerManifest{{Config: "config.json", RepoTags: []string{"app:1"}}}
+	var files []tarFile
+	for i, layer := range layers {
+		name := fmt.Sprintf("%d/layer.tar", i)
+		manifest[0].Layers = append(manifest[0].Layers, name)
+		files = append(files, tarFile{Name: name, Body: string(layer)})
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, tarFile{Name: "config.json", Body: string(config)}, tarFile{Name: "manifest.json", Body: string(manifestJSON)})
+
+	archivePath := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(archivePath, layerTar(t, files...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// historyKeywords are the instructions a builder records in the image history
+var historyKeywords = map[string]bool{
+	"ADD": true, "ARG": true, "CMD": true, "COPY": true, "ENTRYPOINT": true,
+	"ENV": true, "EXPOSE": true, "HEALTHCHECK": true, "LABEL": true,
+	"MAINTAINER": true, "ONBUILD": true, "RUN": true, "SHELL": true,
+	"STOPSIGNAL": true, "USER": true, "VOLUME": true, "WORKDIR": true,
+}
+
+// HistoryCommand returns the Dockerfile keyword of a history entry, such as
+// RUN or COPY, or "" when it cannot be told. It understands the entries of
+// the classic builder ("/bin/sh -c #(nop) COPY ...", "/bin/sh -c apt-get ...")
+// and of BuildKit ("RUN /bin/sh -c ... # buildkit", "COPY . . # buildkit").
+func HistoryCommand(createdBy string) string {
+	text := strings.TrimSpace(createdBy)
+
+	// Classic RUN with build arguments: "|2 A=1 B=2 /bin/sh -c ..."
+	if strings.HasPrefix(text, "|") {
+		return "RUN"
+	}
+
+	if rest, ok := cutShellPrefix(text); ok {
+		rest = strings.TrimSpace(rest)
+		if nop, ok := strings.CutPrefix(rest, "#(nop)"); ok {
+			return keyword(nop)
+		}
+		return "RUN"
+	}
+
+	return keyword(text)
+}
+
+// cutShellPrefix strips the shell a classic builder prefixes to history entries
+func cutShellPrefix(text string) (string, bool) {
+	for _, prefix := range []string{"/bin/sh -c ", "/bin/bash -c ", "cmd /S /C "} {
+		if rest, ok := strings.CutPrefix(text, prefix); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// keyword returns the first word of text when it is an instruction keyword
+func keyword(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	word := strings.ToUpper(fields[0])
+	if !historyKeywords[word] {
+		return ""
+	}
+	return word
+}
+
+// Correlate maps the history entries of the image to the instructions of the
+// final stage of the Dockerfile it was built from. The two sequences are
+// aligned so that as many entries as possible match an instruction of the
+// same keyword, preferring entries whose recorded command is the
+// instruction's own text. Entries of the base image are left unmapped, as
+// are instructions the builder does not record, such as ARG with BuildKit.
+func (img *Image) Correlate(dockerfile *parser.Dockerfile) {
+	final := dockerfile.FinalStage()
+	if final == nil {
+		return
+	}
+
+	// Instructions of the final stage and the stages it is built from,
+	// in build order
+	var insts []*parser.Instruction
+	lineage := final.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		for j := range lineage[i].Instructions {
+			inst := instructionAt(dockerfile, lineage[i].Instructions[j].Line)
+			if inst != nil {
+				insts = append(insts, inst)
+			}
+		}
+	}
+
+	entries := img.History
+	for _, entry := range entries {
+		entry.Instruction = nil
+	}
+
+	// score[i][j] is the best alignment of entries[:i] with insts[:j]
+	score := make([][]int, len(entries)+1)
+	for i := range score {
+		score[i] = make([]int, len(insts)+1)
+	}
+	for i := 1; i <= len(entries); i++ {
+		for j := 1; j <= len(insts); j++ {
+			best := max(score[i-1][j], score[i][j-1])
+			if match := matchScore(entries[i-1], insts[j-1]); match > 0 {
+				best = max(best, score[i-1][j-1]+match)
+			}
+			score[i][j] = best
+		}
+	}
+
+	// Walk back from the end, taking a match whenever it is part of a best
+	// alignment, so that the newest entries pair with the last instructions
+	i, j := len(entries), len(insts)
+	for i > 0 && j > 0 {
+		match := matchScore(entries[i-1], insts[j-1])
+		switch {
+		case match > 0 && score[i][j] == score[i-1][j-1]+match:
+			entries[i-1].Instruction = insts[j-1]
+			i--
+			j--
+		case score[i][j] == score[i-1][j]:
+			i--
+		default:
+			j--
+		}
+	}
+}
+
+// matchScore rates how well a history entry matches an instruction: 0 when
+// the keywords differ, 1 when only they match and 2 when the recorded
+// command is also the instruction's text
+func matchScore(entry *History, inst *parser.Instruction) int {
+	if HistoryCommand(entry.CreatedBy) != inst.Command {
+		return 0
+	}
+	if normalize(historyText(entry.CreatedBy)) == normalize(instructionText(inst)) {
+		return 2
+	}
+	return 1
+}
+
+// historyText returns the arguments recorded in a history entry, without the
+// keyword, the shell prefix, build flags and the BuildKit marker
+func historyText(createdBy string) string {
+	text := strings.TrimSpace(createdBy)
+	text = strings.TrimSpace(strings.TrimSuffix(text, "# buildkit"))
+
+	// Classic RUN with build arguments: "|2 A=1 B=2 /bin/sh -c ..."
+	if strings.HasPrefix(text, "|") {
+		fields := strings.Fields(text)
+		count, err := strconv.Atoi(fields[0][1:])
+		if err == nil && count+1 < len(fields) {
+			text = strings.Join(fields[count+1:], " ")
+		}
+	}
+
+	if keyword(text) != "" {
+		text = strings.TrimSpace(text[len(strings.Fields(text)[0]):])
+	}
+	text = trimFlags(text)
+	if rest, ok := cutShellPrefix(text); ok {
+		text = strings.TrimSpace(rest)
+		if nop, ok := strings.CutPrefix(text, "#(nop)"); ok {
+			text = strings.TrimSpace(nop)
+			if keyword(text) != "" {
+				text = strings.TrimSpace(text[len(strings.Fields(text)[0]):])
+			}
+		}
+	}
+	return trimFlags(text)
+}
+
+// instructionText returns the arguments of an instruction as a builder
+// records them
+func instructionText(inst *parser.Instruction) string {
+	if inst.Command == "RUN" {
+		return inst.Script()
+	}
+	return strings.Join(inst.Args, " ")
+}
+
+// trimFlags removes leading --flag words
+func trimFlags(text string) string {
+	for strings.HasPrefix(text, "--") {
+		_, rest, _ := strings.Cut(text, " ")
+		text = strings.TrimSpace(rest)
+	}
+	return text
+}
+
+// normalize collapses runs of white space, so that line continuations and
+// indentation do not matter
+func normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// instructionAt returns the instruction of the Dockerfile starting at line, so
+// that mapped instructions point into Dockerfile.Instructions
+func instructionAt(dockerfile *parser.Dockerfile, line int) *parser.Instruction {
+	for i := range dockerfile.Instructions {
+		if dockerfile.Instructions[i].Line == line {
+			return &dockerfile.Instructions[i]
+		}
+	}
+	return nil
+}
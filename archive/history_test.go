@@ -0,0 +1,106 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+func TestHistoryCommand(t *testing.T) {
+	tests := []struct {
+		createdBy, want string
+	}{
+		{"/bin/sh -c #(nop) ADD file:abc in / ", "ADD"},
+		{`/bin/sh -c #(nop)  CMD ["/bin/sh"]`, "CMD"},
+		{"/bin/sh -c apk add --no-cache curl", "RUN"},
+		{"|2 A=1 B=2 /bin/sh -c make", "RUN"},
+		{"cmd /S /C #(nop) WORKDIR C:\\app", "WORKDIR"},
+		{"RUN /bin/sh -c apk add curl # buildkit", "RUN"},
+		{"COPY app /app # buildkit", "COPY"},
+		{"WORKDIR /app", "WORKDIR"},
+		{"bazel build //app", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := HistoryCommand(tt.createdBy); got != tt.want {
+			t.Errorf("HistoryCommand(%q) = %q, want %q", tt.createdBy, got, tt.want)
+		}
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	dockerfile, err := parser.Parse(strings.NewReader(`FROM alpine:3.19 AS base
+RUN apk add --no-cache curl
+
+FROM base
+ARG VERSION=1
+WORKDIR /app
+COPY go.mod go.sum ./
+RUN apk add \
+      git
+COPY . .
+RUN go build -o /bin/app .
+CMD ["/bin/app"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := []string{
+		"/bin/sh -c #(nop) ADD file:abc in / ",
+		`/bin/sh -c #(nop)  CMD ["/bin/sh"]`,
+	}
+	tests := []struct {
+		name      string
+		createdBy []string
+		want      []int // Line of each entry, 0 when unmapped
+	}{
+		{"classic", append(base,
+			"/bin/sh -c apk add --no-cache curl",
+			"/bin/sh -c #(nop)  ARG VERSION=1",
+			"/bin/sh -c #(nop) WORKDIR /app",
+			"/bin/sh -c #(nop) COPY multi:0123 in ./ ",
+			"|1 VERSION=1 /bin/sh -c apk add       git",
+			"/bin/sh -c #(nop) COPY dir:4567 in . ",
+			"|1 VERSION=1 /bin/sh -c go build -o /bin/app .",
+			`/bin/sh -c #(nop)  CMD ["/bin/app"]`,
+		), []int{0, 0, 2, 5, 6, 7, 8, 10, 11, 12}},
+		{"BuildKit", append(base,
+			"RUN /bin/sh -c apk add --no-cache curl # buildkit",
+			"WORKDIR /app",
+			"COPY go.mod go.sum ./ # buildkit",
+			"RUN |1 VERSION=1 /bin/sh -c apk add       git # buildkit",
+			"COPY . . # buildkit",
+			"RUN |1 VERSION=1 /bin/sh -c go build -o /bin/app . # buildkit",
+			`CMD ["/bin/app"]`,
+		), []int{0, 0, 2, 6, 7, 8, 10, 11, 12}},
+		{"built from an older Dockerfile", append(base,
+			"RUN /bin/sh -c apk add --no-cache curl # buildkit",
+			"COPY . . # buildkit",
+			"RUN /bin/sh -c go build ./cmd/app # buildkit",
+			"RUN /bin/sh -c go vet ./... # buildkit",
+		), []int{0, 0, 2, 10, 11, 0}},
+		{"recorded text", append(base,
+			"RUN /bin/sh -c apk add --no-cache curl # buildkit",
+			"RUN /bin/sh -c apk add git # buildkit",
+		), []int{0, 0, 2, 8}},
+	}
+	for _, tt := range tests {
+		img := &Image{}
+		for _, createdBy := range tt.createdBy {
+			img.History = append(img.History, &History{CreatedBy: createdBy})
+		}
+		img.Correlate(dockerfile)
+
+		for i, entry := range img.History {
+			line := 0
+			if entry.Instruction != nil {
+				line = entry.Instruction.Line
+			}
+			if line != tt.want[i] {
+				t.Errorf("%s: entry %q mapped to line %d, want %d", tt.name, entry.CreatedBy, line, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// Image is an image read from a docker save archive or an OCI layout
+type Image struct {
+	Source       string   // Path of the archive or layout directory
+	RepoTags     []string // Tags recorded in the archive, if any
+	Architecture string
+	OS           string
+	Layers       []*Layer   // Layers from the bottom of the image up
+	History      []*History // History entries oldest first, including those without a layer
+	Waste        *Waste     // Space taken by files that later layers delete or overwrite
+}
+
+// Layer is one filesystem layer of an image
+type Layer struct {
+	Index          int
+	Digest         string // Digest of the stored blob
+	DiffID         string // Digest of the uncompressed layer tar
+	Size           int64  // Bytes of file content the layer adds
+	CompressedSize int64  // Bytes of the blob as stored
+	WastedSize     int64  // Bytes the layer adds that later layers delete or overwrite
+	LargestFiles   []File // Largest regular files the layer adds, largest first
+	History        *History
+
+	open func() (io.ReadCloser, error)
+}
+
+// File is a regular file added by a layer
+type File struct {
+	Path string
+	Size int64
+}
+
+// largestFilesKept is the number of files kept in Layer.LargestFiles
+const largestFilesKept = 10
+
+// History is one entry of the image config history
+type History struct {
+	Created    string `json:"created,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	EmptyLayer bool   `json:"empty_layer,omitempty"`
+
+	Layer       *Layer              `json:"-"` // Layer the entry created, nil for empty entries
+	Instruction *parser.Instruction `json:"-"` // Dockerfile instruction the entry was built from, if known
+}
+
+// imageConfig is the part of the image config JSON that is read
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	RootFS       struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []*History `json:"history"`
+}
+
+// Open returns the uncompressed tar stream of the layer
+func (l *Layer) Open() (io.ReadCloser, error) {
+	if l.open == nil {
+		return nil, fmt.Errorf("layer %d has no content", l.Index)
+	}
+	return l.open()
+}
+
+// Walk calls fn for every entry of the layer tar, with the entry content
+// readable from the tar reader
+func (l *Layer) Walk(fn func(hdr *tar.Header, r *tar.Reader) error) error {
+	rc, err := l.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read layer %d: %v", l.Index, err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// CreatedBy returns the command recorded in the history for the layer
+func (l *Layer) CreatedBy() string {
+	if l.History == nil {
+		return ""
+	}
+	return l.History.CreatedBy
+}
+
+// Instruction returns the Dockerfile instruction that created the layer, or
+// nil when it is not known
+func (l *Layer) Instruction() *parser.Instruction {
+	if l.History == nil {
+		return nil
+	}
+	return l.History.Instruction
+}
+
+// TotalSize returns the bytes of file content of all layers
+func (img *Image) TotalSize() int64 {
+	var total int64
+	for _, layer := range img.Layers {
+		total += layer.Size
+	}
+	return total
+}
+
+// newImage builds an image from its config and layer openers, then reads
+// every layer once to measure it and find wasted space
+func newImage(source string, config []byte, layers []*Layer) (*Image, error) {
+	var cfg imageConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse image config: %v", err)
+	}
+
+	img := &Image{
+		Source:       source,
+		Architecture: cfg.Architecture,
+		OS:           cfg.OS,
+		Layers:       layers,
+		History:      cfg.History,
+	}
+
+	tracker := newWasteTracker()
+	for i, layer := range layers {
+		layer.Index = i
+		if i < len(cfg.RootFS.DiffIDs) {
+			layer.DiffID = cfg.RootFS.DiffIDs[i]
+		}
+		if layer.Digest == "" {
+			layer.Digest = layer.DiffID
+		}
+		if err := layer.scan(tracker); err != nil {
+			return nil, err
+		}
+	}
+	img.Waste = tracker.result(layers)
+
+	// History entries that are not empty created the layers in order
+	next := 0
+	for _, entry := range img.History {
+		if entry.EmptyLayer || next >= len(layers) {
+			continue
+		}
+		entry.Layer = layers[next]
+		layers[next].History = entry
+		next++
+	}
+
+	return img, nil
+}
+
+// scan sums the size of the regular files in the layer and records its
+// files and whiteouts with the waste tracker
+func (l *Layer) scan(tracker *wasteTracker) error {
+	l.Size = 0
+	l.LargestFiles = nil
+	return l.Walk(func(hdr *tar.Header, r *tar.Reader) error {
+		if tracker.add(l.Index, hdr) {
+			return nil
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			l.Size += hdr.Size
+			l.keepLargest(File{Path: "/" + cleanName(hdr.Name), Size: hdr.Size})
+		}
+		return nil
+	})
+}
+
+// keepLargest inserts a file into LargestFiles when it is among the largest
+func (l *Layer) keepLargest(file File) {
+	i := sort.Search(len(l.LargestFiles), func(i int) bool {
+		return l.LargestFiles[i].Size < file.Size
+	})
+	if i >= largestFilesKept {
+		return
+	}
+	l.LargestFiles = append(l.LargestFiles, File{})
+	copy(l.LargestFiles[i+1:], l.LargestFiles[i:])
+	l.LargestFiles[i] = file
+	if len(l.LargestFiles) > largestFilesKept {
+		l.LargestFiles = l.LargestFiles[:largestFilesKept]
+	}
+}
+
+// decompress wraps a layer blob in a decompressor chosen by its magic bytes
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		rc.Close()
+		return nil, err
+	}
+
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return readCloser{zr, rc}, nil
+	case len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		rc.Close()
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	default:
+		return readCloser{br, rc}, nil
+	}
+}
+
+// readCloser reads from a wrapping reader and closes the underlying file
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r readCloser) Close() error {
+	return r.closer.Close()
+}
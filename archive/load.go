@@ -0,0 +1,280 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// digestRegex matches the digest of a blob, such as sha256:<64 hex digits>
+var digestRegex = regexp.MustCompile(`^[a-z0-9]+:[a-f0-9]{32,}$`)
+
+// Media types of OCI and Docker image indexes
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	attestationReference = "vnd.docker.reference.type"
+)
+
+// dockerManifest is one entry of manifest.json in a docker save archive
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// descriptor points at a blob of an OCI layout
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociIndex is an OCI image index or Docker manifest list
+type ociIndex struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI or Docker v2 image manifest
+type ociManifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// LoadArchive reads an image from a docker save tarball without a daemon.
+// Archives holding several images yield the first one.
+func LoadArchive(archivePath string) (*Image, error) {
+	s, err := newTarStore(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.exists("manifest.json") {
+		return loadDockerSave(s, archivePath)
+	}
+	if s.exists("index.json") {
+		return loadOCI(s, archivePath)
+	}
+	return nil, fmt.Errorf("%s is not an image archive: no manifest.json or index.json", archivePath)
+}
+
+// LoadOCILayout reads an image from an OCI image layout directory
+func LoadOCILayout(dir string) (*Image, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	s := dirStore(dir)
+	if !s.exists("oci-layout") || !s.exists("index.json") {
+		return nil, fmt.Errorf("%s is not an OCI layout: missing oci-layout or index.json", dir)
+	}
+	return loadOCI(s, dir)
+}
+
+// loadDockerSave reads the manifest.json written by docker save
+func loadDockerSave(s store, source string) (*Image, error) {
+	data, err := readAll(s, "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	var manifests []dockerManifest
+	if err := json.Unmarshal(data, &manifests); err != nil {
+		return nil, fmt.Errorf("could not parse manifest.json: %v", err)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("%s holds no images", source)
+	}
+	manifest := manifests[0]
+
+	config, err := readAll(s, manifest.Config)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image config: %v", err)
+	}
+
+	var layers []*Layer
+	for _, name := range manifest.Layers {
+		layer, err := storeLayer(s, name, blobDigest(name))
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	img, err := newImage(source, config, layers)
+	if err != nil {
+		return nil, err
+	}
+	img.RepoTags = manifest.RepoTags
+	return img, nil
+}
+
+// loadOCI reads index.json and follows it to the image manifest for the
+// current platform
+func loadOCI(s store, source string) (*Image, error) {
+	data, err := readAll(s, "index.json")
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("could not parse index.json: %v", err)
+	}
+
+	// Nested indexes are followed until an image manifest is found
+	desc, err := selectManifest(index.Manifests)
+	annotations := desc.Annotations
+	for depth := 0; err == nil && isIndex(desc.MediaType); depth++ {
+		if depth > 4 {
+			return nil, fmt.Errorf("image index nested too deeply in %s", source)
+		}
+		data, err = readBlob(s, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var nested ociIndex
+		if err := json.Unmarshal(data, &nested); err != nil {
+			return nil, fmt.Errorf("could not parse image index %s: %v", desc.Digest, err)
+		}
+		desc, err = selectManifest(nested.Manifests)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+
+	data, err = readBlob(s, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("could not parse image manifest %s: %v", desc.Digest, err)
+	}
+	if isIndex(manifest.MediaType) {
+		return nil, fmt.Errorf("%s: manifest %s is an index", source, desc.Digest)
+	}
+
+	config, err := readBlob(s, manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("could not read image config: %v", err)
+	}
+
+	var layers []*Layer
+	for _, layerDesc := range manifest.Layers {
+		name, err := blobPath(layerDesc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layer, err := storeLayer(s, name, layerDesc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	img, err := newImage(source, config, layers)
+	if err != nil {
+		return nil, err
+	}
+	if name := annotations["io.containerd.image.name"]; name != "" {
+		img.RepoTags = []string{name}
+	} else if ref := annotations["org.opencontainers.image.ref.name"]; ref != "" {
+		img.RepoTags = []string{ref}
+	}
+	return img, nil
+}
+
+// selectManifest picks the manifest for the current platform, falling back
+// to the first image manifest. Attestation manifests are never picked.
+func selectManifest(manifests []descriptor) (descriptor, error) {
+	var candidates []descriptor
+	for _, desc := range manifests {
+		if desc.Annotations[attestationReference] != "" {
+			continue
+		}
+		if desc.Platform != nil && desc.Platform.OS == "unknown" {
+			continue
+		}
+		candidates = append(candidates, desc)
+	}
+	if len(candidates) == 0 {
+		return descriptor{}, fmt.Errorf("no image manifest found")
+	}
+
+	for _, desc := range candidates {
+		if desc.Platform != nil && desc.Platform.OS == "linux" && desc.Platform.Architecture == runtime.GOARCH {
+			return desc, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// storeLayer returns a layer whose content is read from the store on demand
+func storeLayer(s store, name, digest string) (*Layer, error) {
+	size, err := s.size(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find layer %s: %v", name, err)
+	}
+	return &Layer{
+		Digest:         digest,
+		CompressedSize: size,
+		open: func() (io.ReadCloser, error) {
+			rc, err := s.open(name)
+			if err != nil {
+				return nil, err
+			}
+			return decompress(rc)
+		},
+	}, nil
+}
+
+// isIndex reports whether a media type is an image index or manifest list
+func isIndex(mediaType string) bool {
+	return mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList
+}
+
+// blobPath returns the path of a blob inside an OCI layout. Digests are
+// validated first, so that a crafted index cannot name files outside blobs/.
+func blobPath(digest string) (string, error) {
+	if !digestRegex.MatchString(digest) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	algorithm, hex, _ := strings.Cut(digest, ":")
+	return "blobs/" + algorithm + "/" + hex, nil
+}
+
+// readBlob reads a whole blob of an OCI layout
+func readBlob(s store, digest string) ([]byte, error) {
+	name, err := blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(s, name)
+}
+
+// blobDigest returns the digest of a blob stored under blobs/, or "" for the
+// legacy <id>/layer.tar names of docker save
+func blobDigest(name string) string {
+	parts := strings.Split(cleanName(name), "/")
+	if len(parts) == 3 && parts[0] == "blobs" {
+		return parts[1] + ":" + parts[2]
+	}
+	return ""
+}
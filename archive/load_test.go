@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOCILayoutRejectsInvalidDigests(t *testing.T) {
+	layer := layerTar(t, tarFile{Name: "etc/app.conf", Body: "x"})
+	config := imageConfigJSON(t, [][]byte{layer}, nil)
+
+	// A file outside the layout that a crafted digest would reach
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "layout")
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	escape := "sha256:../../../secret"
+
+	tests := map[string]func(manifest *ociManifest, desc *descriptor){
+		"manifest": func(_ *ociManifest, desc *descriptor) { desc.Digest = escape },
+		"config":   func(manifest *ociManifest, _ *descriptor) { manifest.Config.Digest = escape },
+		"layer":    func(manifest *ociManifest, _ *descriptor) { manifest.Layers[0].Digest = escape },
+	}
+	for name, edit := range tests {
+		os.RemoveAll(layout)
+		manifest := storeImage(t, layout, config, [][]byte{layer})
+		var desc descriptor
+		edit(&manifest, &desc)
+		if desc.Digest == "" {
+			desc = writeManifestJSON(t, layout, manifest)
+		}
+		writeIndex(t, layout, desc)
+
+		if _, err := LoadOCILayout(layout); err == nil || !strings.Contains(err.Error(), `invalid digest "sha256:../../../secret"`) {
+			t.Errorf("%s digest escaping the layout: got %v, want an invalid digest error", name, err)
+		}
+	}
+}
+
+func TestBlobPath(t *testing.T) {
+	valid := "sha256:" + strings.Repeat("ab", 32)
+	if got, err := blobPath(valid); err != nil || got != "blobs/sha256/"+strings.Repeat("ab", 32) {
+		t.Errorf("blobPath(%q) = %q, %v", valid, got, err)
+	}
+	for _, digest := range []string{"", "sha256", "sha256:../../etc/passwd", "sha256:ABCDEF0123456789ABCDEF0123456789", "../sha256:" + strings.Repeat("a", 64), "sha256:abc"} {
+		if _, err := blobPath(digest); err == nil {
+			t.Errorf("blobPath(%q) succeeded, want an error", digest)
+		}
+	}
+}
+
+func TestDirStoreStaysInsideTheDirectory(t *testing.T) {
+	d := dirStore("/layout")
+	for _, name := range []string{"../etc/passwd", "blobs/../../etc/passwd", "/etc/passwd"} {
+		if got := d.path(name); !strings.HasPrefix(got, filepath.FromSlash("/layout/")) {
+			t.Errorf("path(%q) = %s, outside the layout", name, got)
+		}
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	base := layerTar(t, tarFile{Name: "etc/", Dir: true}, tarFile{Name: "etc/os-release", Body: "alpine"})
+	app := layerTar(t, tarFile{Name: "app/", Dir: true}, tarFile{Name: "app/server", Body: "0123456789"}, tarFile{Name: "app/config", Body: "abc"})
+	layers := [][]byte{base, app}
+	config := imageConfigJSON(t, layers, []History{
+		{CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "},
+		{CreatedBy: `/bin/sh -c #(nop)  CMD ["/bin/sh"]`, EmptyLayer: true},
+		{CreatedBy: "COPY app /app # buildkit"},
+	})
+
+	loaders := map[string]func() (*Image, error){
+		"docker save": func() (*Image, error) { return LoadArchive(writeDockerSave(t, config, layers)) },
+		"OCI layout":  func() (*Image, error) { return LoadOCILayout(writeOCILayout(t, config, layers)) },
+	}
+	for name, load := range loaders {
+		img, err := load()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if img.Architecture != "amd64" || img.OS != "linux" || len(img.RepoTags) != 1 || img.RepoTags[0] != "app:1" {
+			t.Errorf("%s: got %s/%s tagged %v, want linux/amd64 tagged app:1", name, img.OS, img.Architecture, img.RepoTags)
+		}
+		if len(img.Layers) != 2 {
+			t.Errorf("%s: got %d layers, want 2", name, len(img.Layers))
+			continue
+		}
+		for i, size := range []int64{6, 13} {
+			layer := img.Layers[i]
+			if layer.Index != i || layer.Size != size || layer.DiffID != digestOf(layers[i]) {
+				t.Errorf("%s: layer %d has index %d, size %d and diff ID %s, want size %d and diff ID %s", name, i, layer.Index, layer.Size, layer.DiffID, size, digestOf(layers[i]))
+			}
+		}
+		if files := img.Layers[1].LargestFiles; len(files) != 2 || files[0] != (File{Path: "/app/server", Size: 10}) {
+			t.Errorf("%s: got largest files %v, want /app/server first", name, files)
+		}
+		if img.Layers[1].CreatedBy() != "COPY app /app # buildkit" || img.History[1].Layer != nil {
+			t.Errorf("%s: layer 1 was created by %q, want the last history entry, skipping the empty one", name, img.Layers[1].CreatedBy())
+		}
+		if img.TotalSize() != 19 || img.Waste.WastedSize != 0 {
+			t.Errorf("%s: got %d bytes with %d wasted, want 19 with none wasted", name, img.TotalSize(), img.Waste.WastedSize)
+		}
+	}
+}
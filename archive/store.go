@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// store opens the files of an image archive or layout by their slash
+// separated path
+type store interface {
+	open(name string) (io.ReadCloser, error)
+	size(name string) (int64, error)
+	exists(name string) bool
+}
+
+// dirStore reads files from a directory, such as an OCI layout
+type dirStore string
+
+func (d dirStore) open(name string) (io.ReadCloser, error) {
+	return os.Open(d.path(name))
+}
+
+func (d dirStore) size(name string) (int64, error) {
+	info, err := os.Stat(d.path(name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (d dirStore) exists(name string) bool {
+	_, err := os.Stat(d.path(name))
+	return err == nil
+}
+
+// path returns the file of a name, which cannot leave the directory
+func (d dirStore) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(cleanName(name)))
+}
+
+// tarEntry locates the content of a file inside a tar archive
+type tarEntry struct {
+	offset int64
+	size   int64
+	link   string // Target of a symlink, relative to the archive root
+}
+
+// tarStore reads files from a tar archive without extracting it. The
+// archive is indexed once; each file is then read with a section reader.
+type tarStore struct {
+	path    string
+	entries map[string]tarEntry
+}
+
+// newTarStore indexes the entries of a tar archive
+func newTarStore(archivePath string) (*tarStore, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counter := &countingReader{r: f}
+	tr := tar.NewReader(counter)
+	s := &tarStore{path: archivePath, entries: map[string]tarEntry{}}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive %s: %v", archivePath, err)
+		}
+
+		name := cleanName(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			s.entries[name] = tarEntry{offset: counter.n, size: hdr.Size}
+		case tar.TypeSymlink:
+			// docker save links layers shared by several images
+			s.entries[name] = tarEntry{link: cleanName(path.Join(path.Dir(name), hdr.Linkname))}
+		}
+	}
+	return s, nil
+}
+
+func (s *tarStore) lookup(name string) (tarEntry, error) {
+	name = cleanName(name)
+	for i := 0; i < 10; i++ {
+		entry, ok := s.entries[name]
+		if !ok {
+			return tarEntry{}, fmt.Errorf("%s not found in %s", name, s.path)
+		}
+		if entry.link == "" {
+			return entry, nil
+		}
+		name = entry.link
+	}
+	return tarEntry{}, fmt.Errorf("too many links resolving %s in %s", name, s.path)
+}
+
+func (s *tarStore) open(name string) (io.ReadCloser, error) {
+	entry, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{io.NewSectionReader(f, entry.offset, entry.size), f}, nil
+}
+
+func (s *tarStore) size(name string) (int64, error) {
+	entry, err := s.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return entry.size, nil
+}
+
+func (s *tarStore) exists(name string) bool {
+	_, err := s.lookup(name)
+	return err == nil
+}
+
+// cleanName normalizes an archive path so that "./a/b" and "a/b" match
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// countingReader counts the bytes read, which gives the offset of each file
+// once the tar reader has consumed its header
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readAll reads a whole file from the store
+func readAll(s store, name string) ([]byte, error) {
+	rc, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"archive/tar"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Whiteout markers of the OCI layer format
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Waste is the space taken by files that a layer adds and a later layer
+// deletes or overwrites. Those bytes still ship with the image.
+type Waste struct {
+	TotalSize  int64        // Bytes of file content in all layers
+	WastedSize int64        // Bytes hidden by later layers
+	Files      []WastedFile // Wasted bytes per path, largest first
+}
+
+// WastedFile is a path whose content was hidden by a later layer, possibly
+// several times
+type WastedFile struct {
+	Path     string
+	Size     int64 // Bytes of the hidden copies
+	AddedBy  []int // Layers that added the hidden copies
+	HiddenBy []int // Layers that deleted or overwrote them
+}
+
+// Efficiency returns the share of the shipped bytes that end up visible in
+// the image, from 0 to 1
+func (w *Waste) Efficiency() float64 {
+	if w.TotalSize == 0 {
+		return 1
+	}
+	return float64(w.TotalSize-w.WastedSize) / float64(w.TotalSize)
+}
+
+// fileEntry is the copy of a path visible after the layers read so far
+type fileEntry struct {
+	size  int64
+	layer int
+}
+
+// wasteTracker replays the layers in order, keeping the visible copy of
+// every regular file and the bytes hidden by whiteouts and overwrites
+type wasteTracker struct {
+	files   map[string]fileEntry
+	wasted  map[string]*WastedFile
+	byLayer map[int]int64 // Wasted bytes by the layer that added them
+	total   int64
+}
+
+func newWasteTracker() *wasteTracker {
+	return &wasteTracker{
+		files:   map[string]fileEntry{},
+		wasted:  map[string]*WastedFile{},
+		byLayer: map[int]int64{},
+	}
+}
+
+// add records one tar entry of a layer. It reports whether the entry was a
+// whiteout marker rather than a file of the image.
+func (t *wasteTracker) add(layer int, hdr *tar.Header) bool {
+	name := cleanName(hdr.Name)
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+
+	switch {
+	case base == whiteoutOpaque:
+		// The directory hides everything lower layers put into it
+		t.hideTree(dir, layer, false)
+		return true
+	case strings.HasPrefix(base, whiteoutPrefix):
+		t.hideTree(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), layer, true)
+		return true
+	}
+
+	// Any entry, including a directory or link, replaces a lower file
+	t.hide(name, layer)
+	if hdr.Typeflag == tar.TypeReg {
+		t.files[name] = fileEntry{size: hdr.Size, layer: layer}
+		t.total += hdr.Size
+	}
+	return false
+}
+
+// hide records the lower copy of a path as wasted
+func (t *wasteTracker) hide(name string, layer int) {
+	entry, ok := t.files[name]
+	if !ok || entry.layer >= layer {
+		return
+	}
+	delete(t.files, name)
+
+	wasted := t.wasted[name]
+	if wasted == nil {
+		wasted = &WastedFile{Path: "/" + name}
+		t.wasted[name] = wasted
+	}
+	wasted.Size += entry.size
+	wasted.AddedBy = append(wasted.AddedBy, entry.layer)
+	wasted.HiddenBy = append(wasted.HiddenBy, layer)
+	t.byLayer[entry.layer] += entry.size
+}
+
+// hideTree hides the lower copies of everything below dir, and dir itself
+// when self is set
+func (t *wasteTracker) hideTree(dir string, layer int, self bool) {
+	if self {
+		t.hide(dir, layer)
+	}
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	for name := range t.files {
+		if strings.HasPrefix(name, prefix) {
+			t.hide(name, layer)
+		}
+	}
+}
+
+// result summarizes the waste and stores the wasted bytes of each layer
+func (t *wasteTracker) result(layers []*Layer) *Waste {
+	waste := &Waste{TotalSize: t.total}
+	for _, wasted := range t.wasted {
+		waste.WastedSize += wasted.Size
+		waste.Files = append(waste.Files, *wasted)
+	}
+	sort.Slice(waste.Files, func(i, j int) bool {
+		if waste.Files[i].Size != waste.Files[j].Size {
+			return waste.Files[i].Size > waste.Files[j].Size
+		}
+		return waste.Files[i].Path < waste.Files[j].Path
+	})
+
+	for _, layer := range layers {
+		layer.WastedSize = t.byLayer[layer.Index]
+	}
+	return waste
+}
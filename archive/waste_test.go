@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWaste(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers [][]tarFile
+		want   []WastedFile
+	}{
+		{"whiteout", [][]tarFile{
+			{{Name: "tmp/app.tgz", Body: "0123456789"}, {Name: "usr/bin/app", Body: "abc"}},
+			{{Name: "tmp/.wh.app.tgz"}},
+		}, []WastedFile{{Path: "/tmp/app.tgz", Size: 10, AddedBy: []int{0}, HiddenBy: []int{1}}}},
+		{"whiteout of a directory", [][]tarFile{
+			{{Name: "var/cache/apk/", Dir: true}, {Name: "var/cache/apk/a", Body: "1234"}, {Name: "var/cache/apk/b", Body: "12"}, {Name: "var/cache/apk.conf", Body: "1"}},
+			{{Name: "var/cache/.wh.apk"}},
+		}, []WastedFile{
+			{Path: "/var/cache/apk/a", Size: 4, AddedBy: []int{0}, HiddenBy: []int{1}},
+			{Path: "/var/cache/apk/b", Size: 2, AddedBy: []int{0}, HiddenBy: []int{1}},
+		}},
+		{"opaque directory", [][]tarFile{
+			{{Name: "app/", Dir: true}, {Name: "app/old.js", Body: "12345"}, {Name: "application.js", Body: "1"}},
+			{{Name: "app/", Dir: true}, {Name: "app/.wh..wh..opq"}, {Name: "app/new.js", Body: "123"}},
+		}, []WastedFile{{Path: "/app/old.js", Size: 5, AddedBy: []int{0}, HiddenBy: []int{1}}}},
+		{"overwrite", [][]tarFile{
+			{{Name: "app/bundle.js", Body: "12345678"}},
+			{{Name: "app/bundle.js", Body: "123456"}},
+			{{Name: "app/bundle.js", Body: "1234"}},
+		}, []WastedFile{{Path: "/app/bundle.js", Size: 14, AddedBy: []int{0, 1}, HiddenBy: []int{1, 2}}}},
+		{"file added in the same layer", [][]tarFile{
+			{{Name: "etc/app.conf", Body: "12"}, {Name: "etc/.wh.other"}},
+		}, nil},
+	}
+	for _, tt := range tests {
+		var layers [][]byte
+		for _, files := range tt.layers {
+			layers = append(layers, layerTar(t, files...))
+		}
+		img, err := LoadOCILayout(writeOCILayout(t, imageConfigJSON(t, layers, nil), layers))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(img.Waste.Files, tt.want) {
+			t.Errorf("%s: got wasted files %+v, want %+v", tt.name, img.Waste.Files, tt.want)
+		}
+		var wasted int64
+		for _, file := range tt.want {
+			wasted += file.Size
+		}
+		if img.Waste.WastedSize != wasted || img.Waste.TotalSize != img.TotalSize() {
+			t.Errorf("%s: got %d of %d bytes wasted, want %d of %d", tt.name, img.Waste.WastedSize, img.Waste.TotalSize, wasted, img.TotalSize())
+		}
+	}
+}
+
+func TestWastePerLayer(t *testing.T) {
+	layers := [][]byte{
+		layerTar(t, tarFile{Name: "a", Body: "1234"}, tarFile{Name: "b", Body: "123456"}),
+		layerTar(t, tarFile{Name: "b", Body: "12"}, tarFile{Name: ".wh.a"}),
+	}
+	img, err := LoadOCILayout(writeOCILayout(t, imageConfigJSON(t, layers, nil), layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Layers[0].WastedSize != 10 || img.Layers[1].WastedSize != 0 {
+		t.Errorf("got %d and %d bytes wasted per layer, want 10 and 0", img.Layers[0].WastedSize, img.Layers[1].WastedSize)
+	}
+	if got := img.Waste.Efficiency(); got != 2.0/12 {
+		t.Errorf("Efficiency() = %v, want %v", got, 2.0/12)
+	}
+	if got := (&Waste{}).Efficiency(); got != 1 {
+		t.Errorf("Efficiency() of an empty image = %v, want 1", got)
+	}
+}
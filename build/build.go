@@ -0,0 +1,72 @@
+package build
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/container"
+)
+
+// tagPrefix names the temporary images built for measuring
+const tagPrefix = "dock-slimcheck-tmp"
+
+// Options describes one image build
+type Options struct {
+	Runtime    container.Runtime // Runtime that builds and exports the image
+	Dockerfile string            // Path of the Dockerfile
+	ContextDir string            // Build context, the Dockerfile directory when empty
+	Target     string            // Stage to build, the final stage when empty
+	BuildArgs  map[string]string // Values for --build-arg
+}
+
+// Build builds an image with the runtime under a temporary tag, exports it
+// as a docker save archive and reads the archive. The temporary image and
+// archive are removed before returning: layers are measured while the
+// archive is read, but their content cannot be opened afterwards.
+func Build(opts Options) (*archive.Image, error) {
+	dir, err := os.MkdirTemp("", tagPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tag, err := temporaryTag()
+	if err != nil {
+		return nil, err
+	}
+
+	contextDir := opts.ContextDir
+	if contextDir == "" {
+		contextDir = filepath.Dir(opts.Dockerfile)
+	}
+	err = opts.Runtime.Build(container.BuildOptions{
+		Dockerfile: opts.Dockerfile,
+		ContextDir: contextDir,
+		Tag:        tag,
+		Target:     opts.Target,
+		BuildArgs:  opts.BuildArgs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer opts.Runtime.RemoveImage(tag)
+
+	archivePath := filepath.Join(dir, "image.tar")
+	if err := opts.Runtime.Save(tag, archivePath); err != nil {
+		return nil, err
+	}
+
+	return archive.LoadArchive(archivePath)
+}
+
+// temporaryTag returns a unique tag for an image built for measuring
+func temporaryTag() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tagPrefix + ":" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,131 @@
+package build
+
+import (
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// finalStage is the name the final stages of both Dockerfiles are compared
+// under, whatever they are called
+const finalStage = "final"
+
+// StageDelta compares the image size of one stage in the two Dockerfiles
+type StageDelta struct {
+	Stage    string // Stage name, or "final" for the final stages
+	Old, New int64  // Image sizes in bytes, -1 when the Dockerfile has no such stage
+}
+
+// Change returns the growth from the old to the new size, or 0 when either
+// is missing
+func (d StageDelta) Change() int64 {
+	if d.Old < 0 || d.New < 0 {
+		return 0
+	}
+	return d.New - d.Old
+}
+
+// LayerDelta compares the layers at the same position of the final images
+type LayerDelta struct {
+	Index    int
+	Old, New *archive.Layer // nil when that image has fewer layers
+}
+
+// Change returns the growth from the old to the new layer
+func (d LayerDelta) Change() int64 {
+	var change int64
+	if d.Old != nil {
+		change -= d.Old.Size
+	}
+	if d.New != nil {
+		change += d.New.Size
+	}
+	return change
+}
+
+// Comparison holds the size differences between two Dockerfiles
+type Comparison struct {
+	OldPath, NewPath   string
+	OldImage, NewImage *archive.Image // Final images of both Dockerfiles
+	Stages             []StageDelta   // Named stages in build order, then the final stages
+	Layers             []LayerDelta
+}
+
+// Compare builds the final stage and every named stage of two Dockerfiles
+// and compares the sizes
+func Compare(oldOpts, newOpts Options, oldFile, newFile *parser.Dockerfile) (*Comparison, error) {
+	c := &Comparison{OldPath: oldOpts.Dockerfile, NewPath: newOpts.Dockerfile}
+
+	for _, stage := range stageNames(oldFile, newFile) {
+		delta := StageDelta{Stage: stage, Old: -1, New: -1}
+		oldImage, err := buildStage(oldOpts, oldFile, stage)
+		if err != nil {
+			return nil, err
+		}
+		newImage, err := buildStage(newOpts, newFile, stage)
+		if err != nil {
+			return nil, err
+		}
+		if oldImage != nil {
+			delta.Old = oldImage.TotalSize()
+		}
+		if newImage != nil {
+			delta.New = newImage.TotalSize()
+		}
+		if stage == finalStage {
+			c.OldImage, c.NewImage = oldImage, newImage
+		}
+		c.Stages = append(c.Stages, delta)
+	}
+
+	for i := 0; i < len(c.OldImage.Layers) || i < len(c.NewImage.Layers); i++ {
+		delta := LayerDelta{Index: i}
+		if i < len(c.OldImage.Layers) {
+			delta.Old = c.OldImage.Layers[i]
+		}
+		if i < len(c.NewImage.Layers) {
+			delta.New = c.NewImage.Layers[i]
+		}
+		c.Layers = append(c.Layers, delta)
+	}
+
+	return c, nil
+}
+
+// buildStage builds one stage of a Dockerfile, or returns nil when the
+// Dockerfile has no stage of that name. Final images are correlated with the
+// Dockerfile so their layers name the instructions that created them.
+func buildStage(opts Options, dockerfile *parser.Dockerfile, stage string) (*archive.Image, error) {
+	if stage != finalStage {
+		if dockerfile.StageByName(stage) == nil {
+			return nil, nil
+		}
+		opts.Target = stage
+	}
+
+	img, err := Build(opts)
+	if err != nil {
+		return nil, err
+	}
+	if stage == finalStage {
+		img.Correlate(dockerfile)
+	}
+	return img, nil
+}
+
+// stageNames lists the named stages of both Dockerfiles, other than their
+// final stages, followed by "final"
+func stageNames(dockerfiles ...*parser.Dockerfile) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, dockerfile := range dockerfiles {
+		final := dockerfile.FinalStage()
+		for _, stage := range dockerfile.Stages {
+			if stage.Name == "" || stage.Name == finalStage || stage == final || seen[stage.Name] {
+				continue
+			}
+			seen[stage.Name] = true
+			names = append(names, stage.Name)
+		}
+	}
+	return append(names, finalStage)
+}
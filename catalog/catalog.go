@@ -0,0 +1,274 @@
+package catalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// SchemaVersion is the catalog format this package reads
+const SchemaVersion = 1
+
+// C libraries an image can be built on
+const (
+	LibcGlibc = "glibc"
+	LibcMusl  = "musl"
+	LibcNone  = "none" // Static binaries only, such as distroless/static
+)
+
+//go:embed images.json
+var embedded []byte
+
+var (
+	versionRegex = regexp.MustCompile(`^\d+(?:[._]\d+)*`)
+	alpineRegex  = regexp.MustCompile(`alpine\d+(?:\.\d+)*`)
+)
+
+var (
+	defaultOnce    sync.Once
+	defaultCatalog *Catalog
+)
+
+// Catalog describes official base images: the variants of each tag family
+// with their approximate size, distro and C library, and which smaller
+// variants to move to
+type Catalog struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Version       string   `json:"version"` // Date of the data, such as 2026.10
+	Images        []*Image `json:"images"`
+}
+
+// Image is one repository of the catalog
+type Image struct {
+	Repository     string         `json:"repository"`     // Docker Hub name, such as python
+	VersionAliases []string       `json:"versionAliases"` // Tags used like versions, such as lts or bookworm
+	DefaultVersion string         `json:"defaultVersion"` // Version suggested for untagged images, when variants need one
+	MuslNote       string         `json:"muslNote"`       // What breaks when moving from glibc to musl
+	Variants       []*Variant     `json:"variants"`
+	Alternatives   []*Alternative `json:"alternatives"` // Images from other repositories, such as distroless
+}
+
+// Variant is a tag family of an image, named by what follows the version:
+// "slim" for python:3.11-slim, "" for python:3.11
+type Variant struct {
+	Name    string   `json:"name"`
+	Distro  string   `json:"distro"`
+	Libc    string   `json:"libc"`
+	SizeMB  int64    `json:"sizeMB"`  // Approximate uncompressed linux/amd64 size
+	Smaller []string `json:"smaller"` // Recommended smaller variants, best first
+}
+
+// Alternative is a smaller image outside the repository. {major} in Image
+// is replaced by the major version of the tag, which must be one of Majors
+// when they are listed.
+type Alternative struct {
+	Image  string   `json:"image"`
+	Majors []string `json:"majors"`
+	Distro string   `json:"distro"`
+	Libc   string   `json:"libc"`
+	SizeMB int64    `json:"sizeMB"`
+	Note   string   `json:"note"`
+}
+
+// Match is a base image found in the catalog
+type Match struct {
+	Image   *Image
+	Variant *Variant
+	Name    string // Image name as written, without the tag
+	Version string // Version part of the tag, empty for latest or no tag
+}
+
+// Suggestion is a smaller image to use instead of a match
+type Suggestion struct {
+	Image  string // Reference to write in the FROM instruction
+	Distro string
+	Libc   string
+	SizeMB int64
+	Note   string // Caveats, including musl compatibility
+}
+
+// Default returns the catalog embedded in the binary
+func Default() *Catalog {
+	defaultOnce.Do(func() {
+		c, err := Parse(embedded)
+		if err != nil {
+			panic(fmt.Sprintf("embedded base image catalog: %v", err))
+		}
+		defaultCatalog = c
+	})
+	return defaultCatalog
+}
+
+// Parse reads and validates a catalog
+func Parse(data []byte) (*Catalog, error) {
+	c := &Catalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %v", err)
+	}
+	if c.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("unsupported catalog schema version %d, expected %d", c.SchemaVersion, SchemaVersion)
+	}
+
+	for _, image := range c.Images {
+		for _, variant := range image.Variants {
+			if err := checkLibc(variant.Libc); err != nil {
+				return nil, fmt.Errorf("%s variant %q: %v", image.Repository, variant.Name, err)
+			}
+			for _, name := range variant.Smaller {
+				if image.variant(name) == nil {
+					return nil, fmt.Errorf("%s variant %q: unknown smaller variant %q", image.Repository, variant.Name, name)
+				}
+			}
+		}
+		for _, alternative := range image.Alternatives {
+			if err := checkLibc(alternative.Libc); err != nil {
+				return nil, fmt.Errorf("%s alternative %s: %v", image.Repository, alternative.Image, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Lookup finds the variant an image reference such as python:3.11-slim
+// uses. Images outside Docker Hub's official repositories and unknown tag
+// families are not found.
+func (c *Catalog) Lookup(image string) (*Match, bool) {
+	ref, err := registry.ParseReference(image)
+	if err != nil || ref.Registry != registry.DockerHub {
+		return nil, false
+	}
+
+	for _, entry := range c.Images {
+		if ref.Repository != "library/"+entry.Repository {
+			continue
+		}
+		version, variantName := splitTag(ref.Tag, entry.VersionAliases)
+		variant := entry.variant(alpineRegex.ReplaceAllString(variantName, "alpine"))
+		if variant == nil {
+			return nil, false
+		}
+		name, _, _ := strings.Cut(image, "@")
+		if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+			name = name[:colon]
+		}
+		return &Match{Image: entry, Variant: variant, Name: name, Version: version}, true
+	}
+	return nil, false
+}
+
+// Suggestions returns the smaller images recommended for a match: variants
+// of the same version first, then images from other repositories
+func (m *Match) Suggestions() []Suggestion {
+	var suggestions []Suggestion
+	version := m.Version
+	if version == "" {
+		version = m.Image.DefaultVersion
+	}
+
+	for _, name := range m.Variant.Smaller {
+		variant := m.Image.variant(name)
+		tag := name
+		if version != "" {
+			tag = version + "-" + name
+		}
+		suggestions = append(suggestions, Suggestion{
+			Image:  m.Name + ":" + tag,
+			Distro: variant.Distro,
+			Libc:   variant.Libc,
+			SizeMB: variant.SizeMB,
+			Note:   m.muslNote(variant.Libc, ""),
+		})
+	}
+
+	if len(m.Variant.Smaller) == 0 {
+		return suggestions
+	}
+	major := versionRegex.FindString(m.Version)
+	if i := strings.IndexAny(major, "._"); i >= 0 {
+		major = major[:i]
+	}
+	for _, alternative := range m.Image.Alternatives {
+		image := alternative.Image
+		if strings.Contains(image, "{major}") {
+			if major == "" || len(alternative.Majors) > 0 && !contains(alternative.Majors, major) {
+				continue
+			}
+			image = strings.ReplaceAll(image, "{major}", major)
+		}
+		suggestions = append(suggestions, Suggestion{
+			Image:  image,
+			Distro: alternative.Distro,
+			Libc:   alternative.Libc,
+			SizeMB: alternative.SizeMB,
+			Note:   m.muslNote(alternative.Libc, alternative.Note),
+		})
+	}
+	return suggestions
+}
+
+// muslNote adds the musl compatibility warning to a note when a suggestion
+// moves a glibc image to musl
+func (m *Match) muslNote(libc, note string) string {
+	if libc != LibcMusl || m.Variant.Libc != LibcGlibc {
+		return note
+	}
+	warning := "uses musl instead of glibc, so binaries built for glibc may not run"
+	if m.Image.MuslNote != "" {
+		warning = "uses musl instead of glibc: " + m.Image.MuslNote
+	}
+	if note == "" {
+		return warning
+	}
+	return note + "; " + warning
+}
+
+// variant returns the variant with the given name, or nil
+func (image *Image) variant(name string) *Variant {
+	for _, variant := range image.Variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+	return nil
+}
+
+// splitTag splits a tag such as 3.11-slim into its version and variant.
+// latest and an empty tag have neither.
+func splitTag(tag string, aliases []string) (string, string) {
+	if tag == "" || tag == "latest" {
+		return "", ""
+	}
+	version := versionRegex.FindString(tag)
+	for _, alias := range aliases {
+		if tag == alias || strings.HasPrefix(tag, alias+"-") {
+			version = alias
+		}
+	}
+	if version == "" {
+		return "", tag
+	}
+	return version, strings.TrimPrefix(tag[len(version):], "-")
+}
+
+// checkLibc validates a libc name
+func checkLibc(libc string) error {
+	switch libc {
+	case LibcGlibc, LibcMusl, LibcNone:
+		return nil
+	}
+	return fmt.Errorf("unknown libc %q, expected glibc, musl or none", libc)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package catalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+//go:embed lifecycle.json
+var embeddedLifecycle []byte
+
+var (
+	defaultLifecycleOnce sync.Once
+	defaultLifecycle     *Lifecycle
+)
+
+// Lifecycle lists the release cycles of distros and language runtimes with
+// their end-of-life dates. Cycles use the field names of the endoflife.date
+// API, so its data can be pasted into a refresh file.
+type Lifecycle struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Version       string     `json:"version"` // Date of the data, such as 2026.10
+	Products      []*Product `json:"products"`
+}
+
+// Product is a distro or language runtime released in cycles
+type Product struct {
+	Name      string   `json:"name"`      // endoflife.date product name, such as nodejs
+	Title     string   `json:"title"`     // Display name, such as Node.js
+	Images    []string `json:"images"`    // Docker Hub repositories shipping it, such as node
+	TagPrefix string   `json:"tagPrefix"` // Written before the cycle in tags, such as alpine in alpine3.19
+	Distro    bool     `json:"distro"`    // Also named in the tags of other images, such as node:20-bookworm
+	Cycles    []*Cycle `json:"cycles"`    // Newest first
+}
+
+// Cycle is a release cycle such as Debian 12 or Node.js 20
+type Cycle struct {
+	Cycle           string `json:"cycle"`
+	Codename        string `json:"codename"`
+	EOL             Date   `json:"eol"`             // End of security support
+	ExtendedSupport Date   `json:"extendedSupport"` // End of LTS security support, when it goes on after EOL
+	LTS             Date   `json:"lts"`             // When the cycle became a long-term support release
+}
+
+// Date is a date of the endoflife.date API: "2026-04-30", or true or false
+// when only whether it has passed is known
+type Date struct {
+	Time   time.Time // Zero when not given as a date
+	Passed bool      // Given as true
+}
+
+// Support is a release cycle named by the tag of an image
+type Support struct {
+	Product *Product
+	Cycle   *Cycle
+	Token   int // Index of the tag part naming the cycle, parts being separated by "-"
+
+	form cycleForm
+}
+
+// cycleForm is how a tag names a cycle
+type cycleForm int
+
+const (
+	formVersion  cycleForm = iota // 3.11 or 3.11.4
+	formCodename                  // bookworm
+	formPrefix                    // alpine3.19
+)
+
+// UnmarshalJSON reads a date, true, false or null
+func (d *Date) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "null", "false":
+		*d = Date{}
+		return nil
+	case "true":
+		*d = Date{Passed: true}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid date %s", data)
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	*d = Date{Time: t}
+	return nil
+}
+
+// IsSet reports whether the date is known or known to have passed
+func (d Date) IsSet() bool {
+	return d.Passed || !d.Time.IsZero()
+}
+
+// Before reports whether the date is known to come before t
+func (d Date) Before(t time.Time) bool {
+	return d.Passed || !d.Time.IsZero() && d.Time.Before(t)
+}
+
+// String formats the date as YYYY-MM-DD, empty when it is not known
+func (d Date) String() string {
+	if d.Time.IsZero() {
+		return ""
+	}
+	return d.Time.Format("2006-01-02")
+}
+
+// DefaultLifecycle returns the lifecycle data embedded in the binary
+func DefaultLifecycle() *Lifecycle {
+	defaultLifecycleOnce.Do(func() {
+		l, err := ParseLifecycle(embeddedLifecycle)
+		if err != nil {
+			panic(fmt.Sprintf("embedded lifecycle data: %v", err))
+		}
+		defaultLifecycle = l
+	})
+	return defaultLifecycle
+}
+
+// ParseLifecycle reads and validates lifecycle data
+func ParseLifecycle(data []byte) (*Lifecycle, error) {
+	l := &Lifecycle{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("error parsing lifecycle data: %v", err)
+	}
+	if l.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("unsupported lifecycle schema version %d, expected %d", l.SchemaVersion, SchemaVersion)
+	}
+	for _, product := range l.Products {
+		if product.Name == "" {
+			return nil, fmt.Errorf("lifecycle product without a name")
+		}
+		if len(product.Images) == 0 && !product.Distro {
+			return nil, fmt.Errorf("lifecycle product %s lists no images", product.Name)
+		}
+		for _, cycle := range product.Cycles {
+			if cycle.Cycle == "" {
+				return nil, fmt.Errorf("lifecycle product %s has a cycle without a name", product.Name)
+			}
+		}
+	}
+	return l, nil
+}
+
+// LoadLifecycle reads a refresh file and applies it over the embedded data:
+// its products replace those of the same name and new ones are added
+func LoadLifecycle(path string) (*Lifecycle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lifecycle data: %v", err)
+	}
+	update, err := ParseLifecycle(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return DefaultLifecycle().Merge(update), nil
+}
+
+// Merge returns the data with the products of update replacing those of the
+// same name, and the version of update
+func (l *Lifecycle) Merge(update *Lifecycle) *Lifecycle {
+	merged := &Lifecycle{SchemaVersion: l.SchemaVersion, Version: update.Version}
+	replaced := map[string]bool{}
+	for _, product := range update.Products {
+		replaced[product.Name] = true
+	}
+	for _, product := range l.Products {
+		if !replaced[product.Name] {
+			merged.Products = append(merged.Products, product)
+		}
+	}
+	merged.Products = append(merged.Products, update.Products...)
+	if merged.Version == "" {
+		merged.Version = l.Version
+	}
+	return merged
+}
+
+// Lookup returns the release cycles the tag of an official Docker Hub image
+// names: the version of the image itself, such as 3.9 in python:3.9, and
+// distros named by its variant, such as buster in python:3.9-slim-buster
+func (l *Lifecycle) Lookup(image string) []Support {
+	ref, err := registry.ParseReference(image)
+	if err != nil || ref.Registry != registry.DockerHub || ref.Tag == "" {
+		return nil
+	}
+	repository, official := strings.CutPrefix(ref.Repository, "library/")
+	if !official {
+		return nil
+	}
+
+	var supports []Support
+	tokens := strings.Split(ref.Tag, "-")
+	for _, product := range l.Products {
+		own := contains(product.Images, repository)
+		if !own && !product.Distro {
+			continue
+		}
+		for i, token := range tokens {
+			if cycle, form := product.match(token, own && i == 0); cycle != nil {
+				supports = append(supports, Support{Product: product, Cycle: cycle, Token: i, form: form})
+				break
+			}
+			if own {
+				break
+			}
+		}
+	}
+	// The image's own version comes first, then the distros of its variant
+	sort.SliceStable(supports, func(i, j int) bool { return supports[i].Token < supports[j].Token })
+	return supports
+}
+
+// Supported returns the newest cycle still supported at t, preferring long
+// term support releases when the product has them, or nil
+func (p *Product) Supported(t time.Time) *Cycle {
+	var newest, newestLTS *Cycle
+	hasLTS := false
+	for _, cycle := range p.Cycles {
+		hasLTS = hasLTS || cycle.LTS.IsSet()
+		if cycle.EOL.Before(t) {
+			continue
+		}
+		if newest == nil {
+			newest = cycle
+		}
+		if newestLTS == nil && cycle.LTS.Before(t) {
+			newestLTS = cycle
+		}
+	}
+	if hasLTS && newestLTS != nil {
+		return newestLTS
+	}
+	return newest
+}
+
+// Name describes the cycle, such as "Debian 12 (Bookworm)"
+func (s Support) Name() string {
+	name := s.Product.Title + " " + s.Cycle.Cycle
+	if s.Cycle.Codename != "" {
+		name += " (" + s.Cycle.Codename + ")"
+	}
+	return name
+}
+
+// Upgrade rewrites an image so that each cycle of supports that ends before
+// t is replaced by the supported cycle of its product, written the same way:
+// node:14-buster becomes node:24-trixie. It returns "" when a product has no
+// supported cycle or nothing needs replacing.
+func Upgrade(image string, supports []Support, t time.Time) string {
+	name, _, _ := strings.Cut(image, "@")
+	colon := strings.LastIndex(name, ":")
+	if colon < 0 || colon < strings.LastIndex(name, "/") {
+		return ""
+	}
+	tokens := strings.Split(name[colon+1:], "-")
+
+	changed := false
+	for _, support := range supports {
+		if !support.Cycle.EOL.Before(t) {
+			continue
+		}
+		next := support.Product.Supported(t)
+		if next == nil || support.Token >= len(tokens) {
+			return ""
+		}
+		tokens[support.Token] = support.spell(next)
+		changed = true
+	}
+	if !changed {
+		return ""
+	}
+	return name[:colon+1] + strings.Join(tokens, "-")
+}
+
+// match finds the cycle a tag part names. Bare versions are only read from
+// the first part of the product's own images.
+func (p *Product) match(token string, versioned bool) (*Cycle, cycleForm) {
+	if versioned {
+		if version := versionRegex.FindString(token); version != "" {
+			if cycle := p.cycleOf(version); cycle != nil {
+				return cycle, formVersion
+			}
+		}
+	}
+	for _, cycle := range p.Cycles {
+		if cycle.Codename != "" && strings.EqualFold(token, codenameTag(cycle.Codename)) {
+			return cycle, formCodename
+		}
+	}
+	if rest, ok := strings.CutPrefix(token, p.TagPrefix); ok && p.TagPrefix != "" {
+		if version := versionRegex.FindString(rest); version != "" && version == rest {
+			return p.cycleOf(version), formPrefix
+		}
+	}
+	return nil, formVersion
+}
+
+// cycleOf returns the cycle a version belongs to: 3.11.4 is in cycle 3.11
+func (p *Product) cycleOf(version string) *Cycle {
+	var found *Cycle
+	for _, cycle := range p.Cycles {
+		if version == cycle.Cycle || strings.HasPrefix(version, cycle.Cycle+".") {
+			if found == nil || len(cycle.Cycle) > len(found.Cycle) {
+				found = cycle
+			}
+		}
+	}
+	return found
+}
+
+// spell writes a cycle the way the support's tag named its own
+func (s Support) spell(cycle *Cycle) string {
+	switch {
+	case s.form == formCodename && cycle.Codename != "":
+		return codenameTag(cycle.Codename)
+	case s.form == formPrefix:
+		return s.Product.TagPrefix + cycle.Cycle
+	}
+	return cycle.Cycle
+}
+
+// codenameTag returns the tag form of a codename: bookworm for "Bookworm",
+// jammy for "Jammy Jellyfish"
+func codenameTag(codename string) string {
+	word, _, _ := strings.Cut(codename, " ")
+	return strings.ToLower(word)
+}
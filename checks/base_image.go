@@ -2,66 +2,203 @@ package checks
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/avirooppal/dock-slimscheck/catalog"
 	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/utils"
 )
 
-// Common base images and their slim alternatives
-var baseImageAlternatives = map[string]string{
-	"node":   "node:alpine",
-	"python": "python:alpine",
-	"ruby":   "ruby:alpine",
-	"php":    "php:alpine",
-	"nginx":  "nginx:alpine",
+func init() {
+	Register(NewRule("DS001", "base-image", CategoryBaseImage, SeverityInfo,
+		"Reports the base image of the final stage", checkBaseImageInfo))
+	Register(NewRule("DS002", "large-base-image", CategoryBaseImage, SeverityMedium,
+		"Final stage is built on a large base image with a slimmer alternative", checkLargeBaseImage))
+	Register(NewRule("DS003", "latest-tag", CategoryBaseImage, SeverityHigh,
+		"Base image uses the ':latest' tag or no tag at all", checkLatestTag))
 }
 
 // CheckBaseImage performs checks on the base image
 func CheckBaseImage(dockerfile *parser.Dockerfile) []Issue {
+	return RunCategory(&Context{Dockerfile: dockerfile}, CategoryBaseImage)
+}
+
+// checkBaseImageInfo reports the base image being used by the shipped image
+func checkBaseImageInfo(ctx *Context) []Issue {
 	var issues []Issue
 
-	// Report the base image being used
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
+	dockerfile := ctx.Dockerfile
+	message := fmt.Sprintf("Base image: %s", dockerfile.BaseImage)
+	if match, ok := catalog.Default().Lookup(dockerfile.BaseImage); ok {
+		message += fmt.Sprintf(" (%s)", describeVariant(match.Variant))
+	}
 	issues = append(issues, Issue{
 		Type:    InfoIssue,
-		Message: fmt.Sprintf("Base image: %s", dockerfile.BaseImage),
-		Severity: "info",
+		Message: message,
+		Severity: SeverityInfo,
 		Impact:   "Base image choice affects the final image size and security posture",
 		References: []string{
 			"https://docs.docker.com/develop/develop-images/baseimages/",
 		},
+		Stage: final.String(),
+		Line:  final.Root().From.Line,
 	})
 
-	// Check for large base images
-	for baseImage, alternative := range baseImageAlternatives {
+	return issues
+}
+
+// checkLargeBaseImage checks for large base images; builder stages are not shipped.
+// Configured alternatives take precedence over the base image catalog.
+func checkLargeBaseImage(ctx *Context) []Issue {
+	var issues []Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
+	dockerfile := ctx.Dockerfile
+	alternatives := ctx.Settings.BaseImageAlternatives
+	for _, alternative := range alternatives {
+		if dockerfile.BaseImage == alternative {
+			return issues
+		}
+	}
+
+	// The image as written wins over a configured name, and names are tried
+	// in order so that the same alternative is suggested on every run
+	names := make([]string, 0, len(alternatives))
+	for baseImage := range alternatives {
+		names = append(names, baseImage)
+	}
+	sort.Strings(names)
+	if _, ok := alternatives[dockerfile.BaseImage]; ok {
+		names = []string{dockerfile.BaseImage}
+	}
+	for _, baseImage := range names {
+		alternative := alternatives[baseImage]
 		if strings.HasPrefix(dockerfile.BaseImage, baseImage+":") || dockerfile.BaseImage == baseImage {
 			issues = append(issues, Issue{
 				Type:    WarningIssue,
-				Message: fmt.Sprintf("Using large base image (%s) — consider a smaller alternative like alpine", baseImage),
+				Message: fmt.Sprintf("Using large base image (%s) — consider a smaller alternative like %s", baseImage, alternative),
 				Fix:     fmt.Sprintf("Replace '%s' with '%s' in your FROM instruction", dockerfile.BaseImage, alternative),
-				Severity: "medium",
+				Severity: SeverityMedium,
 				Impact:   "Larger base images increase the final image size and potential attack surface",
 				References: []string{
 					"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#use-multi-stage-builds",
-					"https://hub.docker.com/_/alpine",
 				},
+				Stage: final.Root().String(),
+				Line:  final.Root().From.Line,
 			})
-			break
+			return issues
+		}
+	}
+
+	match, ok := catalog.Default().Lookup(dockerfile.BaseImage)
+	if !ok {
+		return issues
+	}
+	suggestions := match.Suggestions()
+	if len(suggestions) == 0 {
+		return issues
+	}
+
+	best := suggestions[0]
+	fix := fmt.Sprintf("Replace '%s' with '%s' in your FROM instruction", dockerfile.BaseImage, best.Image)
+	if best.Note != "" {
+		fix += fmt.Sprintf("\n%s %s", best.Image, best.Note)
+	}
+	var details []string
+	for _, suggestion := range suggestions {
+		detail := fmt.Sprintf("%s: %s, %s, %s", suggestion.Image, approximateSize(suggestion.SizeMB), suggestion.Distro, suggestion.Libc)
+		if suggestion.Note != "" {
+			detail += " — " + suggestion.Note
 		}
+		details = append(details, detail)
 	}
+	details = append(details, fmt.Sprintf("Sizes are approximate, from base image catalog %s", catalog.Default().Version))
 
-	// Check for latest tag
-	if strings.HasSuffix(dockerfile.BaseImage, ":latest") || !strings.Contains(dockerfile.BaseImage, ":") {
+	issues = append(issues, Issue{
+		Type:    WarningIssue,
+		Message: fmt.Sprintf("Using large base image %s (%s) — %s is %s", dockerfile.BaseImage, describeVariant(match.Variant), best.Image, approximateSize(best.SizeMB)),
+		Fix:     fix,
+		Severity: SeverityMedium,
+		Impact:   "Larger base images increase the final image size and potential attack surface",
+		References: []string{
+			"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#use-multi-stage-builds",
+			"https://hub.docker.com/_/" + match.Image.Repository,
+		},
+		Details: details,
+		Stage:   final.Root().String(),
+		Line:    final.Root().From.Line,
+	})
+
+	return issues
+}
+
+// checkLatestTag checks for latest tag in every stage that starts from an external image
+func checkLatestTag(ctx *Context) []Issue {
+	var issues []Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		if stage.Parent != nil || !UsesFloatingTag(stage.BaseImage) {
+			continue
+		}
+
+		name, _ := splitImageTag(stage.BaseImage)
 		issues = append(issues, Issue{
 			Type:    WarningIssue,
 			Message: "Using ':latest' tag or no tag specified — this is non-reproducible",
-			Fix:     fmt.Sprintf("Specify a fixed version tag for your base image, e.g., '%s:1.2.3'", strings.Split(dockerfile.BaseImage, ":")[0]),
-			Severity: "high",
+			Fix:     fmt.Sprintf("Specify a fixed version tag for your base image, e.g., '%s:1.2.3'", name),
+			Severity: SeverityHigh,
 			Impact:   "Non-reproducible builds can lead to unexpected behavior and security issues",
 			References: []string{
 				"https://docs.docker.com/develop/dev-best-practices/#use-specific-tags",
 			},
+			Stage: stage.String(),
+			Line:  stage.From.Line,
 		})
 	}
 
 	return issues
-} 
\ No newline at end of file
+}
+
+// describeVariant summarizes a catalog variant, such as
+// "~1.0GB, Debian 12, glibc"
+func describeVariant(variant *catalog.Variant) string {
+	return fmt.Sprintf("%s, %s, %s", approximateSize(variant.SizeMB), variant.Distro, variant.Libc)
+}
+
+// approximateSize formats a catalog size, such as "~130.0MB"
+func approximateSize(sizeMB int64) string {
+	return "~" + utils.FormatSize(sizeMB*1000000)
+}
+
+// UsesFloatingTag reports whether an image reference relies on the implicit or
+// explicit ':latest' tag. Digest references and scratch are always fixed.
+func UsesFloatingTag(image string) bool {
+	if image == "" || image == "scratch" || strings.Contains(image, "@") {
+		return false
+	}
+	_, tag := splitImageTag(image)
+	return tag == "" || tag == "latest"
+}
+
+// splitImageTag splits an image reference into its name and tag, ignoring any
+// registry port and digest
+func splitImageTag(image string) (string, string) {
+	image, _, _ = strings.Cut(image, "@")
+
+	slash := strings.LastIndex(image, "/")
+	colon := strings.LastIndex(image, ":")
+	if colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
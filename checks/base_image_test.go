@@ -0,0 +1,46 @@
+package checks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+func TestCheckLargeBaseImageAlternatives(t *testing.T) {
+	alternatives := map[string]string{
+		"python":      "python:3.12-slim",
+		"python:3.12": "python:3.12-alpine",
+		"node":        "node:20-alpine",
+		"node:20":     "node:20-slim",
+	}
+	tests := []struct {
+		from, want string
+	}{
+		{"python:3.12", "python:3.12-alpine"},
+		{"python:3.11", "python:3.12-slim"},
+		{"node:20-bookworm", "node:20-alpine"},
+		{"python:3.12-slim", ""},
+		{"node:20-slim", ""},
+	}
+	for _, tt := range tests {
+		dockerfile, err := parser.Parse(strings.NewReader("FROM " + tt.from + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &Context{Dockerfile: dockerfile, Settings: Settings{BaseImageAlternatives: alternatives}}
+
+		// Map order changes between runs, so one run could pass by chance
+		for i := 0; i < 20; i++ {
+			issues := checkLargeBaseImage(ctx)
+			got := ""
+			if len(issues) > 0 {
+				got = issues[0].Message
+			}
+			if tt.want == "" && got != "" || tt.want != "" && !strings.HasSuffix(got, "like "+tt.want) {
+				t.Errorf("FROM %s: got %q, want the alternative %q", tt.from, got, tt.want)
+				break
+			}
+		}
+	}
+}
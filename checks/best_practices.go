@@ -3,170 +3,221 @@ package checks
 import (
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/avirooppal/dock-slimscheck/parser"
 )
 
+func init() {
+	Register(NewRule("DS004", "copy-all", CategoryBestPractice, SeverityMedium,
+		"COPY . . copies the whole build context instead of specific paths", checkCopyAll))
+	Register(NewRule("DS005", "missing-dockerignore", CategoryBestPractice, SeverityMedium,
+		"The whole build context is copied but no .dockerignore exists", checkDockerignore))
+	Register(NewRule("DS006", "add-instead-of-copy", CategoryBestPractice, SeverityLow,
+		"ADD is used where COPY would do", checkAddInsteadOfCopy))
+	Register(NewRule("DS007", "missing-healthcheck", CategoryBestPractice, SeverityMedium,
+		"The final stage has no HEALTHCHECK", checkHealthcheck))
+	Register(NewRule("DS008", "missing-user", CategoryBestPractice, SeverityHigh,
+		"The final stage does not set a USER and runs as root", checkUser))
+	Register(NewRule("DS009", "package-cleanup", CategoryBestPractice, SeverityMedium,
+		"Packages are installed without removing the package manager cache in the same layer", checkPackageCleanup))
+}
+
 // CheckBestPractices performs various best practice checks on the Dockerfile
 func CheckBestPractices(dockerfile *parser.Dockerfile, contextDir string) []Issue {
+	return RunCategory(&Context{Dockerfile: dockerfile, ContextDir: contextDir}, CategoryBestPractice)
+}
+
+// checkCopyAll checks for COPY . . which copies the whole build context
+func checkCopyAll(ctx *Context) []Issue {
+	var issues []Issue
+
+	wildcardCopy := ctx.Dockerfile.FindWildcardCopy()
+	if wildcardCopy == nil {
+		return issues
+	}
+
+	issues = append(issues, Issue{
+		Type:    WarningIssue,
+		Message: "COPY . . used — consider using specific paths",
+		Fix:     "Replace 'COPY . .' with specific paths, e.g., 'COPY package.json package-lock.json ./'",
+		Severity: SeverityMedium,
+		Impact:   "Large context size and potential inclusion of sensitive files",
+		References: []string{
+			"https://docs.docker.com/develop/dev-best-practices/#use-specific-paths",
+		},
+		Stage: ctx.Dockerfile.StageName(*wildcardCopy),
+		Line:  wildcardCopy.Line,
+	})
+
+	return issues
+}
+
+// checkDockerignore checks for .dockerignore when using COPY . .
+func checkDockerignore(ctx *Context) []Issue {
 	var issues []Issue
 
-	// Check for .dockerignore when using COPY . .
-	if dockerfile.HasWildcardCopy() {
+	wildcardCopy := ctx.Dockerfile.FindWildcardCopy()
+	if wildcardCopy == nil {
+		return issues
+	}
+
+	dockerignorePath := filepath.Join(ctx.ContextDir, ".dockerignore")
+	if _, err := os.Stat(dockerignorePath); os.IsNotExist(err) {
 		issues = append(issues, Issue{
 			Type:    WarningIssue,
-			Message: "COPY . . used — consider using specific paths",
-			Fix:     "Replace 'COPY . .' with specific paths, e.g., 'COPY package.json package-lock.json ./'",
-			Severity: "medium",
-			Impact:   "Large context size and potential inclusion of sensitive files",
+			Message: "No `.dockerignore` found",
+			Fix:     "Create a .dockerignore file with entries like:\nnode_modules\n.git\n*.md\n.env\n.DS_Store\ndist\nbuild\n*.log",
+			Severity: SeverityMedium,
+			Impact:   "Increased build context size and potential inclusion of sensitive files",
 			References: []string{
-				"https://docs.docker.com/develop/dev-best-practices/#use-specific-paths",
+				"https://docs.docker.com/develop/dev-best-practices/#use-dockerignore",
 			},
+			Stage: ctx.Dockerfile.StageName(*wildcardCopy),
+			Line:  wildcardCopy.Line,
 		})
-
-		// Check if .dockerignore exists
-		dockerignorePath := filepath.Join(contextDir, ".dockerignore")
-		if _, err := os.Stat(dockerignorePath); os.IsNotExist(err) {
-			issues = append(issues, Issue{
-				Type:    WarningIssue,
-				Message: "No `.dockerignore` found",
-				Fix:     "Create a .dockerignore file with entries like:\nnode_modules\n.git\n*.md\n.env\n.DS_Store\ndist\nbuild\n*.log",
-				Severity: "medium",
-				Impact:   "Increased build context size and potential inclusion of sensitive files",
-				References: []string{
-					"https://docs.docker.com/develop/dev-best-practices/#use-dockerignore",
-				},
-			})
-		}
 	}
 
-	// Check for ADD vs COPY
-	for _, instruction := range dockerfile.Instructions {
-		if instruction.Command == "ADD" {
+	return issues
+}
+
+// checkAddInsteadOfCopy checks for ADD vs COPY
+func checkAddInsteadOfCopy(ctx *Context) []Issue {
+	var issues []Issue
+
+	for _, instruction := range ctx.Dockerfile.Instructions {
+		if instruction.Command == "ADD" && !usesAddFeatures(instruction) {
 			issues = append(issues, Issue{
 				Type:    WarningIssue,
 				Message: "Using ADD instead of COPY — ADD adds unneeded complexity and risk",
 				Fix:     "Replace ADD with COPY for local files. Only use ADD when you need its special features (like auto-extraction of tar files)",
-				Severity: "low",
+				Severity: SeverityLow,
 				Impact:   "Potential security risks and unexpected behavior with ADD",
 				References: []string{
 					"https://docs.docker.com/develop/dev-best-practices/#use-copy-instead-of-add",
 				},
+				Stage: ctx.Dockerfile.StageName(instruction),
+				Line:  instruction.Line,
 			})
 			break
 		}
 	}
 
-	// Check if HEALTHCHECK is missing
-	if !dockerfile.HasHealthcheck() {
-		issues = append(issues, Issue{
-			Type:    WarningIssue,
-			Message: "No HEALTHCHECK found",
-			Fix:     "Add a HEALTHCHECK instruction, e.g.:\nHEALTHCHECK --interval=30s --timeout=3s --start-period=5s --retries=3 \\\n  CMD curl -f http://localhost/ || exit 1",
-			Severity: "medium",
-			Impact:   "Container health status cannot be monitored",
-			References: []string{
-				"https://docs.docker.com/engine/reference/builder/#healthcheck",
-			},
-		})
+	return issues
+}
+
+// usesAddFeatures reports whether an ADD instruction needs what COPY cannot
+// do: a git source or a download verified with --checksum
+func usesAddFeatures(instruction parser.Instruction) bool {
+	if instruction.HasFlag("checksum") || instruction.HasFlag("keep-git-dir") {
+		return true
 	}
+	for _, source := range instruction.Sources() {
+		if parser.IsGitSource(source) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Check if USER is missing
-	if !dockerfile.HasUser() {
-		issues = append(issues, Issue{
-			Type:    WarningIssue,
-			Message: "USER not specified — running as root",
-			Fix:     "Add a non-root user and switch to it:\nRUN useradd -m myuser\nUSER myuser",
-			Severity: "high",
-			Impact:   "Security risk: container running with root privileges",
-			References: []string{
-				"https://docs.docker.com/develop/dev-best-practices/#use-non-root-users",
-			},
-		})
+// checkHealthcheck checks if HEALTHCHECK is missing
+func checkHealthcheck(ctx *Context) []Issue {
+	var issues []Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil || ctx.Dockerfile.HasHealthcheck() {
+		return issues
 	}
 
-	// Check for cleanup after package installations
-	issues = append(issues, checkPackageCleanup(dockerfile)...)
+	issues = append(issues, Issue{
+		Type:    WarningIssue,
+		Message: "No HEALTHCHECK found",
+		Fix:     "Add a HEALTHCHECK instruction, e.g.:\nHEALTHCHECK --interval=30s --timeout=3s --start-period=5s --retries=3 \\\n  CMD curl -f http://localhost/ || exit 1",
+		Severity: SeverityMedium,
+		Impact:   "Container health status cannot be monitored",
+		References: []string{
+			"https://docs.docker.com/engine/reference/builder/#healthcheck",
+		},
+		Stage: final.String(),
+		Line:  final.From.Line,
+	})
 
-	// Check for latest tag in base image
-	if strings.HasSuffix(dockerfile.BaseImage, ":latest") || !strings.Contains(dockerfile.BaseImage, ":") {
-		issues = append(issues, Issue{
-			Type:    WarningIssue,
-			Message: "Using ':latest' tag or no tag specified — this is non-reproducible",
-			Fix:     "Specify a fixed version tag, e.g., 'node:18.17.0' instead of 'node:latest'",
-			Severity: "high",
-			Impact:   "Non-reproducible builds and potential compatibility issues",
-			References: []string{
-				"https://docs.docker.com/develop/dev-best-practices/#use-specific-tags",
-			},
-		})
+	return issues
+}
+
+// checkUser checks if USER is missing
+func checkUser(ctx *Context) []Issue {
+	var issues []Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil || ctx.Dockerfile.HasUser() {
+		return issues
 	}
 
+	issues = append(issues, Issue{
+		Type:    WarningIssue,
+		Message: "USER not specified — running as root",
+		Fix:     "Add a non-root user and switch to it:\nRUN useradd -m myuser\nUSER myuser",
+		Severity: SeverityHigh,
+		Impact:   "Security risk: container running with root privileges",
+		References: []string{
+			"https://docs.docker.com/develop/dev-best-practices/#use-non-root-users",
+		},
+		Stage: final.String(),
+		Line:  final.From.Line,
+	})
+
 	return issues
 }
 
-// checkPackageCleanup checks if apt/yum installations are properly cleaned up
-func checkPackageCleanup(dockerfile *parser.Dockerfile) []Issue {
+// checkPackageCleanup checks if apt/yum installations are properly cleaned up.
+// Only the final stage and the stages it is built from are inspected, since
+// package caches left in other builder stages never reach the shipped image.
+func checkPackageCleanup(ctx *Context) []Issue {
 	var issues []Issue
-	var hasAptGet, hasYum, hasApk bool
-	var hasCleanup bool
-
-	for _, instruction := range dockerfile.Instructions {
-		if instruction.Command == "RUN" {
-			// Check for package managers
-			if strings.Contains(instruction.Arguments, "apt-get install") || 
-			   strings.Contains(instruction.Arguments, "apt install") {
-				hasAptGet = true
-				
-				// Check if cleanup exists in the same instruction
-				if strings.Contains(instruction.Arguments, "apt-get clean") || 
-				   strings.Contains(instruction.Arguments, "rm -rf /var/lib/apt/lists/*") {
-					hasCleanup = true
-				}
-			}
-			
-			if strings.Contains(instruction.Arguments, "yum install") {
-				hasYum = true
-				
-				// Check if cleanup exists in the same instruction
-				if strings.Contains(instruction.Arguments, "yum clean all") {
-					hasCleanup = true
-				}
-			}
-			
-			if strings.Contains(instruction.Arguments, "apk add") {
-				hasApk = true
-				
-				// Check if cleanup exists in the same instruction
-				if strings.Contains(instruction.Arguments, "--no-cache") || 
-				   strings.Contains(instruction.Arguments, "rm -rf /var/cache/apk/*") {
-					hasCleanup = true
-				}
-			}
-		}
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
 	}
 
-	// If any package manager is used without cleanup
-	if (hasAptGet || hasYum || hasApk) && !hasCleanup {
-		var fix string
-		if hasAptGet {
-			fix = "Add cleanup after apt-get install:\nRUN apt-get update && \\\n    apt-get install -y curl wget && \\\n    apt-get clean && \\\n    rm -rf /var/lib/apt/lists/*"
-		} else if hasYum {
-			fix = "Add cleanup after yum install:\nRUN yum install -y package-name && \\\n    yum clean all && \\\n    rm -rf /var/cache/yum"
-		} else if hasApk {
-			fix = "Add --no-cache flag to apk add:\nRUN apk add --no-cache curl wget"
+	lineage := final.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		issues = append(issues, checkStagePackageCleanup(lineage[i])...)
+	}
+
+	return issues
+}
+
+// checkStagePackageCleanup checks the package installations of a single stage.
+// Each RUN that installs packages must remove the cache in the same layer.
+func checkStagePackageCleanup(stage *parser.Stage) []Issue {
+	var issues []Issue
+	var uncleaned *packageManager
+	var line int
+
+	for _, instruction := range stage.Instructions {
+		if instruction.Command != "RUN" {
+			continue
 		}
+		if pm := uncleanedPackageManager(instruction); pm != nil {
+			uncleaned, line = pm, instruction.Line
+			break
+		}
+	}
 
+	// If any package manager is used without cleanup
+	if uncleaned != nil {
 		issues = append(issues, Issue{
 			Type:    WarningIssue,
 			Message: "Package installation without cleanup — adds unnecessary size",
-			Fix:     fix,
-			Severity: "medium",
+			Fix:     uncleaned.fix,
+			Severity: SeverityMedium,
 			Impact:   "Increased image size due to package manager cache",
 			References: []string{
 				"https://docs.docker.com/develop/dev-best-practices/#minimize-the-number-of-layers",
 			},
+			Stage: stage.String(),
+			Line:  line,
 		})
 	}
 
@@ -0,0 +1,31 @@
+package checks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+func TestBestPracticesBeforeFirstFrom(t *testing.T) {
+	dockerfile, err := parser.Parse(strings.NewReader("ADD https://example.com/app.tgz /\nCOPY . .\nFROM alpine\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Context{Dockerfile: dockerfile, ContextDir: t.TempDir()}
+
+	for name, check := range map[string]func(*Context) []Issue{
+		"checkCopyAll":          checkCopyAll,
+		"checkDockerignore":     checkDockerignore,
+		"checkAddInsteadOfCopy": checkAddInsteadOfCopy,
+	} {
+		issues := check(ctx)
+		if len(issues) != 1 {
+			t.Errorf("%s returned %d issues, want 1", name, len(issues))
+			continue
+		}
+		if issues[0].Stage != "" {
+			t.Errorf("%s reported stage %q for an instruction before FROM, want none", name, issues[0].Stage)
+		}
+	}
+}
@@ -2,100 +2,195 @@ package checks
 
 import (
 	"fmt"
-	"os/exec"
-	"strconv"
 	"strings"
 
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/container"
 	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/utils"
 )
 
 // IsDockerAvailable checks if Docker is available in the system
 func IsDockerAvailable() bool {
-	cmd := exec.Command("docker", "--version")
-	return cmd.Run() == nil
+	return container.DockerEngine.Available() || container.Docker.Available()
 }
 
-// CheckLayerSizes analyzes the layer sizes of a Docker image
+// largestFilesShown limits the files listed in the details of a finding
+const largestFilesShown = 5
+
+func init() {
+	Register(NewRule("DS010", "large-layer", CategoryLayerSize, SeverityHigh,
+		"A layer of the analyzed image adds more than 100MB (configurable)", checkLargeLayers))
+	Register(NewRule("DS011", "layer-growth", CategoryLayerSize, SeverityMedium,
+		"A layer is much larger than the one before it", checkLayerGrowth))
+}
+
+// CheckLayerSizes analyzes the layer sizes of a Docker image, read from the
+// first container runtime found
 func CheckLayerSizes(dockerfile *parser.Dockerfile, contextDir string) []Issue {
-	var issues []Issue
+	return RunCategory(&Context{Dockerfile: dockerfile, ContextDir: contextDir, Runtime: container.Detect()}, CategoryLayerSize)
+}
+
+// Layers returns the layers the layer size rules inspect, bottom first: those
+// of ctx.Image, or else those of the base image from the runtime history, or
+// else those of ctx.BaseImage. It is nil when none is available. The result
+// is cached on the context.
+func (ctx *Context) Layers() []*archive.Layer {
+	if ctx.Image != nil {
+		return ctx.Image.Layers
+	}
+	if ctx.layersSet {
+		return ctx.layers
+	}
+	ctx.layersSet = true
 
 	// Check if there are any FROM instructions
-	fromInstructions := dockerfile.GetInstructionsByType("FROM")
-	if len(fromInstructions) == 0 {
-		return issues
+	if len(ctx.Dockerfile.GetInstructionsByType("FROM")) == 0 {
+		return nil
 	}
 
-	// Check for large layers
-	largeLayerIssues := checkForLargeLayers(dockerfile.BaseImage)
-	if len(largeLayerIssues) > 0 {
-		issues = append(issues, largeLayerIssues...)
+	if ctx.Runtime != nil {
+		ctx.layers = historyLayers(ctx.Runtime, ctx.Dockerfile.BaseImage)
+	}
+	if ctx.layers == nil && ctx.BaseImage != nil {
+		ctx.layers = ctx.BaseImage.Layers
 	}
+	return ctx.layers
+}
 
-	return issues
+// historyLayers reads the size of each layer from the image history
+func historyLayers(runtime container.Runtime, imageName string) []*archive.Layer {
+	history, err := runtime.History(imageName)
+	if err != nil {
+		// If we can't get the history, just return no layers
+		return nil
+	}
+
+	var layers []*archive.Layer
+	for _, entry := range history {
+		layers = append(layers, &archive.Layer{
+			Index:   len(layers),
+			Size:    entry.Size,
+			History: &archive.History{CreatedBy: entry.CreatedBy, Comment: entry.Comment},
+		})
+	}
+
+	return layers
 }
 
-// checkForLargeLayers uses docker history to find large layers
-func checkForLargeLayers(imageName string) []Issue {
+// checkLargeLayers finds layers larger than 100MB
+func checkLargeLayers(ctx *Context) []Issue {
 	var issues []Issue
-	
-	// Execute docker history command
-	cmd := exec.Command("docker", "history", "--human=false", "--format", "{{.Size}}", imageName)
-	output, err := cmd.Output()
-	if err != nil {
-		// If we can't get the history, just return no issues
-		return issues
+
+	limit := ctx.Settings.withDefaults().LargeLayerMB * 1000000
+
+	// Skip the first layer which is often the base image
+	for i, layer := range ctx.Layers() {
+		size := layer.Size
+		// If a layer is significantly larger than the limit (100MB by default)
+		if i > 0 && size > limit {
+			sizeMB := size / 1000000
+			issue := Issue{
+				Type:    WarningIssue,
+				Message: fmt.Sprintf("%s adds %dMB — consider using multistage builds", layerSubject(layer), sizeMB),
+				Fix:     suggestMultistagePattern(ctx.Dockerfile.BaseImage),
+				Severity: SeverityHigh,
+				Impact:   fmt.Sprintf("Large layer size (%dMB) increases image size and deployment time", sizeMB),
+				References: []string{
+					"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#use-multi-stage-builds",
+				},
+				Details: largestFiles(layer),
+			}
+			ctx.locateLayer(&issue, layer)
+			issues = append(issues, issue)
+		}
 	}
-	
-	// Parse the output to get layer sizes
-	layers := strings.Split(strings.TrimSpace(string(output)), "\n")
-	
-	// Convert sizes to integers and check for large layers
+
+	return issues
+}
+
+// checkLayerGrowth finds layers that grow by more than 30% over the previous one
+func checkLayerGrowth(ctx *Context) []Issue {
+	var issues []Issue
+
+	settings := ctx.Settings.withDefaults()
+	ratio := 1 + float64(settings.LayerGrowthPercent)/100
+	minGrowth := settings.LayerGrowthMB * 1000000
+
 	var prevSize int64
-	for i, layerSizeStr := range layers {
-		size, err := strconv.ParseInt(layerSizeStr, 10, 64)
-		if err != nil {
+	for i, layer := range ctx.Layers() {
+		size := layer.Size
+		if size < 0 {
 			continue
 		}
-		
-		// Skip the first layer which is often the base image
-		if i > 0 {
-			// If a layer is significantly larger than 100MB (100000000 bytes)
-			if size > 100000000 {
-				sizeMB := size / 1000000
-				issues = append(issues, Issue{
-					Type:    WarningIssue,
-					Message: fmt.Sprintf("Layer %d adds %dMB — consider using multistage builds", i, sizeMB),
-					Fix:     suggestMultistagePattern(imageName),
-					Severity: "high",
-					Impact:   fmt.Sprintf("Large layer size (%dMB) increases image size and deployment time", sizeMB),
-					References: []string{
-						"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#use-multi-stage-builds",
-					},
-				})
+
+		// If a layer grows significantly (more than 30% of previous layer by default)
+		if i > 0 && prevSize > 0 && size > int64(float64(prevSize)*ratio) && size-prevSize > minGrowth {
+			growthMB := (size - prevSize) / 1000000
+			fix := "Review the RUN instruction for this layer and ensure all temporary files are cleaned up"
+			if inst := layer.Instruction(); inst != nil {
+				fix = fmt.Sprintf("Review the %s instruction at line %d and ensure all temporary files are cleaned up", inst.Command, inst.Line)
 			}
-			
-			// If a layer grows significantly (more than 30% of previous layer)
-			if prevSize > 0 && size > int64(float64(prevSize)*1.3) && size-prevSize > 50000000 {
-				growthMB := (size - prevSize) / 1000000
-				issues = append(issues, Issue{
-					Type:    WarningIssue,
-					Message: fmt.Sprintf("Layer %d grows by %dMB — check for unneeded files", i, growthMB),
-					Fix:     "Review the RUN instruction for this layer and ensure all temporary files are cleaned up",
-					Severity: "medium",
-					Impact:   fmt.Sprintf("Layer growth of %dMB indicates potential file cleanup issues", growthMB),
-					References: []string{
-						"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#minimize-the-number-of-layers",
-					},
-				})
+			issue := Issue{
+				Type:    WarningIssue,
+				Message: fmt.Sprintf("%s grows by %dMB — check for unneeded files", layerSubject(layer), growthMB),
+				Fix:     fix,
+				Severity: SeverityMedium,
+				Impact:   fmt.Sprintf("Layer growth of %dMB indicates potential file cleanup issues", growthMB),
+				References: []string{
+					"https://docs.docker.com/develop/develop-images/dockerfile_best-practices/#minimize-the-number-of-layers",
+				},
+				Details: largestFiles(layer),
 			}
+			ctx.locateLayer(&issue, layer)
+			issues = append(issues, issue)
 		}
-		
+
 		prevSize = size
 	}
-	
+
 	return issues
 }
 
+// layerSubject names a layer in a finding by the instruction that created
+// it, such as "RUN at line 12 (layer 3)"
+func layerSubject(layer *archive.Layer) string {
+	if inst := layer.Instruction(); inst != nil {
+		return fmt.Sprintf("%s at line %d (layer %d)", inst.Command, inst.Line, layer.Index)
+	}
+	return fmt.Sprintf("Base image layer %d", layer.Index)
+}
+
+// locateLayer points an issue at the instruction that created a layer, or at
+// the FROM of the final stage for layers of the base image
+func (ctx *Context) locateLayer(issue *Issue, layer *archive.Layer) {
+	inst := layer.Instruction()
+	if inst == nil {
+		final := ctx.Dockerfile.FinalStage()
+		if final == nil {
+			return
+		}
+		inst = &final.Root().From
+	}
+
+	issue.Line = inst.Line
+	if stage := ctx.Dockerfile.StageOf(*inst); stage != nil {
+		issue.Stage = stage.String()
+	}
+}
+
+// largestFiles lists the largest files a layer adds, when its content was read
+func largestFiles(layer *archive.Layer) []string {
+	var details []string
+	for i, file := range layer.LargestFiles {
+		if i == largestFilesShown {
+			break
+		}
+		details = append(details, fmt.Sprintf("%s (%s)", file.Path, utils.FormatSize(file.Size)))
+	}
+	return details
+}
+
 // suggestMultistagePattern returns advice for using multistage builds
 func suggestMultistagePattern(imageName string) string {
 	// Extract base image language
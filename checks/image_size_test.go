@@ -0,0 +1,85 @@
+package checks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/container/containertest"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// historyContext returns a context whose base image, alpine:3.19, has layers
+// of the given sizes in the history of a fake runtime
+func historyContext(t *testing.T, sizes ...int64) *Context {
+	dockerfile, err := parser.Parse(strings.NewReader("FROM alpine:3.19\nRUN apk add curl\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []container.HistoryEntry
+	for i, size := range sizes {
+		history = append(history, container.HistoryEntry{ID: "<missing>", CreatedBy: "/bin/sh -c step " + string(rune('a'+i)), Size: size})
+	}
+	runtime := containertest.New(map[string]*containertest.Image{"alpine:3.19": {History: history}})
+	return &Context{Dockerfile: dockerfile, Runtime: runtime}
+}
+
+func TestHistoryLayers(t *testing.T) {
+	ctx := historyContext(t, 7000000, -1, 300)
+
+	layers := historyLayers(ctx.Runtime, "alpine:3.19")
+	if len(layers) != 3 {
+		t.Fatalf("got %d layers, want 3", len(layers))
+	}
+	for i, want := range []int64{7000000, -1, 300} {
+		if layers[i].Index != i || layers[i].Size != want {
+			t.Errorf("layer %d has index %d and size %d, want size %d", i, layers[i].Index, layers[i].Size, want)
+		}
+	}
+	if layers[2].History.CreatedBy != "/bin/sh -c step c" {
+		t.Errorf("layer 2 was created by %q, want the third history entry", layers[2].History.CreatedBy)
+	}
+
+	if layers := historyLayers(ctx.Runtime, "missing:1"); layers != nil {
+		t.Errorf("got %d layers for an image the runtime does not hold, want none", len(layers))
+	}
+}
+
+func TestCheckLargeLayers(t *testing.T) {
+	// The first layer is not reported, however large
+	ctx := historyContext(t, 150000000, 120000000, 1000000)
+
+	issues := checkLargeLayers(ctx)
+	if len(issues) != 1 {
+		t.Fatalf("got %d issues, want 1", len(issues))
+	}
+	if !strings.HasPrefix(issues[0].Message, "Base image layer 1 adds 120MB") {
+		t.Errorf("got message %q, want layer 1 adding 120MB", issues[0].Message)
+	}
+	if issues[0].Line != 1 {
+		t.Errorf("got line %d, want the FROM at line 1", issues[0].Line)
+	}
+
+	ctx = historyContext(t, 150000000, 120000000, 1000000)
+	ctx.Settings.LargeLayerMB = 200
+	if issues := checkLargeLayers(ctx); len(issues) != 0 {
+		t.Errorf("got %d issues with a 200MB limit, want none", len(issues))
+	}
+}
+
+func TestCheckLayerGrowth(t *testing.T) {
+	// Layer 2 grows by less than 50MB and layer 3 has an unknown size, so
+	// layer 4 is compared with layer 2
+	ctx := historyContext(t, 5000000, 80000000, 90000000, -1, 200000000)
+
+	issues := checkLayerGrowth(ctx)
+	want := []string{"Base image layer 1 grows by 75MB", "Base image layer 4 grows by 110MB"}
+	if len(issues) != len(want) {
+		t.Fatalf("got %d issues, want %d", len(issues), len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(issues[i].Message, want[i]) {
+			t.Errorf("issue %d: got message %q, want %q", i, issues[i].Message, want[i])
+		}
+	}
+}
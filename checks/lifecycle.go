@@ -0,0 +1,179 @@
+package checks
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/avirooppal/dock-slimscheck/catalog"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// now returns the date end-of-life dates are compared with
+var now = time.Now
+
+// variableRefRegex matches a whole $NAME or ${NAME...} reference in a FROM
+var variableRefRegex = regexp.MustCompile(`\$(?:\{[^}]*\}|[A-Za-z_][A-Za-z0-9_]*)`)
+
+func init() {
+	Register(NewRule("DS013", "end-of-life-base-image", CategoryBaseImage, SeverityHigh,
+		"Base image runs a distro or language runtime version that is past or near its end of life", checkEndOfLife))
+}
+
+// checkEndOfLife reports every stage whose external base image names a
+// release cycle that lost support, or loses it within EOLWarningDays.
+// Cycles that only get extended (LTS) security fixes are reported as medium,
+// cycles about to end as low.
+func checkEndOfLife(ctx *Context) []Issue {
+	var issues []Issue
+
+	settings := ctx.Settings.withDefaults()
+	today := now()
+	horizon := today.AddDate(0, 0, settings.EOLWarningDays)
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		if stage.Parent != nil || stage.BaseImage == "" || stage.BaseImage == "scratch" {
+			continue
+		}
+
+		supports := settings.Lifecycle.Lookup(stage.BaseImage)
+		var reasons, references []string
+		severity := SeverityUnset
+		for _, support := range supports {
+			cycle := support.Cycle
+			switch {
+			case cycle.EOL.Before(today) && cycle.ExtendedSupport.IsSet() && !cycle.ExtendedSupport.Before(today):
+				reasons = append(reasons, fmt.Sprintf("%s left regular security support on %s and only gets extended (LTS) fixes until %s",
+					support.Name(), cycle.EOL, cycle.ExtendedSupport))
+				severity = maxSeverity(severity, SeverityMedium)
+			case cycle.EOL.Before(today):
+				reasons = append(reasons, fmt.Sprintf("%s reached end of life%s", support.Name(), onDate(cycle.EOL)))
+				severity = maxSeverity(severity, SeverityHigh)
+			case cycle.EOL.Before(horizon):
+				days := int(cycle.EOL.Time.Sub(today).Hours()/24) + 1
+				reasons = append(reasons, fmt.Sprintf("%s reaches end of life on %s, in %d days", support.Name(), cycle.EOL, days))
+				severity = maxSeverity(severity, SeverityLow)
+			default:
+				continue
+			}
+			references = append(references, "https://endoflife.date/"+support.Product.Name)
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		fix := "Move to a supported version of the base image"
+		upgrade := catalog.Upgrade(stage.BaseImage, supports, horizon)
+		if upgrade != "" {
+			fix = fmt.Sprintf("Replace '%s' with a supported version, such as '%s'", stage.BaseImage, upgrade)
+		}
+		if raw := stage.From.RawImage(); strings.Contains(raw, "$") {
+			fix = argUpgradeFix(ctx.Dockerfile, raw, stage.BaseImage, upgrade)
+		}
+		issues = append(issues, Issue{
+			Type:       WarningIssue,
+			Message:    fmt.Sprintf("Base image %s: %s", stage.BaseImage, strings.Join(reasons, "; ")),
+			Fix:        fix,
+			Severity:   severity,
+			Impact:     "Versions past their end of life get no security fixes, so known vulnerabilities stay in the image",
+			References: references,
+			Details:    []string{fmt.Sprintf("End-of-life dates from lifecycle data %s", settings.Lifecycle.Version)},
+			Stage:      stage.String(),
+			Line:       stage.From.Line,
+		})
+	}
+
+	return issues
+}
+
+// argUpgradeFix names the ARG values to change to move an image written with
+// variables, such as node:${NODE_VERSION}, to the upgrade
+func argUpgradeFix(dockerfile *parser.Dockerfile, raw, image, upgrade string) string {
+	names := parser.Variables(raw)
+	fallback := fmt.Sprintf("Move to a supported version of the base image, set through ARG %s", strings.Join(names, ", "))
+	if upgrade == "" {
+		return fallback
+	}
+	fallback = fmt.Sprintf("Change ARG %s so that the image is a supported version, such as '%s' instead of '%s'", strings.Join(names, ", "), upgrade, image)
+
+	// Find the reference whose value holds the part of the image the
+	// upgrade changes
+	refs := variableRefRegex.FindAllString(raw, -1)
+	literals := variableRefRegex.Split(raw, -1)
+	for i := range literals {
+		literals[i] = regexp.QuoteMeta(literals[i])
+	}
+	loc := regexp.MustCompile("^" + strings.Join(literals, "(.*?)") + "$").FindStringSubmatchIndex(image)
+	if loc == nil {
+		return fallback
+	}
+	prefix := 0
+	for prefix < len(image) && prefix < len(upgrade) && image[prefix] == upgrade[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(image)-prefix && suffix < len(upgrade)-prefix && image[len(image)-1-suffix] == upgrade[len(upgrade)-1-suffix] {
+		suffix++
+	}
+	start, end := prefix, len(image)-suffix
+
+	literal := true
+	for i, ref := range refs {
+		from, to := loc[2*i+2], loc[2*i+3]
+		if end <= from || start >= to {
+			continue
+		}
+		literal = false
+		name := parser.Variables(ref)[0]
+		if start < from || end > to || (ref != "$"+name && ref != "${"+name+"}") {
+			continue
+		}
+		value := image[from:to]
+		next := value[:start-from] + upgrade[start:len(upgrade)-suffix] + value[end-from:]
+		if line := globalArgLine(dockerfile, name); line > 0 {
+			return fmt.Sprintf("Change ARG %s at line %d from '%s' to '%s' to use the supported '%s' instead of '%s'", name, line, value, next, upgrade, image)
+		}
+		return fmt.Sprintf("Pass --build-arg %s=%s to use the supported '%s' instead of '%s'", name, next, upgrade, image)
+	}
+	if literal {
+		// The version is written out on the FROM line
+		return fmt.Sprintf("Replace '%s' with a supported version, such as '%s'", image, upgrade)
+	}
+	return fallback
+}
+
+// globalArgLine returns the line of the last ARG before the first FROM that
+// declares name, or 0
+func globalArgLine(dockerfile *parser.Dockerfile, name string) int {
+	line := 0
+	for _, inst := range dockerfile.Instructions {
+		if inst.Command == "FROM" {
+			break
+		}
+		if inst.Command != "ARG" {
+			continue
+		}
+		for _, arg := range inst.Args {
+			if key, _, _ := strings.Cut(arg, "="); key == name {
+				line = inst.Line
+			}
+		}
+	}
+	return line
+}
+
+// onDate formats " on DATE" for a known date
+func onDate(date catalog.Date) string {
+	if date.Time.IsZero() {
+		return ""
+	}
+	return " on " + date.String()
+}
+
+func maxSeverity(a, b Severity) Severity {
+	if b > a {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,51 @@
+package checks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+func TestArgUpgradeFix(t *testing.T) {
+	tests := []struct {
+		source, upgrade, want string
+	}{
+		{"ARG V=14\nFROM node:${V}\n", "node:22",
+			"Change ARG V at line 1 from '14' to '22' to use the supported 'node:22' instead of 'node:14'"},
+		{"ARG NODE_VERSION=14\nARG VARIANT=alpine\nFROM node:$NODE_VERSION-${VARIANT}\n", "node:22-alpine",
+			"Change ARG NODE_VERSION at line 1 from '14' to '22' to use the supported 'node:22-alpine' instead of 'node:14-alpine'"},
+		{"ARG BASE=python:3.7\nFROM ${BASE}\n", "python:3.13",
+			"Change ARG BASE at line 1 from 'python:3.7' to 'python:3.13' to use the supported 'python:3.13' instead of 'python:3.7'"},
+		{"ARG REGISTRY=docker.io\nFROM ${REGISTRY}/library/node:14\n", "docker.io/library/node:22",
+			"Replace 'docker.io/library/node:14' with a supported version, such as 'docker.io/library/node:22'"},
+		{"FROM node:${V:-14}\n", "node:22",
+			"Change ARG V so that the image is a supported version, such as 'node:22' instead of 'node:14'"},
+		{"ARG V=14\nFROM node:${V}\n", "",
+			"Move to a supported version of the base image, set through ARG V"},
+	}
+	for _, tt := range tests {
+		dockerfile, err := parser.Parse(strings.NewReader(tt.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		from := dockerfile.Stages[0].From
+		if got := argUpgradeFix(dockerfile, from.RawImage(), from.Args[0], tt.upgrade); got != tt.want {
+			t.Errorf("argUpgradeFix(%q, %q) = %q, want %q", from.RawImage(), tt.upgrade, got, tt.want)
+		}
+	}
+}
+
+func TestCheckEndOfLifeNamesArg(t *testing.T) {
+	dockerfile, err := parser.Parse(strings.NewReader("ARG NODE_VERSION=14\nFROM node:${NODE_VERSION}-alpine\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := checkEndOfLife(&Context{Dockerfile: dockerfile})
+	if len(issues) != 1 {
+		t.Fatalf("got %d issues, want 1", len(issues))
+	}
+	if !strings.HasPrefix(issues[0].Fix, "Change ARG NODE_VERSION at line 1 from '14' to ") {
+		t.Errorf("got fix %q, want the ARG named", issues[0].Fix)
+	}
+}
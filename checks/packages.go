@@ -0,0 +1,164 @@
+package checks
+
+import (
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+// packageManager describes how a package manager installs packages and how
+// its cache is removed within the same layer
+type packageManager struct {
+	name       string
+	commands   []string
+	install    []string // Subcommands that download packages
+	clean      []string // Subcommands that drop the cache
+	cacheDirs  []string // Directories holding the package cache
+	cleanFlags []string // Install flags that skip the cache entirely
+	fix        string
+}
+
+var packageManagers = []packageManager{
+	{
+		name:      "apt",
+		commands:  []string{"apt-get", "apt"},
+		install:   []string{"install", "upgrade", "dist-upgrade"},
+		clean:     []string{"clean"},
+		cacheDirs: []string{"/var/lib/apt/lists", "/var/cache/apt"},
+		fix:       "Add cleanup after apt-get install:\nRUN apt-get update && \\\n    apt-get install -y curl wget && \\\n    apt-get clean && \\\n    rm -rf /var/lib/apt/lists/*",
+	},
+	{
+		name:      "yum",
+		commands:  []string{"yum", "dnf", "microdnf"},
+		install:   []string{"install", "update", "upgrade", "groupinstall"},
+		clean:     []string{"clean"},
+		cacheDirs: []string{"/var/cache/yum", "/var/cache/dnf"},
+		fix:       "Add cleanup after yum install:\nRUN yum install -y package-name && \\\n    yum clean all && \\\n    rm -rf /var/cache/yum",
+	},
+	{
+		name:       "apk",
+		commands:   []string{"apk"},
+		install:    []string{"add", "upgrade"},
+		cacheDirs:  []string{"/var/cache/apk"},
+		cleanFlags: []string{"--no-cache"},
+		fix:        "Add --no-cache flag to apk add:\nRUN apk add --no-cache curl wget",
+	},
+}
+
+// uncleanedPackageManager returns the first package manager whose install in
+// a RUN instruction is not followed by a cache cleanup in the same instruction.
+// Cleanups that only run when an earlier command failed do not count.
+func uncleanedPackageManager(instruction parser.Instruction) *packageManager {
+	if instruction.Shell == nil {
+		return nil
+	}
+
+	commands := instruction.Shell.Commands()
+	for i := range packageManagers {
+		pm := &packageManagers[i]
+		if pm.cacheMounted(instruction) {
+			continue
+		}
+
+		pending := false
+		for _, cmd := range commands {
+			switch {
+			case pm.installs(cmd):
+				pending = true
+			case pending && !cmd.OnFailure && pm.cleans(cmd):
+				pending = false
+			}
+		}
+		if pending {
+			return pm
+		}
+	}
+
+	return nil
+}
+
+// PackageCacheLeft returns the name of the package manager ("apt", "yum" or
+// "apk") whose cache a RUN instruction leaves in its layer, or ""
+func PackageCacheLeft(instruction parser.Instruction) string {
+	if pm := uncleanedPackageManager(instruction); pm != nil {
+		return pm.name
+	}
+	return ""
+}
+
+// installs reports whether a command installs packages and keeps the cache
+func (pm *packageManager) installs(cmd *shell.SimpleCommand) bool {
+	if !contains(pm.commands, cmd.EffectiveName()) {
+		return false
+	}
+	if !contains(pm.install, subcommand(cmd)) {
+		return false
+	}
+	return len(pm.cleanFlags) == 0 || !cmd.HasFlag(pm.cleanFlags...)
+}
+
+// cleans reports whether a command removes the package cache
+func (pm *packageManager) cleans(cmd *shell.SimpleCommand) bool {
+	if contains(pm.commands, cmd.EffectiveName()) {
+		sub := subcommand(cmd)
+		if contains(pm.clean, sub) {
+			return true
+		}
+		// apk cache clean
+		return sub == "cache" && contains(cmd.Effective(), "clean")
+	}
+
+	if cmd.EffectiveName() != "rm" {
+		return false
+	}
+	for _, arg := range cmd.Effective()[1:] {
+		for _, dir := range pm.cacheDirs {
+			if strings.HasPrefix(arg, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheMounted reports whether the cache directory is a RUN --mount=type=cache
+// target, so that it never becomes part of the layer
+func (pm *packageManager) cacheMounted(instruction parser.Instruction) bool {
+	for _, mount := range instruction.FlagValues("mount") {
+		if !strings.Contains(mount, "type=cache") {
+			continue
+		}
+		for _, field := range strings.Split(mount, ",") {
+			key, value, _ := strings.Cut(field, "=")
+			if key != "target" && key != "dst" && key != "destination" {
+				continue
+			}
+			for _, dir := range pm.cacheDirs {
+				if strings.HasPrefix(strings.TrimSuffix(value, "/"), dir) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// subcommand returns the first non-option argument of a command
+func subcommand(cmd *shell.SimpleCommand) string {
+	for _, arg := range cmd.Effective()[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
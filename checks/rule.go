@@ -0,0 +1,217 @@
+package checks
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/catalog"
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/registry"
+	"github.com/avirooppal/dock-slimscheck/vuln"
+)
+
+// Category groups related rules
+type Category string
+
+const (
+	CategoryBaseImage    Category = "base-image"
+	CategoryBestPractice Category = "best-practice"
+	CategoryLayerSize    Category = "layer-size"
+	CategorySecurity     Category = "security"
+)
+
+// Settings holds the tunable limits of the rules. Zero values fall back to
+// the defaults in DefaultSettings.
+type Settings struct {
+	LargeLayerMB       int64 // Layers larger than this are reported by DS010
+	LayerGrowthMB      int64 // Minimum growth over the previous layer for DS011
+	LayerGrowthPercent int   // Minimum relative growth over the previous layer for DS011
+	WastedSpaceMB      int64 // Layers wasting more than this are reported by DS012
+	EOLWarningDays     int   // DS013 also reports versions losing support within this many days
+
+	// Lifecycle holds the end-of-life dates used by DS013, the embedded
+	// data when nil
+	Lifecycle *catalog.Lifecycle
+
+	// BaseImageAlternatives maps image names to the alternative DS002
+	// suggests for them, in place of the base image catalog
+	BaseImageAlternatives map[string]string
+}
+
+// DefaultSettings are the limits used when nothing is configured
+var DefaultSettings = Settings{
+	LargeLayerMB:       100,
+	LayerGrowthMB:      50,
+	LayerGrowthPercent: 30,
+	WastedSpaceMB:      10,
+	EOLWarningDays:     90,
+}
+
+// withDefaults fills unset limits from DefaultSettings
+func (s Settings) withDefaults() Settings {
+	if s.LargeLayerMB <= 0 {
+		s.LargeLayerMB = DefaultSettings.LargeLayerMB
+	}
+	if s.LayerGrowthMB <= 0 {
+		s.LayerGrowthMB = DefaultSettings.LayerGrowthMB
+	}
+	if s.LayerGrowthPercent <= 0 {
+		s.LayerGrowthPercent = DefaultSettings.LayerGrowthPercent
+	}
+	if s.WastedSpaceMB <= 0 {
+		s.WastedSpaceMB = DefaultSettings.WastedSpaceMB
+	}
+	if s.EOLWarningDays <= 0 {
+		s.EOLWarningDays = DefaultSettings.EOLWarningDays
+	}
+	if s.Lifecycle == nil {
+		s.Lifecycle = catalog.DefaultLifecycle()
+	}
+	return s
+}
+
+// Context holds everything a rule may inspect
+type Context struct {
+	Dockerfile *parser.Dockerfile
+	ContextDir string   // Directory of the build context
+	Settings   Settings // Limits and lists configured for the rules
+
+	// Image whose layers the layer size rules inspect. When nil, the
+	// history of the base image is read from Runtime.
+	Image *archive.Image
+
+	// Runtime holding the base image, nil when no container runtime is used
+	Runtime container.Runtime
+
+	// BaseImage read from its registry, whose layers are inspected when
+	// the runtime does not have the base image
+	BaseImage *registry.Image
+
+	// Advisories the installed packages are matched against, nil when
+	// none were given
+	Advisories *vuln.Database
+
+	// Checksums holds the sha256 digests of the files ADD downloads, by URL,
+	// when they were fetched with --fetch-checksums
+	Checksums map[string]string
+
+	layers    []*archive.Layer
+	layersSet bool
+}
+
+// Rule is a single check with a stable identifier such as DS001
+type Rule interface {
+	ID() string
+	Name() string
+	Category() Category
+	DefaultSeverity() Severity
+	Description() string
+	Check(ctx *Context) []Issue
+}
+
+// funcRule is a Rule backed by a plain check function
+type funcRule struct {
+	id          string
+	name        string
+	category    Category
+	severity    Severity
+	description string
+	check       func(ctx *Context) []Issue
+}
+
+// NewRule creates a Rule from its metadata and check function
+func NewRule(id, name string, category Category, severity Severity, description string, check func(ctx *Context) []Issue) Rule {
+	return &funcRule{
+		id:          id,
+		name:        name,
+		category:    category,
+		severity:    severity,
+		description: description,
+		check:       check,
+	}
+}
+
+func (r *funcRule) ID() string                 { return r.id }
+func (r *funcRule) Name() string               { return r.name }
+func (r *funcRule) Category() Category         { return r.category }
+func (r *funcRule) DefaultSeverity() Severity  { return r.severity }
+func (r *funcRule) Description() string        { return r.description }
+func (r *funcRule) Check(ctx *Context) []Issue { return r.check(ctx) }
+
+// registered holds every registered rule by ID
+var registered = map[string]Rule{}
+
+// Register adds a rule to the registry. It panics if the ID is already taken,
+// since rule IDs are referenced from configuration and must stay unique.
+func Register(rule Rule) {
+	if _, exists := registered[rule.ID()]; exists {
+		panic(fmt.Sprintf("checks: rule %s registered twice", rule.ID()))
+	}
+	registered[rule.ID()] = rule
+}
+
+// Rules returns all registered rules ordered by ID
+func Rules() []Rule {
+	rules := make([]Rule, 0, len(registered))
+	for _, rule := range registered {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID() < rules[j].ID()
+	})
+	return rules
+}
+
+// LookupRule returns the rule with the given ID
+func LookupRule(id string) (Rule, bool) {
+	rule, ok := registered[id]
+	return rule, ok
+}
+
+// Run executes the registered rules accepted by filter, in ID order. A nil
+// filter runs every rule. Issues are stamped with the ID of the rule that
+// produced them, default to the rule severity and are marked when a
+// slimcheck:ignore comment silences them.
+func Run(ctx *Context, filter func(rule Rule) bool) []Issue {
+	var issues []Issue
+
+	for _, rule := range Rules() {
+		if filter != nil && !filter(rule) {
+			continue
+		}
+		for _, issue := range rule.Check(ctx) {
+			if issue.RuleID == "" {
+				issue.RuleID = rule.ID()
+			}
+			if issue.Severity == SeverityUnset {
+				issue.Severity = rule.DefaultSeverity()
+			}
+			if issue.EndLine < issue.Line {
+				issue.EndLine = instructionEndLine(ctx.Dockerfile, issue.Line)
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	ApplySuppressions(ctx.Dockerfile, issues)
+	return issues
+}
+
+// RunCategory executes the registered rules of a single category
+func RunCategory(ctx *Context, category Category) []Issue {
+	return Run(ctx, func(rule Rule) bool {
+		return rule.Category() == category
+	})
+}
+
+// instructionEndLine returns the last line of the instruction starting at line
+func instructionEndLine(dockerfile *parser.Dockerfile, line int) int {
+	for _, inst := range dockerfile.Instructions {
+		if inst.Line == line {
+			return inst.EndLine
+		}
+	}
+	return line
+}
@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks how serious an issue is
+type Severity int
+
+const (
+	SeverityUnset Severity = iota // Not set; Run fills in the rule default
+	SeverityInfo
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+// severityNames maps each severity to its name in output and configuration
+var severityNames = map[Severity]string{
+	SeverityUnset:    "",
+	SeverityInfo:     "info",
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// Severities lists the valid severities from least to most serious
+var Severities = []Severity{SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// String returns the lower-case name of the severity
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// ParseSeverity parses a severity name such as "medium", ignoring case
+func ParseSeverity(name string) (Severity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, severity := range Severities {
+		if severityNames[severity] == name {
+			return severity, nil
+		}
+	}
+	return SeverityUnset, fmt.Errorf("unknown severity %q, expected info, low, medium, high or critical", name)
+}
+
+// ParseThreshold parses the minimum severity that fails a check, as given
+// with --fail-on or fail_on. Informational findings never fail a check, so
+// "info" is rejected.
+func ParseThreshold(name string) (Severity, error) {
+	severity, err := ParseSeverity(name)
+	if err != nil || severity == SeverityInfo {
+		return SeverityUnset, fmt.Errorf("unknown threshold %q, expected low, medium, high or critical", strings.ToLower(strings.TrimSpace(name)))
+	}
+	return severity, nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = severity
+	return nil
+}
@@ -0,0 +1,27 @@
+package checks
+
+import "testing"
+
+func TestParseThreshold(t *testing.T) {
+	tests := map[string]Severity{
+		"low":      SeverityLow,
+		"Medium":   SeverityMedium,
+		" high ":   SeverityHigh,
+		"CRITICAL": SeverityCritical,
+	}
+	for name, want := range tests {
+		got, err := ParseThreshold(name)
+		if err != nil || got != want {
+			t.Errorf("ParseThreshold(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	for _, name := range []string{"info", "INFO", "", "severe"} {
+		if _, err := ParseThreshold(name); err == nil {
+			t.Errorf("ParseThreshold(%q) succeeded, want an error", name)
+		}
+	}
+	if _, err := ParseSeverity("info"); err != nil {
+		t.Errorf("ParseSeverity(\"info\"): %v, want rule severities to accept info", err)
+	}
+}
@@ -0,0 +1,141 @@
+package checks
+
+import (
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+const (
+	ignoreDirective     = "slimcheck:ignore"
+	ignoreFileDirective = "slimcheck:ignore-file"
+)
+
+// Suppression is a slimcheck:ignore comment that silences findings
+type Suppression struct {
+	RuleIDs   []string // Rules silenced, empty for every rule
+	Reason    string   // Value of reason="..."
+	Line      int      // Line of the comment
+	File      bool     // True for slimcheck:ignore-file, which covers the whole file
+	StartLine int      // First line of the instruction the comment applies to
+	EndLine   int      // Last line of the instruction the comment applies to
+}
+
+// ParseSuppressions collects the suppression comments of a Dockerfile.
+// A slimcheck:ignore comment applies to the next instruction; comments that
+// are not followed by an instruction are dropped.
+func ParseSuppressions(dockerfile *parser.Dockerfile) []Suppression {
+	var suppressions []Suppression
+
+	for _, comment := range dockerfile.Comments {
+		suppression, ok := parseSuppression(comment.Text)
+		if !ok {
+			continue
+		}
+		suppression.Line = comment.Line
+
+		if !suppression.File {
+			inst := nextInstruction(dockerfile, comment.Line)
+			if inst == nil {
+				continue
+			}
+			suppression.StartLine, suppression.EndLine = inst.Line, inst.EndLine
+		}
+		suppressions = append(suppressions, suppression)
+	}
+
+	return suppressions
+}
+
+// parseSuppression parses the text of a comment such as
+// slimcheck:ignore DS004,DS008 reason="needs root for iptables"
+func parseSuppression(text string) (Suppression, bool) {
+	var suppression Suppression
+
+	directive, rest, _ := strings.Cut(text, " ")
+	switch strings.ToLower(directive) {
+	case ignoreDirective:
+	case ignoreFileDirective:
+		suppression.File = true
+	default:
+		return suppression, false
+	}
+
+	rest = strings.TrimSpace(rest)
+	if i := strings.Index(rest, "reason="); i >= 0 {
+		suppression.Reason = parseReason(rest[i+len("reason="):])
+		rest = rest[:i]
+	}
+
+	for _, field := range strings.FieldsFunc(rest, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		suppression.RuleIDs = append(suppression.RuleIDs, strings.ToUpper(field))
+	}
+
+	return suppression, true
+}
+
+// parseReason reads a quoted or bare reason value
+func parseReason(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+		return value[1:]
+	}
+	return value
+}
+
+// nextInstruction returns the first instruction starting after a line
+func nextInstruction(dockerfile *parser.Dockerfile, line int) *parser.Instruction {
+	for i := range dockerfile.Instructions {
+		if dockerfile.Instructions[i].Line > line {
+			return &dockerfile.Instructions[i]
+		}
+	}
+	return nil
+}
+
+// matches reports whether the suppression silences an issue
+func (s Suppression) matches(issue Issue) bool {
+	return s.Covers(issue.RuleID, issue.Line)
+}
+
+// Covers reports whether the suppression silences a rule at a line
+func (s Suppression) Covers(ruleID string, line int) bool {
+	if len(s.RuleIDs) > 0 && !contains(s.RuleIDs, ruleID) {
+		return false
+	}
+	if s.File {
+		return true
+	}
+	return line >= s.StartLine && line <= s.EndLine
+}
+
+// ApplySuppressions marks the issues silenced by suppression comments. The
+// issues are kept so that machine-readable output can still report them.
+func ApplySuppressions(dockerfile *parser.Dockerfile, issues []Issue) {
+	suppressions := ParseSuppressions(dockerfile)
+	for i := range issues {
+		for _, suppression := range suppressions {
+			if suppression.matches(issues[i]) {
+				issues[i].Suppressed = true
+				issues[i].SuppressionReason = suppression.Reason
+				break
+			}
+		}
+	}
+}
+
+// Unsuppressed returns the issues that were not silenced
+func Unsuppressed(issues []Issue) []Issue {
+	var active []Issue
+	for _, issue := range issues {
+		if !issue.Suppressed {
+			active = append(active, issue)
+		}
+	}
+	return active
+}
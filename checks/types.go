@@ -11,10 +11,31 @@ const (
 
 // Issue represents a problem found in the Dockerfile
 type Issue struct {
-	Type        IssueType
-	Message     string
-	Fix         string    // Detailed fix suggestion
-	Severity    string    // "low", "medium", "high"
-	Impact      string    // Description of the impact
-	References  []string  // Links to relevant documentation
-}
\ No newline at end of file
+	Type              IssueType
+	Message           string
+	Fix               string   // Detailed fix suggestion
+	Severity          Severity // How serious the issue is
+	Impact            string   // Description of the impact
+	References        []string // Links to relevant documentation
+	Details           []string // Supporting facts, such as the largest files of a layer
+	Stage             string   // Build stage the issue belongs to
+	RuleID            string   // ID of the rule that produced the issue, e.g. "DS001"
+	Line              int      // Line of the instruction the issue points at, 0 if none
+	EndLine           int      // Last line of that instruction, including continuations
+	Suppressed        bool     // Silenced by a slimcheck:ignore comment
+	SuppressionReason string   // Reason given in the slimcheck:ignore comment
+}
+
+// String returns the lower-case name of the issue type
+func (t IssueType) String() string {
+	switch t {
+	case WarningIssue:
+		return "warning"
+	case SecurityIssue:
+		return "security"
+	case InfoIssue:
+		return "info"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"fmt"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/utils"
+)
+
+// wastedPathsShown limits the paths listed in a DS012 finding
+const wastedPathsShown = 5
+
+func init() {
+	Register(NewRule("DS012", "wasted-space", CategoryLayerSize, SeverityMedium,
+		"A layer adds files that a later layer deletes or overwrites (needs --image-archive or --oci-layout)", checkWastedSpace))
+}
+
+// checkWastedSpace finds layers whose files are hidden by later layers, so
+// their bytes ship without being visible in the image
+func checkWastedSpace(ctx *Context) []Issue {
+	var issues []Issue
+
+	img := ctx.Image
+	if img == nil || img.Waste == nil {
+		return issues
+	}
+	limit := ctx.Settings.withDefaults().WastedSpaceMB * 1000000
+
+	for _, layer := range img.Layers {
+		if layer.WastedSize <= limit {
+			continue
+		}
+
+		issue := Issue{
+			Type: WarningIssue,
+			Message: fmt.Sprintf("%s adds %s that later layers delete or overwrite (image efficiency %.1f%%)",
+				layerSubject(layer), utils.FormatSize(layer.WastedSize), img.Waste.Efficiency()*100),
+			Fix:     wastedSpaceFix(layer),
+			Impact:  "Deleted and overwritten files are hidden but still ship in the layer that added them",
+			Details: wastedPaths(img, layer),
+			References: []string{
+				"https://docs.docker.com/build/building/best-practices/#run",
+				"https://docs.docker.com/build/building/multi-stage/",
+			},
+		}
+		ctx.locateLayer(&issue, layer)
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// wastedPaths lists the largest paths a layer added that were hidden later
+func wastedPaths(img *archive.Image, layer *archive.Layer) []string {
+	var paths []string
+	for _, file := range img.Waste.Files {
+		for _, index := range file.AddedBy {
+			if index == layer.Index {
+				paths = append(paths, fmt.Sprintf("%s (%s)", file.Path, utils.FormatSize(file.Size)))
+				break
+			}
+		}
+		if len(paths) == wastedPathsShown {
+			break
+		}
+	}
+	return paths
+}
+
+// wastedSpaceFix suggests removing temporary files where they are created
+func wastedSpaceFix(layer *archive.Layer) string {
+	if inst := layer.Instruction(); inst != nil && inst.Command == "RUN" {
+		return "Delete temporary files in the same RUN instruction that creates them, e.g. 'RUN apt-get update && apt-get install -y pkg && rm -rf /var/lib/apt/lists/*'"
+	}
+	return "Avoid adding files that a later step deletes or replaces: copy only what the image needs, or build in a separate stage and COPY --from it"
+}
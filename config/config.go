@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+)
+
+// FileNames lists the configuration file names looked up, in order
+var FileNames = []string{".slimcheck.yaml", ".slimcheck.yml"}
+
+// Config is the project configuration read from .slimcheck.yaml
+type Config struct {
+	Path string `yaml:"-"` // File the configuration was read from, empty for defaults
+
+	// Security enables the security rules, like the --security flag
+	Security bool `yaml:"security"`
+
+	// FailOn is the minimum severity that fails the check, like --fail-on
+	FailOn string `yaml:"fail_on"`
+
+	Rules      RulesConfig      `yaml:"rules"`
+	Thresholds ThresholdsConfig `yaml:"thresholds"`
+
+	// BaseImageAlternatives replaces the catalog suggestions of DS002 by image name
+	BaseImageAlternatives map[string]string `yaml:"base_image_alternatives"`
+
+	// LifecycleFile refreshes the end-of-life dates of DS013, like --lifecycle.
+	// A relative path is relative to the configuration file.
+	LifecycleFile string `yaml:"lifecycle_file"`
+
+	// Advisories is a directory of OSV advisories that turns on DS109, like
+	// --advisories. A relative path is relative to the configuration file.
+	Advisories string `yaml:"advisories"`
+}
+
+// RulesConfig selects rules by ID and overrides their severities
+type RulesConfig struct {
+	Enable   []string          `yaml:"enable"`   // Rules to run even if their category is off
+	Disable  []string          `yaml:"disable"`  // Rules never to run
+	Severity map[string]string `yaml:"severity"` // Severity overrides by rule ID
+}
+
+// ThresholdsConfig overrides the limits used by the layer size rules
+type ThresholdsConfig struct {
+	LargeLayerMB       int64 `yaml:"large_layer_mb"`
+	LayerGrowthMB      int64 `yaml:"layer_growth_mb"`
+	LayerGrowthPercent int   `yaml:"layer_growth_percent"`
+	WastedSpaceMB      int64 `yaml:"wasted_space_mb"`
+	EOLWarningDays     int   `yaml:"eol_warning_days"`
+}
+
+// Find looks for a configuration file in dir and its parent directories and
+// returns its path, or "" when there is none
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Discover finds and loads the configuration that applies to a Dockerfile
+// directory. Without a configuration file it returns the defaults.
+func Discover(dir string) (*Config, error) {
+	path, err := Find(dir)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+	return Load(path)
+}
+
+// Load reads and validates a configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+
+	config := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	config.Path = path
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// validate checks that referenced rules exist and severities are known
+func (c *Config) validate() error {
+	for _, ids := range [][]string{c.Rules.Enable, c.Rules.Disable} {
+		for _, id := range ids {
+			if _, ok := checks.LookupRule(id); !ok {
+				return fmt.Errorf("unknown rule %q", id)
+			}
+		}
+	}
+
+	for id, severity := range c.Rules.Severity {
+		if _, ok := checks.LookupRule(id); !ok {
+			return fmt.Errorf("unknown rule %q", id)
+		}
+		if _, err := checks.ParseSeverity(severity); err != nil {
+			return fmt.Errorf("rule %s: %v", id, err)
+		}
+	}
+
+	if c.FailOn != "" {
+		if _, err := checks.ParseThreshold(c.FailOn); err != nil {
+			return fmt.Errorf("fail_on: %v", err)
+		}
+	}
+
+	if c.Thresholds.LargeLayerMB < 0 || c.Thresholds.LayerGrowthMB < 0 || c.Thresholds.LayerGrowthPercent < 0 || c.Thresholds.WastedSpaceMB < 0 || c.Thresholds.EOLWarningDays < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	return nil
+}
+
+// RuleEnabled reports whether a rule should run. Disabled rules never run,
+// enabled rules always do, and security rules otherwise need security mode.
+func (c *Config) RuleEnabled(rule checks.Rule, security bool) bool {
+	if contains(c.Rules.Disable, rule.ID()) {
+		return false
+	}
+	if contains(c.Rules.Enable, rule.ID()) {
+		return true
+	}
+	return rule.Category() != checks.CategorySecurity || security || c.Security
+}
+
+// Settings returns the rule settings with the configured thresholds applied
+func (c *Config) Settings() checks.Settings {
+	return checks.Settings{
+		LargeLayerMB:          c.Thresholds.LargeLayerMB,
+		LayerGrowthMB:         c.Thresholds.LayerGrowthMB,
+		LayerGrowthPercent:    c.Thresholds.LayerGrowthPercent,
+		WastedSpaceMB:         c.Thresholds.WastedSpaceMB,
+		EOLWarningDays:        c.Thresholds.EOLWarningDays,
+		BaseImageAlternatives: c.BaseImageAlternatives,
+	}
+}
+
+// LifecyclePath returns the configured lifecycle refresh file, resolved
+// against the directory of the configuration file
+func (c *Config) LifecyclePath() string {
+	return c.resolve(c.LifecycleFile)
+}
+
+// AdvisoriesPath returns the configured advisory directory, resolved
+// against the directory of the configuration file
+func (c *Config) AdvisoriesPath() string {
+	return c.resolve(c.Advisories)
+}
+
+// resolve makes a configured path relative to the configuration file
+func (c *Config) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) || c.Path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(c.Path), path)
+}
+
+// ApplySeverities replaces the severity of issues whose rule is overridden
+func (c *Config) ApplySeverities(issues []checks.Issue) {
+	for i, issue := range issues {
+		if name, ok := c.Rules.Severity[issue.RuleID]; ok {
+			severity, _ := checks.ParseSeverity(name)
+			issues[i].Severity = severity
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is one line of a .dockerignore file
+type ignorePattern struct {
+	pattern *regexp.Regexp
+	negate  bool // A "!" line that includes paths again
+}
+
+// contextArchive streams the build context as a tar archive, leaving out
+// paths matched by its .dockerignore. It returns the archive and the
+// Dockerfile's path inside it; a Dockerfile outside the context is added
+// under a generated name, as the docker command line does.
+func contextArchive(contextDir, dockerfile string) (io.ReadCloser, string, error) {
+	patterns, err := readDockerignore(contextDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	absContext, err := filepath.Abs(contextDir)
+	if err != nil {
+		return nil, "", err
+	}
+	absDockerfile, err := filepath.Abs(dockerfile)
+	if err != nil {
+		return nil, "", err
+	}
+	name, err := filepath.Rel(absContext, absDockerfile)
+	if err != nil {
+		return nil, "", err
+	}
+	name = filepath.ToSlash(name)
+
+	var external []byte
+	if name == ".." || strings.HasPrefix(name, "../") {
+		if external, err = os.ReadFile(dockerfile); err != nil {
+			return nil, "", err
+		}
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		name = ".dockerfile." + hex.EncodeToString(b)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeContext(writer, absContext, name, external, patterns))
+	}()
+	return reader, name, nil
+}
+
+// writeContext writes the files of the context that are not ignored. The
+// Dockerfile and .dockerignore are always sent, since the builder reads them.
+func writeContext(w io.Writer, dir, dockerfile string, external []byte, patterns []ignorePattern) error {
+	tw := tar.NewWriter(w)
+	negations := false
+	for _, p := range patterns {
+		negations = negations || p.negate
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != dockerfile && rel != ".dockerignore" && ignored(patterns, rel) {
+			// An ignored directory may still hold paths a "!" line includes
+			if entry.IsDir() && !negations {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if entry.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if external != nil {
+		hdr := &tar.Header{Name: dockerfile, Mode: 0o644, Size: int64(len(external)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(external); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ContextFilter reads the .dockerignore of a build context and returns a
+// function reporting whether a path, relative to the context and written
+// with forward slashes, is left out of the build
+func ContextFilter(contextDir string) (func(path string) bool, error) {
+	patterns, err := readDockerignore(contextDir)
+	if err != nil {
+		return nil, err
+	}
+	return func(path string) bool {
+		return ignored(patterns, path)
+	}, nil
+}
+
+// readDockerignore reads the patterns of the context's .dockerignore, if any
+func readDockerignore(dir string) ([]ignorePattern, error) {
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		line = strings.TrimSpace(strings.TrimPrefix(line, "!"))
+		line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(line)), "/")
+		if line == "" || line == "." {
+			continue
+		}
+		pattern, err := ignoreRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %v", line, err)
+		}
+		patterns = append(patterns, ignorePattern{pattern: pattern, negate: negate})
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether the last pattern matching the path, or one of its
+// parent directories, excludes it
+func ignored(patterns []ignorePattern, path string) bool {
+	excluded := false
+	for _, p := range patterns {
+		if matchesPathOrParent(p.pattern, path) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// matchesPathOrParent reports whether a pattern matches the path or one of
+// its parent directories, which excludes everything below them
+func matchesPathOrParent(pattern *regexp.Regexp, path string) bool {
+	for {
+		if pattern.MatchString(path) {
+			return true
+		}
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+// ignoreRegexp translates a .dockerignore pattern: filepath.Match syntax
+// where "**" also matches any number of directories
+func ignoreRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			b.WriteString(pattern[i : i+end+1])
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
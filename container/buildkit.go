@@ -0,0 +1,42 @@
+package container
+
+import (
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// classicFlags lists the builder flags the classic builder accepts. Any
+// other flag is BuildKit-only.
+var classicFlags = map[string]map[string]bool{
+	"FROM": {"platform": true},
+	"COPY": {"from": true, "chown": true},
+	"ADD":  {"chown": true},
+}
+
+// buildKitFeature returns the first BuildKit-only feature a Dockerfile uses,
+// such as "RUN --mount" or "RUN with a heredoc", or "" when the classic
+// builder can build it. Dockerfiles that fail to parse are left for the
+// builder to report.
+func buildKitFeature(path string) string {
+	dockerfile, err := parser.ParseDockerfile(path)
+	if err != nil {
+		return ""
+	}
+	if syntax := dockerfile.Directives["syntax"]; syntax != "" {
+		return "the syntax directive " + syntax
+	}
+
+	for _, inst := range dockerfile.Instructions {
+		if inst.Trigger != nil {
+			inst = *inst.Trigger
+		}
+		if len(inst.Heredocs) > 0 {
+			return inst.Command + " with a heredoc"
+		}
+		for _, flag := range inst.Flags {
+			if !classicFlags[inst.Command][flag.Name] {
+				return inst.Command + " --" + flag.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CLI is a runtime driven through a docker-compatible command line
+type CLI struct {
+	Command string // Executable, looked up in PATH
+}
+
+// The supported command line runtimes
+var (
+	Docker  = &CLI{Command: "docker"}
+	Podman  = &CLI{Command: "podman"}
+	Nerdctl = &CLI{Command: "nerdctl"}
+)
+
+// cliImage is the part of "image inspect" output that is read. Docker,
+// Podman and nerdctl (in its default dockercompat mode) agree on it, and the
+// Engine API inspect endpoint returns the same object.
+type cliImage struct {
+	ID           string   `json:"Id"`
+	RepoTags     []string `json:"RepoTags"`
+	RepoDigests  []string `json:"RepoDigests"`
+	Size         int64    `json:"Size"`
+	Architecture string   `json:"Architecture"`
+	OS           string   `json:"Os"`
+}
+
+// Name returns the executable name
+func (c *CLI) Name() string {
+	return c.Command
+}
+
+// Available reports whether the executable is installed and runs
+func (c *CLI) Available() bool {
+	if _, err := exec.LookPath(c.Command); err != nil {
+		return false
+	}
+	return exec.Command(c.Command, "--version").Run() == nil
+}
+
+// InspectImage reads "image inspect" as JSON
+func (c *CLI) InspectImage(ref string) (*ImageInfo, error) {
+	output, err := c.run("image", "inspect", "--format", "{{json .}}", ref)
+	if err != nil {
+		return nil, fmt.Errorf("could not inspect %s: %v", ref, err)
+	}
+
+	var image cliImage
+	if err := json.Unmarshal(bytes.TrimSpace(output), &image); err != nil {
+		return nil, fmt.Errorf("could not parse %s image inspect output: %v", c.Command, err)
+	}
+	return &ImageInfo{
+		ID:           image.ID,
+		RepoTags:     image.RepoTags,
+		RepoDigests:  image.RepoDigests,
+		Size:         image.Size,
+		Architecture: image.Architecture,
+		OS:           image.OS,
+	}, nil
+}
+
+// History reads "history", which lists the newest entry first
+func (c *CLI) History(ref string) ([]HistoryEntry, error) {
+	output, err := c.run("history", "--human=false", "--no-trunc", "--format", "{{.ID}}\t{{.Size}}\t{{.CreatedBy}}\t{{.Comment}}", ref)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the history of %s: %v", ref, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	var entries []HistoryEntry
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] == "" {
+			continue
+		}
+		fields := strings.SplitN(lines[i], "\t", 4)
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			size = -1
+		}
+		entries = append(entries, HistoryEntry{
+			ID:        fields[0],
+			Size:      size,
+			CreatedBy: fields[2],
+			Comment:   fields[3],
+		})
+	}
+	return entries, nil
+}
+
+// Save runs "save"
+func (c *CLI) Save(ref, path string) error {
+	if _, err := c.run("save", "--output", path, ref); err != nil {
+		return fmt.Errorf("could not export %s: %v", ref, err)
+	}
+	return nil
+}
+
+// Build runs "build" quietly
+func (c *CLI) Build(opts BuildOptions) error {
+	args := []string{"build", "--quiet", "--file", opts.Dockerfile, "--tag", opts.Tag}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	keys := make([]string, 0, len(opts.BuildArgs))
+	for key := range opts.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", key+"="+opts.BuildArgs[key])
+	}
+	args = append(args, opts.ContextDir)
+
+	if _, err := c.run(args...); err != nil {
+		return fmt.Errorf("could not build %s: %v", opts.Dockerfile, err)
+	}
+	return nil
+}
+
+// RemoveImage runs "image rm --force"
+func (c *CLI) RemoveImage(ref string) error {
+	_, err := c.run("image", "rm", "--force", ref)
+	return err
+}
+
+// run executes the runtime, returning its error output on failure
+func (c *CLI) run(args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(c.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
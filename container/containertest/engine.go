@@ -0,0 +1,182 @@
+package containertest
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+)
+
+// EngineAPIVersion is the API version the stand-in engine reports
+const EngineAPIVersion = "1.43"
+
+// versionedPath splits an Engine API path into its version and endpoint
+var versionedPath = regexp.MustCompile(`^/v([0-9.]+)(/.*)$`)
+
+// EngineServer is an Engine API stand-in serving the images of a fake
+// runtime, for exercising container.Engine without a Docker daemon
+type EngineServer struct {
+	*httptest.Server
+	Fake        *Fake
+	APIVersion  string   // Version reported by the ping endpoint
+	Requests    []string // "METHOD path" of every request so far
+	BuildFiles  []string // Paths in the build context of the last build
+	BuildErrMsg string   // Reported in the build progress stream when set
+}
+
+// NewEngineServer starts an Engine API stand-in for a fake runtime. Close it
+// when done; its URL is a valid container.NewEngine host.
+func NewEngineServer(fake *Fake) *EngineServer {
+	s := &EngineServer{Fake: fake, APIVersion: EngineAPIVersion}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Engine returns a client for the stand-in
+func (s *EngineServer) Engine() *container.Engine {
+	return container.NewEngine(s.URL)
+}
+
+func (s *EngineServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+
+	if r.URL.Path == "/_ping" {
+		w.Header().Set("Api-Version", s.APIVersion)
+		io.WriteString(w, "OK")
+		return
+	}
+
+	match := versionedPath.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		writeError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	path := match[2]
+
+	switch {
+	case r.Method == http.MethodPost && path == "/build":
+		s.build(w, r)
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json"):
+		s.inspect(w, imageName(path, "/json"))
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/history"):
+		s.history(w, imageName(path, "/history"))
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/get"):
+		s.export(w, imageName(path, "/get"))
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/images/"):
+		if err := s.Fake.RemoveImage(imageName(path, "")); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, []map[string]string{{"Untagged": imageName(path, "")}})
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *EngineServer) inspect(w http.ResponseWriter, ref string) {
+	image, err := s.Fake.lookup(ref)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"Id":           image.Info.ID,
+		"RepoTags":     image.Info.RepoTags,
+		"RepoDigests":  image.Info.RepoDigests,
+		"Size":         image.Info.Size,
+		"Architecture": image.Info.Architecture,
+		"Os":           image.Info.OS,
+	})
+}
+
+// history lists the entries newest first, as the engine does
+func (s *EngineServer) history(w http.ResponseWriter, ref string) {
+	image, err := s.Fake.lookup(ref)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	entries := []map[string]interface{}{}
+	for i := len(image.History) - 1; i >= 0; i-- {
+		entry := image.History[i]
+		entries = append(entries, map[string]interface{}{
+			"Id":        entry.ID,
+			"CreatedBy": entry.CreatedBy,
+			"Size":      entry.Size,
+			"Comment":   entry.Comment,
+		})
+	}
+	writeJSON(w, entries)
+}
+
+func (s *EngineServer) export(w http.ResponseWriter, ref string) {
+	image, err := s.Fake.lookup(ref)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Write(image.Archive)
+}
+
+// build records the context files and passes the build on to the fake
+func (s *EngineServer) build(w http.ResponseWriter, r *http.Request) {
+	s.BuildFiles = nil
+	tr := tar.NewReader(r.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid build context: "+err.Error())
+			return
+		}
+		s.BuildFiles = append(s.BuildFiles, hdr.Name)
+	}
+
+	query := r.URL.Query()
+	opts := container.BuildOptions{
+		Dockerfile: query.Get("dockerfile"),
+		Tag:        query.Get("t"),
+		Target:     query.Get("target"),
+	}
+	if args := query.Get("buildargs"); args != "" {
+		if err := json.Unmarshal([]byte(args), &opts.BuildArgs); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid buildargs: "+err.Error())
+			return
+		}
+	}
+
+	// Build errors arrive in the progress stream, after a 200 status
+	if s.BuildErrMsg != "" {
+		writeJSON(w, map[string]string{"error": s.BuildErrMsg})
+		return
+	}
+	if err := s.Fake.Build(opts); err != nil {
+		writeJSON(w, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, map[string]string{"stream": "sha256:0000\n"})
+}
+
+// imageName extracts the image reference from an /images/ path
+func imageName(path, suffix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), suffix)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
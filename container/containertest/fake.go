@@ -0,0 +1,108 @@
+package containertest
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+)
+
+// Image is an image known to the fake runtime
+type Image struct {
+	Info    container.ImageInfo
+	History []container.HistoryEntry // Oldest entry first
+	Archive []byte                   // Written by Save, e.g. the bytes of a docker save tarball
+}
+
+// Fake is an in-memory container.Runtime backed by a map of images, so that
+// code depending on a runtime runs without a container engine. Builds are
+// recorded and tag a copy of BuildResult.
+type Fake struct {
+	Images      map[string]*Image
+	BuildResult *Image // Image a successful Build tags, an empty image when nil
+	BuildErr    error  // Returned by Build when set
+	Unavailable bool   // Makes Available report false
+
+	Builds  []container.BuildOptions // Builds requested so far
+	Removed []string                 // Images removed so far
+}
+
+// New returns a fake runtime holding the given images by reference
+func New(images map[string]*Image) *Fake {
+	if images == nil {
+		images = map[string]*Image{}
+	}
+	return &Fake{Images: images}
+}
+
+// Name returns "fake"
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Available reports true unless Unavailable is set
+func (f *Fake) Available() bool {
+	return !f.Unavailable
+}
+
+// InspectImage returns the Info of a known image
+func (f *Fake) InspectImage(ref string) (*container.ImageInfo, error) {
+	image, err := f.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	info := image.Info
+	return &info, nil
+}
+
+// History returns the History of a known image
+func (f *Fake) History(ref string) ([]container.HistoryEntry, error) {
+	image, err := f.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	return append([]container.HistoryEntry(nil), image.History...), nil
+}
+
+// Save writes the Archive of a known image to path
+func (f *Fake) Save(ref, path string) error {
+	image, err := f.lookup(ref)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, image.Archive, 0o644)
+}
+
+// Build records the build and tags BuildResult, or fails with BuildErr
+func (f *Fake) Build(opts container.BuildOptions) error {
+	f.Builds = append(f.Builds, opts)
+	if f.BuildErr != nil {
+		return f.BuildErr
+	}
+
+	result := &Image{}
+	if f.BuildResult != nil {
+		copied := *f.BuildResult
+		result = &copied
+	}
+	f.Images[opts.Tag] = result
+	return nil
+}
+
+// RemoveImage forgets an image and records its removal
+func (f *Fake) RemoveImage(ref string) error {
+	if _, err := f.lookup(ref); err != nil {
+		return err
+	}
+	delete(f.Images, ref)
+	f.Removed = append(f.Removed, ref)
+	return nil
+}
+
+func (f *Fake) lookup(ref string) (*Image, error) {
+	image, ok := f.Images[ref]
+	if !ok {
+		return nil, fmt.Errorf("no such image: %s", ref)
+	}
+	return image, nil
+}
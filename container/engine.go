@@ -0,0 +1,456 @@
+package container
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API versions the engine client speaks. The client asks for the highest
+// version both sides support.
+const (
+	MinAPIVersion = "1.24"
+	MaxAPIVersion = "1.45"
+)
+
+// DefaultDockerHost is the Docker socket used when DOCKER_HOST is not set
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// pingTimeout bounds the request made to check that the engine is up
+const pingTimeout = 3 * time.Second
+
+// Engine is a runtime that talks to the Docker Engine API directly, over a
+// unix socket or TCP, instead of running the docker command line
+type Engine struct {
+	Host       string       // Engine address, DOCKER_HOST or the default socket when empty
+	APIVersion string       // API version to use, negotiated with the engine when empty
+	Client     *http.Client // HTTP client, built for Host when nil
+	BuildKit   Runtime      // Builds Dockerfiles the classic builder rejects, such as RUN --mount
+
+	once    sync.Once
+	fromEnv bool // Host came from the environment, so the other DOCKER_ variables apply
+	baseURL string
+	err     error
+}
+
+// DockerEngine is the Docker Engine API runtime, configured from the
+// environment like the docker command line: DOCKER_HOST, DOCKER_API_VERSION,
+// DOCKER_TLS_VERIFY and DOCKER_CERT_PATH. The other variables are ignored
+// when Host is set explicitly. Dockerfiles that need BuildKit are built with
+// the docker command line, which talks to the same engine.
+var DockerEngine = &Engine{BuildKit: Docker}
+
+// NewEngine returns an engine runtime for a host such as
+// unix:///var/run/docker.sock, tcp://127.0.0.1:2375 or the http:// URL of a
+// test server
+func NewEngine(host string) *Engine {
+	return &Engine{Host: host}
+}
+
+// engineError is the body of an Engine API error response
+type engineError struct {
+	Message string `json:"message"`
+}
+
+// engineHistory is one entry of the image history endpoint
+type engineHistory struct {
+	ID        string `json:"Id"`
+	CreatedBy string `json:"CreatedBy"`
+	Size      int64  `json:"Size"`
+	Comment   string `json:"Comment"`
+}
+
+// buildMessage is one message of the build progress stream
+type buildMessage struct {
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+}
+
+// Name returns "docker-api"
+func (e *Engine) Name() string {
+	return "docker-api"
+}
+
+// Available reports whether the engine answers a ping
+func (e *Engine) Available() bool {
+	if err := e.connect(); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	_, err := e.ping(ctx)
+	return err == nil
+}
+
+// InspectImage reads the image inspect endpoint
+func (e *Engine) InspectImage(ref string) (*ImageInfo, error) {
+	var image cliImage
+	if err := e.getJSON("/images/"+ref+"/json", &image); err != nil {
+		return nil, fmt.Errorf("could not inspect %s: %v", ref, err)
+	}
+	return &ImageInfo{
+		ID:           image.ID,
+		RepoTags:     image.RepoTags,
+		RepoDigests:  image.RepoDigests,
+		Size:         image.Size,
+		Architecture: image.Architecture,
+		OS:           image.OS,
+	}, nil
+}
+
+// History reads the image history endpoint, which lists the newest entry first
+func (e *Engine) History(ref string) ([]HistoryEntry, error) {
+	var history []engineHistory
+	if err := e.getJSON("/images/"+ref+"/history", &history); err != nil {
+		return nil, fmt.Errorf("could not read the history of %s: %v", ref, err)
+	}
+
+	entries := make([]HistoryEntry, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		entries = append(entries, HistoryEntry{
+			ID:        history[i].ID,
+			CreatedBy: history[i].CreatedBy,
+			Size:      history[i].Size,
+			Comment:   history[i].Comment,
+		})
+	}
+	return entries, nil
+}
+
+// Save streams the image export endpoint to path
+func (e *Engine) Save(ref, path string) error {
+	resp, err := e.do(http.MethodGet, "/images/"+ref+"/get", nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("could not export %s: %v", ref, err)
+	}
+	defer resp.Body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return fmt.Errorf("could not export %s: %v", ref, err)
+	}
+	return file.Close()
+}
+
+// Build sends the build context to the build endpoint and waits for the
+// build to finish. The engine builds with its classic builder, so
+// Dockerfiles using BuildKit-only syntax such as RUN --mount or heredocs are
+// passed to the BuildKit runtime instead.
+func (e *Engine) Build(opts BuildOptions) error {
+	if feature := buildKitFeature(opts.Dockerfile); feature != "" {
+		if e.BuildKit != nil && e.BuildKit.Available() {
+			return e.BuildKit.Build(opts)
+		}
+		return fmt.Errorf("could not build %s: %s needs BuildKit, which the Docker engine API does not build with, install the docker command line", opts.Dockerfile, feature)
+	}
+
+	body, dockerfile, err := contextArchive(opts.ContextDir, opts.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("could not build %s: %v", opts.Dockerfile, err)
+	}
+	defer body.Close()
+
+	query := url.Values{}
+	query.Set("t", opts.Tag)
+	query.Set("dockerfile", dockerfile)
+	query.Set("q", "1")
+	query.Set("rm", "1")
+	query.Set("forcerm", "1")
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+	if len(opts.BuildArgs) > 0 {
+		keys := make([]string, 0, len(opts.BuildArgs))
+		for key := range opts.BuildArgs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		args := map[string]string{}
+		for _, key := range keys {
+			args[key] = opts.BuildArgs[key]
+		}
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			return err
+		}
+		query.Set("buildargs", string(encoded))
+	}
+
+	resp, err := e.do(http.MethodPost, "/build", query, body, "application/x-tar")
+	if err != nil {
+		return fmt.Errorf("could not build %s: %v", opts.Dockerfile, err)
+	}
+	defer resp.Body.Close()
+
+	// Build failures are reported in the progress stream of a 200 response
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message buildMessage
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not build %s: %v", opts.Dockerfile, err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("could not build %s: %s", opts.Dockerfile, strings.TrimSpace(message.Error))
+		}
+	}
+}
+
+// RemoveImage deletes an image, even when it is tagged more than once
+func (e *Engine) RemoveImage(ref string) error {
+	query := url.Values{}
+	query.Set("force", "1")
+	resp, err := e.do(http.MethodDelete, "/images/"+ref, query, nil, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// getJSON decodes the response of a GET request
+func (e *Engine) getJSON(path string, v interface{}) error {
+	resp, err := e.do(http.MethodGet, path, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("could not parse the engine response: %v", err)
+	}
+	return nil
+}
+
+// do sends a request to the versioned API path and turns error responses
+// into errors carrying the engine's message
+func (e *Engine) do(method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	if err := e.connect(); err != nil {
+		return nil, err
+	}
+	if err := e.negotiate(); err != nil {
+		return nil, err
+	}
+
+	target := e.baseURL + "/v" + e.APIVersion + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the Docker engine at %s: %v", e.Host, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// negotiate picks the API version: the configured one, DOCKER_API_VERSION,
+// or the lower of MaxAPIVersion and the version the engine reports
+func (e *Engine) negotiate() error {
+	if e.APIVersion != "" {
+		return nil
+	}
+	if version := os.Getenv("DOCKER_API_VERSION"); version != "" && e.fromEnv {
+		e.APIVersion = version
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	server, err := e.ping(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := NegotiateAPIVersion(server)
+	if err != nil {
+		return err
+	}
+	e.APIVersion = version
+	return nil
+}
+
+// NegotiateAPIVersion returns the API version to use with an engine that
+// reports the given version: MaxAPIVersion for newer engines, an engine's own
+// version when it is older, and an error when it is older than MinAPIVersion.
+// Engines that report no version predate negotiation and get MinAPIVersion.
+func NegotiateAPIVersion(server string) (string, error) {
+	if server == "" {
+		return MinAPIVersion, nil
+	}
+	if compareVersions(server, MinAPIVersion) < 0 {
+		return "", fmt.Errorf("Docker engine API version %s is too old, %s or later is required", server, MinAPIVersion)
+	}
+	if compareVersions(server, MaxAPIVersion) > 0 {
+		return MaxAPIVersion, nil
+	}
+	return server, nil
+}
+
+// ping calls the unversioned ping endpoint and returns the API version the
+// engine reports
+func (e *Engine) ping(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+"/_ping", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not reach the Docker engine at %s: %v", e.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", responseError(resp)
+	}
+	return resp.Header.Get("Api-Version"), nil
+}
+
+// connect resolves the host into a base URL and an HTTP client once
+func (e *Engine) connect() error {
+	e.once.Do(func() {
+		if e.Host == "" {
+			e.Host = os.Getenv("DOCKER_HOST")
+			e.fromEnv = true
+		}
+		if e.Host == "" {
+			e.Host = DefaultDockerHost
+		}
+		e.baseURL, e.err = e.dial()
+	})
+	return e.err
+}
+
+// dial returns the base URL for the host, building an HTTP client for it
+// unless one was configured
+func (e *Engine) dial() (string, error) {
+	scheme, address, ok := strings.Cut(e.Host, "://")
+	if !ok {
+		return "", fmt.Errorf("invalid Docker host %q, expected unix://, tcp://, http:// or https://", e.Host)
+	}
+
+	switch scheme {
+	case "unix":
+		if e.Client == nil {
+			transport := &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", address)
+				},
+			}
+			e.Client = &http.Client{Transport: transport}
+		}
+		// The host part is ignored by the socket dialer
+		return "http://docker", nil
+
+	case "tcp", "http", "https":
+		secure := scheme == "https"
+		if scheme == "tcp" && e == DockerEngine && os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			secure = true
+		}
+		if e.Client == nil {
+			e.Client = &http.Client{}
+			if secure {
+				config, err := tlsConfig()
+				if err != nil {
+					return "", err
+				}
+				e.Client.Transport = &http.Transport{TLSClientConfig: config}
+			}
+		}
+		if secure {
+			return "https://" + strings.TrimSuffix(address, "/"), nil
+		}
+		return "http://" + strings.TrimSuffix(address, "/"), nil
+	}
+	return "", fmt.Errorf("unsupported Docker host %q, expected unix://, tcp://, http:// or https://", e.Host)
+}
+
+// tlsConfig loads the client certificate and CA from DOCKER_CERT_PATH, or
+// ~/.docker, as the docker command line does with DOCKER_TLS_VERIFY
+func tlsConfig() (*tls.Config, error) {
+	dir := os.Getenv("DOCKER_CERT_PATH")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the Docker CA certificate: %v", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", filepath.Join(dir, "ca.pem"))
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the Docker client certificate: %v", err)
+	}
+	config.Certificates = []tls.Certificate{cert}
+	return config, nil
+}
+
+// responseError reads the message of an Engine API error response
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var apiErr engineError
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Message != "" {
+		return errors.New(apiErr.Message)
+	}
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, message)
+	}
+	return errors.New(resp.Status)
+}
+
+// compareVersions compares dotted API versions such as "1.41" and "1.9"
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
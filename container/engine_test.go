@@ -0,0 +1,172 @@
+package container_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/container/containertest"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{"", container.MinAPIVersion},
+		{"1.24", "1.24"},
+		{"1.41", "1.41"},
+		{"1.45", "1.45"},
+		{"1.47", container.MaxAPIVersion},
+		{"2.0", container.MaxAPIVersion},
+	}
+	for _, tt := range tests {
+		got, err := container.NegotiateAPIVersion(tt.server)
+		if err != nil || got != tt.want {
+			t.Errorf("NegotiateAPIVersion(%q) = %q, %v, want %q", tt.server, got, err, tt.want)
+		}
+	}
+
+	// 1.9 is older than 1.24, not newer
+	for _, server := range []string{"1.23", "1.9"} {
+		if _, err := container.NegotiateAPIVersion(server); err == nil {
+			t.Errorf("NegotiateAPIVersion(%q) succeeded, want an error", server)
+		}
+	}
+}
+
+func TestEngineUsesNegotiatedVersion(t *testing.T) {
+	fake := containertest.New(map[string]*containertest.Image{"app": {}})
+	for server, want := range map[string]string{"1.41": "/v1.41/", "1.47": "/v1.45/"} {
+		s := containertest.NewEngineServer(fake)
+		s.APIVersion = server
+		if _, err := s.Engine().InspectImage("app"); err != nil {
+			t.Fatal(err)
+		}
+		if last := s.Requests[len(s.Requests)-1]; !strings.Contains(last, want) {
+			t.Errorf("engine reporting %s: requested %q, want %s", server, last, want)
+		}
+		s.Close()
+	}
+}
+
+func TestEngineHistoryOrder(t *testing.T) {
+	history := []container.HistoryEntry{
+		{ID: "<missing>", CreatedBy: "/bin/sh -c #(nop) ADD file:abc in /", Size: 7000000},
+		{ID: "<missing>", CreatedBy: "RUN /bin/sh -c apk add curl", Size: 3000000},
+		{ID: "sha256:123", CreatedBy: "COPY app /app", Size: 1000},
+	}
+	s := containertest.NewEngineServer(containertest.New(map[string]*containertest.Image{"app": {History: history}}))
+	defer s.Close()
+
+	got, err := s.Engine().History("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(history) {
+		t.Fatalf("got %d entries, want %d", len(got), len(history))
+	}
+	for i := range history {
+		if got[i] != history[i] {
+			t.Errorf("entry %d = %+v, want %+v, oldest first", i, got[i], history[i])
+		}
+	}
+}
+
+func TestEngineBuildErrors(t *testing.T) {
+	dir := writeContext(t, "FROM alpine\nRUN exit 1\n")
+
+	s := containertest.NewEngineServer(containertest.New(nil))
+	defer s.Close()
+	s.BuildErrMsg = "The command '/bin/sh -c exit 1' returned a non-zero code: 1\n"
+	err := s.Engine().Build(container.BuildOptions{Dockerfile: filepath.Join(dir, "Dockerfile"), ContextDir: dir, Tag: "app"})
+	if err == nil || !strings.HasSuffix(err.Error(), "returned a non-zero code: 1") {
+		t.Errorf("Build with an error in the progress stream: got %v", err)
+	}
+
+	s.BuildErrMsg = ""
+	s.Fake.BuildErr = errors.New("no space left on device")
+	err = s.Engine().Build(container.BuildOptions{Dockerfile: filepath.Join(dir, "Dockerfile"), ContextDir: dir, Tag: "app"})
+	if err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		t.Errorf("Build failing in the engine: got %v", err)
+	}
+}
+
+func TestEngineErrorResponses(t *testing.T) {
+	s := containertest.NewEngineServer(containertest.New(nil))
+	defer s.Close()
+	if _, err := s.Engine().InspectImage("missing"); err == nil || err.Error() != "could not inspect missing: no such image: missing" {
+		t.Errorf("InspectImage of a missing image: got %v, want the engine's message", err)
+	}
+
+	bodies := map[string]string{
+		"boom\n": "could not inspect app: 500 Internal Server Error: boom",
+		"":       "could not inspect app: 500 Internal Server Error",
+	}
+	for body, want := range bodies {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/_ping" {
+				w.Header().Set("Api-Version", "1.43")
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, body)
+		}))
+		_, err := container.NewEngine(server.URL).InspectImage("app")
+		if err == nil || err.Error() != want {
+			t.Errorf("InspectImage with body %q: got %v, want %s", body, err, want)
+		}
+		server.Close()
+	}
+}
+
+func TestEngineBuildKitFallback(t *testing.T) {
+	tests := []struct {
+		dockerfile string
+		buildKit   bool
+	}{
+		{"FROM alpine\nCOPY --from=build --chown=app /app /app\n", false},
+		{"FROM alpine\nRUN --mount=type=cache,target=/var/cache/apk apk add curl\n", true},
+		{"FROM alpine\nCOPY --link app /app\n", true},
+		{"FROM alpine\nRUN <<EOF\napk add curl\nEOF\n", true},
+		{"# syntax=docker/dockerfile:1\nFROM alpine\n", true},
+	}
+	for _, tt := range tests {
+		dir := writeContext(t, tt.dockerfile)
+		opts := container.BuildOptions{Dockerfile: filepath.Join(dir, "Dockerfile"), ContextDir: dir, Tag: "app"}
+
+		s := containertest.NewEngineServer(containertest.New(nil))
+		fallback := containertest.New(nil)
+		engine := s.Engine()
+		engine.BuildKit = fallback
+		if err := engine.Build(opts); err != nil {
+			t.Errorf("Build(%q): %v", tt.dockerfile, err)
+		}
+		if len(fallback.Builds) != 0 != tt.buildKit || len(s.Fake.Builds) != 0 == tt.buildKit {
+			t.Errorf("Build(%q) built %d times with BuildKit and %d times with the engine, want BuildKit %v", tt.dockerfile, len(fallback.Builds), len(s.Fake.Builds), tt.buildKit)
+		}
+
+		if tt.buildKit {
+			fallback.Unavailable = true
+			if err := engine.Build(opts); err == nil || !strings.Contains(err.Error(), "needs BuildKit") {
+				t.Errorf("Build(%q) without BuildKit: got %v, want an error naming BuildKit", tt.dockerfile, err)
+			}
+		}
+		s.Close()
+	}
+}
+
+// writeContext creates a build context holding a Dockerfile
+func writeContext(t *testing.T, dockerfile string) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
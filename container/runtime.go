@@ -0,0 +1,108 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Runtime is a container engine able to build, inspect and export images
+type Runtime interface {
+	// Name returns the name used with --runtime, such as "docker"
+	Name() string
+
+	// Available reports whether the runtime can be used on this machine
+	Available() bool
+
+	// InspectImage returns the metadata of a local image
+	InspectImage(ref string) (*ImageInfo, error)
+
+	// History returns the history of a local image, oldest entry first
+	History(ref string) ([]HistoryEntry, error)
+
+	// Save exports a local image as a docker save archive
+	Save(ref, path string) error
+
+	// Build builds a Dockerfile into a tagged local image
+	Build(opts BuildOptions) error
+
+	// RemoveImage deletes a local image
+	RemoveImage(ref string) error
+}
+
+// ImageInfo is the metadata of a local image
+type ImageInfo struct {
+	ID           string
+	RepoTags     []string
+	RepoDigests  []string // name@digest references recorded when the image was pulled or pushed
+	Size         int64    // Bytes of all layers
+	Architecture string
+	OS           string
+}
+
+// HistoryEntry is one step of an image history
+type HistoryEntry struct {
+	ID        string // Layer or image ID, "<missing>" for base image entries
+	CreatedBy string
+	Size      int64 // Bytes the step added, -1 when unknown
+	Comment   string
+}
+
+// BuildOptions describes one image build
+type BuildOptions struct {
+	Dockerfile string
+	ContextDir string
+	Tag        string
+	Target     string            // Stage to build, the final stage when empty
+	BuildArgs  map[string]string // Values for --build-arg
+}
+
+// Runtimes lists the supported runtimes in the order they are detected. The
+// Docker Engine API comes first, so the docker command line is only run when
+// the engine is not reachable through DOCKER_HOST or the default socket, or
+// to build Dockerfiles that need BuildKit.
+var Runtimes = []Runtime{DockerEngine, Docker, Podman, Nerdctl}
+
+// Lookup returns the runtime with the given name
+func Lookup(name string) (Runtime, error) {
+	for _, runtime := range Runtimes {
+		if runtime.Name() == name {
+			return runtime, nil
+		}
+	}
+	var names []string
+	for _, runtime := range Runtimes {
+		names = append(names, runtime.Name())
+	}
+	return nil, fmt.Errorf("unknown runtime %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// Detect returns the first available runtime, or nil when none is installed
+func Detect() Runtime {
+	for _, runtime := range Runtimes {
+		if runtime.Available() {
+			return runtime
+		}
+	}
+	return nil
+}
+
+// Select returns the runtime named by --runtime, or detects one for "auto"
+// or an empty name. It fails when the runtime is not available.
+func Select(name string) (Runtime, error) {
+	if name == "" || name == "auto" {
+		runtime := Detect()
+		if runtime == nil {
+			return nil, fmt.Errorf("no container runtime found, install docker, podman or nerdctl")
+		}
+		return runtime, nil
+	}
+
+	runtime, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if !runtime.Available() {
+		return nil, fmt.Errorf("runtime %s is not available", name)
+	}
+	return runtime, nil
+}
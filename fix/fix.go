@@ -0,0 +1,109 @@
+package fix
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// Change describes one mechanical edit made to the Dockerfile
+type Change struct {
+	RuleID      string // Rule whose finding the change resolves
+	Line        int    // First line of the instruction that was edited
+	Description string
+}
+
+// DigestResolver looks up the digest an image tag currently points to
+type DigestResolver interface {
+	Resolve(image string) (string, error)
+}
+
+// Options controls which fixes are applied
+type Options struct {
+	// Resolver pins floating tags to digests; without one :latest is left alone
+	Resolver DigestResolver
+
+	// Allow decides whether a rule may be fixed at an instruction line, so
+	// that disabled rules and suppressed findings are left untouched
+	Allow func(ruleID string, line int) bool
+}
+
+// fixer edits the lines of one instruction. lines holds the physical lines of
+// the whole file without line endings, indexed from 0.
+type fixer func(dockerfile *parser.Dockerfile, inst parser.Instruction, lines []string, opts Options) []Change
+
+// fixers lists every fixer, applied in order to each instruction
+var fixers = []fixer{
+	fixAddToCopy,
+	fixApkNoCache,
+	fixAptListsCleanup,
+	fixLatestTag,
+}
+
+// Apply rewrites the source of a parsed Dockerfile, fixing the mechanical
+// findings. Lines that no fix touches are returned byte for byte.
+func Apply(dockerfile *parser.Dockerfile, source []byte, opts Options) ([]byte, []Change) {
+	lines, newline := sourceLines(source)
+
+	if opts.Allow == nil {
+		opts.Allow = func(string, int) bool { return true }
+	}
+
+	var changes []Change
+	for _, inst := range dockerfile.Instructions {
+		if inst.Line < 1 || inst.EndLine > len(lines) {
+			continue
+		}
+		for _, fix := range fixers {
+			changes = append(changes, fix(dockerfile, inst, lines, opts)...)
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Line < changes[j].Line
+	})
+
+	return joinLines(lines, newline), changes
+}
+
+// sourceLines splits a Dockerfile into its physical lines and returns the
+// line ending it uses
+func sourceLines(source []byte) ([]string, string) {
+	text := string(source)
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), newline
+}
+
+// joinLines joins lines edited by the fixers with the original line ending.
+// Appended lines are stored with "\n" inside a single element.
+func joinLines(lines []string, newline string) []byte {
+	fixed := strings.Join(lines, "\n")
+	if newline != "\n" {
+		fixed = strings.ReplaceAll(fixed, "\n", newline)
+	}
+	return []byte(fixed)
+}
+
+// instructionLines returns the indexes of the physical lines of an
+// instruction, excluding comment and empty lines inside continuations and
+// heredoc bodies
+func instructionLines(inst parser.Instruction, lines []string) []int {
+	end := inst.EndLine
+	if len(inst.Heredocs) > 0 {
+		end = inst.Heredocs[0].StartLine - 1
+	}
+
+	var indexes []int
+	for i := inst.Line - 1; i < end && i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if i > inst.Line-1 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
@@ -0,0 +1,43 @@
+package fix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+func TestFixAptListsCleanupDryRun(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"backslash",
+			"FROM debian:12\nRUN apt-get update \\\n    && apt-get install -y curl\n",
+			"--- Dockerfile\n+++ Dockerfile\n@@ -1,3 +1,4 @@\n FROM debian:12\n RUN apt-get update \\\n-    && apt-get install -y curl\n+    && apt-get install -y curl \\\n+    && rm -rf /var/lib/apt/lists/*\n"},
+		{"backtick",
+			"# escape=`\nFROM debian:12\nRUN apt-get update `\n    && apt-get install -y curl\n",
+			"--- Dockerfile\n+++ Dockerfile\n@@ -1,4 +1,5 @@\n # escape=`\n FROM debian:12\n RUN apt-get update `\n-    && apt-get install -y curl\n+    && apt-get install -y curl `\n+    && rm -rf /var/lib/apt/lists/*\n"},
+	}
+	for _, tt := range tests {
+		dockerfile, err := parser.Parse(strings.NewReader(tt.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixed, changes := Apply(dockerfile, []byte(tt.source), Options{})
+		if len(changes) != 1 || changes[0].RuleID != "DS009" {
+			t.Errorf("%s: got changes %+v, want the DS009 fix", tt.name, changes)
+		}
+		if got := UnifiedDiff("Dockerfile", "Dockerfile", []byte(tt.source), fixed); got != tt.want {
+			t.Errorf("%s: got diff\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+
+		// The fixed Dockerfile parses back into one RUN that cleans up
+		reparsed, err := parser.Parse(strings.NewReader(string(fixed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runs := reparsed.GetInstructionsByType("RUN"); len(runs) != 1 || !strings.HasSuffix(runs[0].Script(), "rm -rf /var/lib/apt/lists/*") {
+			t.Errorf("%s: fixed Dockerfile has RUN instructions %+v, want one ending with the cleanup", tt.name, runs)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package fix
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+var (
+	addKeywordRegex = regexp.MustCompile(`^(\s*)((?i:add))(\s)`)
+	apkAddRegex     = regexp.MustCompile(`\bapk((?:\s+-[-\w]+)*)\s+add\b`)
+	fromImageRegex  = regexp.MustCompile(`^(\s*(?i:from)\s+(?:--\S+\s+)*)(\S+)`)
+)
+
+// archiveSuffixes are the local sources ADD extracts, which COPY would not
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".tar.zst"}
+
+// fixAddToCopy replaces ADD with COPY when every source is a plain local file
+func fixAddToCopy(dockerfile *parser.Dockerfile, inst parser.Instruction, lines []string, opts Options) []Change {
+	if inst.Command != "ADD" || !opts.Allow("DS006", inst.Line) {
+		return nil
+	}
+	if inst.HasFlag("checksum") || inst.HasFlag("keep-git-dir") || len(inst.Heredocs) > 0 {
+		return nil
+	}
+	for _, source := range inst.Sources() {
+		if parser.IsURL(source) || parser.IsGitSource(source) || isArchive(source) || strings.Contains(source, "$") {
+			return nil
+		}
+	}
+
+	index := inst.Line - 1
+	match := addKeywordRegex.FindStringSubmatch(lines[index])
+	if match == nil {
+		return nil
+	}
+
+	// Keep the case the Dockerfile uses for its keywords
+	keyword := "COPY"
+	if match[2] == strings.ToLower(match[2]) {
+		keyword = "copy"
+	}
+	lines[index] = match[1] + keyword + match[3] + lines[index][len(match[0]):]
+
+	return []Change{{
+		RuleID:      "DS006",
+		Line:        inst.Line,
+		Description: "replaced ADD with COPY for local files",
+	}}
+}
+
+// isArchive reports whether ADD would extract a local source
+func isArchive(source string) bool {
+	lower := strings.ToLower(source)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixApkNoCache adds --no-cache to every apk add that keeps the cache
+func fixApkNoCache(dockerfile *parser.Dockerfile, inst parser.Instruction, lines []string, opts Options) []Change {
+	if inst.Command != "RUN" || inst.ExecForm || !opts.Allow("DS009", inst.Line) {
+		return nil
+	}
+	if countApkAddWithCache(inst.Shell) == 0 {
+		return nil
+	}
+
+	edited := false
+	for _, index := range instructionLines(inst, lines) {
+		line := lines[index]
+		matches := apkAddRegex.FindAllStringSubmatchIndex(line, -1)
+		for i := len(matches) - 1; i >= 0; i-- {
+			end := matches[i][1]
+			options := line[matches[i][2]:matches[i][3]]
+			if strings.Contains(options, "--no-cache") || hasNoCacheAfter(line[end:]) {
+				continue
+			}
+			line = line[:end] + " --no-cache" + line[end:]
+			edited = true
+		}
+		lines[index] = line
+	}
+
+	if !edited {
+		return nil
+	}
+	return []Change{{
+		RuleID:      "DS009",
+		Line:        inst.Line,
+		Description: "added --no-cache to apk add",
+	}}
+}
+
+// countApkAddWithCache counts the apk add commands without --no-cache
+func countApkAddWithCache(script *shell.Script) int {
+	count := 0
+	shell.Walk(script, func(cmd *shell.SimpleCommand) {
+		if cmd.EffectiveName() == "apk" && subcommand(cmd.Effective()) == "add" && !cmd.HasFlag("--no-cache") {
+			count++
+		}
+	})
+	return count
+}
+
+// hasNoCacheAfter reports whether --no-cache follows apk add in the same command
+func hasNoCacheAfter(rest string) bool {
+	for _, sep := range []string{"&&", "||", ";", "|", "\\"} {
+		if i := strings.Index(rest, sep); i >= 0 {
+			rest = rest[:i]
+		}
+	}
+	return strings.Contains(rest, "--no-cache")
+}
+
+// fixAptListsCleanup appends removal of the apt lists to a RUN that installs
+// apt packages without cleaning up
+func fixAptListsCleanup(dockerfile *parser.Dockerfile, inst parser.Instruction, lines []string, opts Options) []Change {
+	if inst.Command != "RUN" || inst.ExecForm || len(inst.Heredocs) > 0 || !opts.Allow("DS009", inst.Line) {
+		return nil
+	}
+	if checks.PackageCacheLeft(inst) != "apt" {
+		return nil
+	}
+
+	indexes := instructionLines(inst, lines)
+	last := indexes[len(indexes)-1]
+
+	// A trailing shell comment would swallow the appended command
+	if strings.Contains(lines[last], "#") {
+		return nil
+	}
+
+	indent := "    "
+	if len(indexes) > 1 {
+		continued := lines[indexes[1]]
+		indent = continued[:len(continued)-len(strings.TrimLeft(continued, " \t"))]
+	}
+
+	lines[last] = strings.TrimRight(lines[last], " \t") + " " + string(dockerfile.Escape) + "\n" + indent + "&& rm -rf /var/lib/apt/lists/*"
+
+	return []Change{{
+		RuleID:      "DS009",
+		Line:        inst.Line,
+		Description: "removed the apt lists in the same RUN",
+	}}
+}
+
+// fixLatestTag pins a FROM image that uses :latest, or no tag, to its digest
+func fixLatestTag(dockerfile *parser.Dockerfile, inst parser.Instruction, lines []string, opts Options) []Change {
+	if inst.Command != "FROM" || opts.Resolver == nil || len(inst.Args) == 0 || !opts.Allow("DS003", inst.Line) {
+		return nil
+	}
+
+	image := inst.Args[0]
+	if !checks.UsesFloatingTag(image) || dockerfile.StageByName(image) != nil {
+		return nil
+	}
+
+	index := inst.Line - 1
+	match := fromImageRegex.FindStringSubmatch(lines[index])
+	if match == nil || match[2] != image {
+		// The image is built from ARG values or spread over several lines
+		return nil
+	}
+
+	digest, err := opts.Resolver.Resolve(image)
+	if err != nil || digest == "" {
+		return nil
+	}
+
+	lines[index] = match[1] + image + "@" + digest + lines[index][len(match[0]):]
+
+	return []Change{{
+		RuleID:      "DS003",
+		Line:        inst.Line,
+		Description: fmt.Sprintf("pinned %s to %s", image, digest),
+	}}
+}
+
+// subcommand returns the first non-option argument after the command name
+func subcommand(argv []string) string {
+	for _, arg := range argv[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
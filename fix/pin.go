@@ -0,0 +1,190 @@
+package fix
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// argReferenceRegex matches a FROM image given entirely by one ARG
+var argReferenceRegex = regexp.MustCompile(`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)\})$`)
+
+// Pin is the outcome of pinning the image of one FROM instruction
+type Pin struct {
+	Line    int    // Line of the FROM instruction
+	Image   string // Image the FROM names, with ARG values substituted
+	Pinned  string // Reference written to the Dockerfile, empty when skipped
+	Arg     string // Global ARG whose default was rewritten, for FROM $ARG
+	Skipped string // Why the image was left alone
+}
+
+// PinDigests rewrites the image of every FROM that has no digest as
+// image:tag@sha256:..., with digests looked up by the resolver. A FROM that
+// names its image with a single global ARG, such as FROM ${BASE}, is pinned
+// by rewriting the default value of that ARG. Images assembled from ARG
+// values, such as node:${NODE_VERSION}-alpine, are reported as skipped: a
+// digest would win over the tag, so overriding the ARG with --build-arg
+// would silently build the pinned image. Stages, scratch and images that
+// already have a digest are not reported. Lines that are not rewritten are
+// returned byte for byte.
+func PinDigests(dockerfile *parser.Dockerfile, source []byte, resolver DigestResolver) ([]byte, []Pin) {
+	lines, newline := sourceLines(source)
+
+	// A digest in the default of an ARG would end up in the middle of the
+	// images assembled from it, so those ARGs are left alone
+	assembledArgs := map[string]int{}
+	for _, inst := range dockerfile.Instructions {
+		if inst.Command != "FROM" || len(inst.Args) == 0 || skipImage(dockerfile, inst.Args[0]) {
+			continue
+		}
+		if raw := inst.RawImage(); strings.Contains(raw, "$") {
+			if _, ok := argReference(raw); !ok {
+				for _, name := range parser.Variables(raw) {
+					assembledArgs[name] = inst.Line
+				}
+			}
+		}
+	}
+
+	var pins []Pin
+	argPins := map[string]Pin{}
+	for _, inst := range dockerfile.Instructions {
+		if inst.Command != "FROM" || len(inst.Args) == 0 || skipImage(dockerfile, inst.Args[0]) {
+			continue
+		}
+		pin := Pin{Line: inst.Line, Image: inst.Args[0]}
+		raw := inst.RawImage()
+
+		switch {
+		case !strings.Contains(raw, "$"):
+			pin = pinLiteral(inst, raw, lines, resolver, pin)
+		default:
+			name, ok := argReference(raw)
+			if !ok {
+				names := parser.Variables(raw)
+				pin.Skipped = fmt.Sprintf("the image %s is assembled from ARG %s, and with a digest --build-arg overrides would silently build the pinned image; declare the whole reference in one ARG to pin it", raw, strings.Join(names, ", "))
+				break
+			}
+			if line, ok := assembledArgs[name]; ok {
+				pin.Arg = name
+				pin.Skipped = fmt.Sprintf("ARG %s is also part of the image at line %d, which a digest in its default would break", name, line)
+				break
+			}
+			if previous, done := argPins[name]; done {
+				pin.Pinned, pin.Arg, pin.Skipped = previous.Pinned, name, previous.Skipped
+				break
+			}
+			pin = pinArg(dockerfile, name, lines, resolver, pin)
+			argPins[name] = pin
+		}
+		pins = append(pins, pin)
+	}
+
+	return joinLines(lines, newline), pins
+}
+
+// skipImage reports whether a FROM image is left alone without a report:
+// scratch, a stage or an image that already has a digest
+func skipImage(dockerfile *parser.Dockerfile, image string) bool {
+	return image == "scratch" || dockerfile.StageByName(image) != nil || strings.Contains(image, "@")
+}
+
+// pinLiteral rewrites an image written out on the FROM line
+func pinLiteral(inst parser.Instruction, raw string, lines []string, resolver DigestResolver, pin Pin) Pin {
+	index := inst.Line - 1
+	match := fromImageRegex.FindStringSubmatch(lines[index])
+	if match == nil || match[2] != raw {
+		pin.Skipped = "the FROM instruction spans several lines"
+		return pin
+	}
+
+	digest, err := resolver.Resolve(pin.Image)
+	if err != nil {
+		pin.Skipped = err.Error()
+		return pin
+	}
+	pin.Pinned = withDigest(pin.Image, digest)
+	lines[index] = match[1] + pin.Pinned + lines[index][len(match[0]):]
+	return pin
+}
+
+// pinArg rewrites the default value of the global ARG a FROM is named by
+func pinArg(dockerfile *parser.Dockerfile, name string, lines []string, resolver DigestResolver, pin Pin) Pin {
+	pin.Arg = name
+	inst, value := globalArg(dockerfile, name)
+	if inst == nil {
+		pin.Skipped = fmt.Sprintf("ARG %s has no default value before the first FROM", name)
+		return pin
+	}
+
+	valueRegex := regexp.MustCompile(`(^|\s)` + regexp.QuoteMeta(name) + `=("([^"$]*)"|'([^'$]*)'|([^\s"'$]+))`)
+	for _, index := range instructionLines(*inst, lines) {
+		match := valueRegex.FindStringSubmatchIndex(lines[index])
+		if match == nil {
+			continue
+		}
+		digest, err := resolver.Resolve(value)
+		if err != nil {
+			pin.Skipped = err.Error()
+			return pin
+		}
+		pin.Pinned = withDigest(value, digest)
+
+		// Keep the quotes around the value, if any
+		start, end := match[4], match[5]
+		for group := 6; group <= 10; group += 2 {
+			if match[group] >= 0 {
+				start, end = match[group], match[group+1]
+			}
+		}
+		lines[index] = lines[index][:start] + pin.Pinned + lines[index][end:]
+		return pin
+	}
+
+	pin.Skipped = fmt.Sprintf("the default value of ARG %s at line %d is built from other variables", name, inst.Line)
+	return pin
+}
+
+// globalArg returns the last ARG before the first FROM that gives name a
+// default value, with that value
+func globalArg(dockerfile *parser.Dockerfile, name string) (*parser.Instruction, string) {
+	var found *parser.Instruction
+	var value string
+	for i, inst := range dockerfile.Instructions {
+		if inst.Command == "FROM" {
+			break
+		}
+		if inst.Command != "ARG" {
+			continue
+		}
+		for _, arg := range inst.Args {
+			if key, v, ok := strings.Cut(arg, "="); ok && key == name {
+				found, value = &dockerfile.Instructions[i], v
+			}
+		}
+	}
+	return found, value
+}
+
+// argReference returns the ARG name of an image given as $NAME or ${NAME}
+func argReference(raw string) (string, bool) {
+	match := argReferenceRegex.FindStringSubmatch(raw)
+	if match == nil {
+		return "", false
+	}
+	return match[1] + match[2], true
+}
+
+// withDigest appends a digest to an image, naming the implicit latest tag
+func withDigest(image, digest string) string {
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i:]
+	}
+	if !strings.Contains(name, ":") {
+		image += ":latest"
+	}
+	return image + "@" + digest
+}
@@ -0,0 +1,80 @@
+package fix
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// digests resolves the images it holds
+type digests map[string]string
+
+func (d digests) Resolve(image string) (string, error) {
+	if digest, ok := d[image]; ok {
+		return digest, nil
+	}
+	return "", fmt.Errorf("%s not found", image)
+}
+
+func TestPinDigests(t *testing.T) {
+	resolver := digests{
+		"alpine:3.19":    "sha256:a1",
+		"node:18-alpine": "sha256:b2",
+		"ubuntu":         "sha256:c3",
+		"python:3.12":    "sha256:d4",
+	}
+	tests := []struct {
+		name, source, want string
+	}{
+		{"literal", "FROM alpine:3.19 AS base\n", "FROM alpine:3.19@sha256:a1 AS base\n"},
+		{"implicit latest", "FROM ubuntu\n", "FROM ubuntu:latest@sha256:c3\n"},
+		{"single ARG", "ARG BASE=python:3.12\nFROM ${BASE}\n", "ARG BASE=python:3.12@sha256:d4\nFROM ${BASE}\n"},
+		{"platform", "FROM --platform=$BUILDPLATFORM alpine:3.19 AS build\n", "FROM --platform=$BUILDPLATFORM alpine:3.19@sha256:a1 AS build\n"},
+	}
+	for _, tt := range tests {
+		dockerfile, err := parser.Parse(strings.NewReader(tt.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, pins := PinDigests(dockerfile, []byte(tt.source), resolver)
+		if string(got) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		for _, pin := range pins {
+			if pin.Skipped != "" {
+				t.Errorf("%s: line %d skipped: %s", tt.name, pin.Line, pin.Skipped)
+			}
+		}
+	}
+}
+
+func TestPinDigestsSkipsAssembledImages(t *testing.T) {
+	tests := []struct {
+		source, skipped string
+	}{
+		{"ARG NODE_VERSION=18\nFROM node:${NODE_VERSION}-alpine\n",
+			"the image node:${NODE_VERSION}-alpine is assembled from ARG NODE_VERSION, and with a digest --build-arg overrides would silently build the pinned image; declare the whole reference in one ARG to pin it"},
+		{"ARG BASE=node:18\nFROM ${BASE}\nFROM ${BASE}-alpine\n",
+			"ARG BASE is also part of the image at line 3, which a digest in its default would break"},
+	}
+	for _, tt := range tests {
+		dockerfile, err := parser.Parse(strings.NewReader(tt.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, pins := PinDigests(dockerfile, []byte(tt.source), digests{"node:18": "sha256:f6", "node:18-alpine": "sha256:b2"})
+		if string(got) != tt.source {
+			t.Errorf("got\n%s\nwant the source unchanged", got)
+		}
+		for _, pin := range pins {
+			if pin.Skipped == "" {
+				t.Errorf("line %d of %q was pinned to %s, want it skipped", pin.Line, tt.source, pin.Pinned)
+			}
+		}
+		if len(pins) == 0 || pins[0].Skipped != tt.skipped {
+			t.Errorf("got pins %+v, want the first skipped with %q", pins, tt.skipped)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package fix
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// RuntimeResolver resolves digests from images already pulled into a local
+// container runtime, using the repository digests recorded by the pull
+type RuntimeResolver struct {
+	Runtime container.Runtime
+}
+
+// Resolve returns the digest of a locally available image
+func (r RuntimeResolver) Resolve(image string) (string, error) {
+	info, err := r.Runtime.InspectImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	for _, repoDigest := range info.RepoDigests {
+		if _, digest, ok := strings.Cut(repoDigest, "@"); ok {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("no repository digest for %s", image)
+}
+
+// RegistryResolver resolves digests by asking the image's registry, so the
+// image does not have to be pulled
+type RegistryResolver struct {
+	Client *registry.Client
+}
+
+// Resolve returns the digest the tag currently points to in its registry
+func (r RegistryResolver) Resolve(image string) (string, error) {
+	return r.Client.Digest(image)
+}
+
+// Resolvers tries each resolver in turn and returns the first digest found
+type Resolvers []DigestResolver
+
+// Resolve returns the first digest found, or the errors of every resolver
+func (r Resolvers) Resolve(image string) (string, error) {
+	var messages []string
+	for _, resolver := range r {
+		digest, err := resolver.Resolve(image)
+		if err == nil && digest != "" {
+			return digest, nil
+		}
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	if len(messages) == 0 {
+		return "", fmt.Errorf("no digest found for %s", image)
+	}
+	return "", errors.New(strings.Join(messages, "; "))
+}
@@ -2,7 +2,10 @@ module github.com/avirooppal/dock-slimscheck
 
 go 1.21
 
-require github.com/fatih/color v1.18.0
+require (
+	github.com/fatih/color v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
@@ -3,14 +3,27 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/build"
+	"github.com/avirooppal/dock-slimscheck/catalog"
 	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/config"
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/fix"
 	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/registry"
+	"github.com/avirooppal/dock-slimscheck/report"
 	"github.com/avirooppal/dock-slimscheck/security"
+	"github.com/avirooppal/dock-slimscheck/utils"
+	"github.com/avirooppal/dock-slimscheck/vuln"
 )
 
 // Version information
@@ -18,24 +31,80 @@ const (
 	Version = "1.0.0"
 )
 
+// Exit codes
+const (
+	exitClean          = 0 // No findings above info severity
+	exitBelowThreshold = 1 // Findings, all below the --fail-on threshold
+	exitFailed         = 2 // Findings at or above the --fail-on threshold
+	exitError          = 3 // The check could not be completed
+)
+
 func main() {
+	// Subcommands come before the flags of the check
+	if len(os.Args) > 1 && os.Args[1] == "pin" {
+		os.Exit(runPin(os.Args[2:]))
+	}
+
 	// Define command line flags
 	securityFlag := flag.Bool("security", false, "Enable additional security checks")
 	versionFlag := flag.Bool("version", false, "Display version information")
-	flag.Parse()
+	listRulesFlag := flag.Bool("list-rules", false, "List all available rules and exit")
+	formatFlag := flag.String("format", "text", "Output format: "+strings.Join(report.Formats, ", "))
+	failOnFlag := flag.String("fail-on", "", "Minimum severity that fails the check: low, medium, high or critical (default low)")
+	fixFlag := flag.Bool("fix", false, "Rewrite the Dockerfile in place, fixing mechanical issues")
+	dryRunFlag := flag.Bool("dry-run", false, "With --fix, print a unified diff instead of writing the file")
+	imageArchiveFlag := flag.String("image-archive", "", "Analyze the layers of a docker save tarball instead of the base image")
+	ociLayoutFlag := flag.String("oci-layout", "", "Analyze the layers of an OCI image layout directory instead of the base image")
+	buildFlag := flag.Bool("build", false, "Build the Dockerfile with docker under a temporary tag and analyze the resulting image")
+	compareFlag := flag.String("compare", "", "Also build this Dockerfile and report the size change per stage and layer (implies --build)")
+	runtimeFlag := flag.String("runtime", "auto", "Container runtime for layer history, --build and --fix: auto, docker-api, docker, podman or nerdctl")
+	remoteFlag := flag.Bool("remote", false, "Read the base image size, layers and platforms from its registry without pulling it")
+	lifecycleFlag := flag.String("lifecycle", "", "JSON file with newer end-of-life dates for DS013, applied over the embedded data")
+	advisoriesFlag := flag.String("advisories", "", "Directory of OSV advisories to match the installed packages against (enables DS109)")
+	fetchChecksumsFlag := flag.Bool("fetch-checksums", false, "Download the files ADD fetches without --checksum and put their digest in the fix (enables DS102)")
+	configFlag := flag.String("config", "", "Path to a .slimcheck.yaml file (default: searched from the Dockerfile directory upward)")
+	buildArgs := buildArgsFlag{}
+	flag.Var(buildArgs, "build-arg", "Set a build-time variable (KEY=VALUE), may be repeated")
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		os.Exit(exitError)
+	}
 
 	// Handle version flag
 	if *versionFlag {
 		fmt.Printf("dock-slimcheck version %s\n", Version)
+		fmt.Printf("base image catalog %s\n", catalog.Default().Version)
+		fmt.Printf("lifecycle data %s\n", catalog.DefaultLifecycle().Version)
 		return
 	}
 
+	// Handle list-rules flag
+	if *listRulesFlag {
+		printRules()
+		return
+	}
+
+	// Progress and errors go to stderr when stdout carries a report
+	format := *formatFlag
+	if !validFormat(format) {
+		fmt.Printf("Error: unknown format %q, expected one of: %s\n", format, strings.Join(report.Formats, ", "))
+		os.Exit(exitError)
+	}
+	logOut := os.Stdout
+	if format != "text" {
+		logOut = os.Stderr
+	}
+
 	// Check if Dockerfile path is provided
 	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Println("Error: No Dockerfile specified")
-		fmt.Println("Usage: dock-slimcheck ./Dockerfile [--security]")
-		os.Exit(1)
+		fmt.Fprintln(logOut, "Error: No Dockerfile specified")
+		fmt.Fprintln(logOut, "Usage: dock-slimcheck [--security] [--format FORMAT] [--fail-on SEVERITY] [--fix [--dry-run]] [--build-arg KEY=VALUE] [--image-archive FILE | --oci-layout DIR | --build [--compare FILE]] [--advisories DIR] [--fetch-checksums] [--config FILE] [--list-rules] ./Dockerfile")
+		fmt.Fprintln(logOut, "       dock-slimcheck pin [--dry-run] [--source auto|runtime|registry] ./Dockerfile")
+		os.Exit(exitError)
 	}
 
 	dockerfilePath := args[0]
@@ -43,51 +112,364 @@ func main() {
 	// Check if the Dockerfile exists
 	_, err := os.Stat(dockerfilePath)
 	if os.IsNotExist(err) {
-		fmt.Printf("Error: Dockerfile not found at %s\n", dockerfilePath)
-		os.Exit(1)
+		fmt.Fprintf(logOut, "Error: Dockerfile not found at %s\n", dockerfilePath)
+		os.Exit(exitError)
 	}
 
 	// Parse the Dockerfile
-	fmt.Printf("[INFO] Checking Dockerfile: %s\n\n", dockerfilePath)
-	dockerfile, err := parser.ParseDockerfile(dockerfilePath)
+	fmt.Fprintf(logOut, "[INFO] Checking Dockerfile: %s\n\n", dockerfilePath)
+	dockerfile, err := parser.ParseDockerfileWithOptions(dockerfilePath, parser.Options{
+		BuildArgs: buildArgs,
+	})
 	if err != nil {
-		fmt.Printf("Error parsing Dockerfile: %s\n", err)
-		os.Exit(1)
+		fmt.Fprintf(logOut, "Error parsing Dockerfile: %s\n", err)
+		os.Exit(exitError)
 	}
 
 	// Determine the directory of the Dockerfile for contextual checks
 	dockerfileDir := filepath.Dir(dockerfilePath)
 
-	// Run checks and collect issues
-	var issues []checks.Issue
+	// Load the project configuration
+	cfg, err := loadConfig(*configFlag, dockerfileDir)
+	if err != nil {
+		fmt.Fprintf(logOut, "Error: %s\n", err)
+		os.Exit(exitError)
+	}
+	if cfg.Path != "" {
+		fmt.Fprintf(logOut, "[INFO] Using config: %s\n", cfg.Path)
+	}
 
-	// Base image checks
-	baseImageIssues := checks.CheckBaseImage(dockerfile)
-	issues = append(issues, baseImageIssues...)
+	// The --fail-on flag wins over the configured threshold
+	failOn := cfg.FailOn
+	if *failOnFlag != "" {
+		failOn = *failOnFlag
+	}
+	threshold := checks.SeverityLow
+	if failOn != "" {
+		threshold, err = checks.ParseThreshold(failOn)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: --fail-on: %s\n", err)
+			os.Exit(exitError)
+		}
+	}
 
-	// Best practices checks
-	practiceIssues := checks.CheckBestPractices(dockerfile, dockerfileDir)
-	issues = append(issues, practiceIssues...)
+	// Pick the container runtime. Without one, features that need it are
+	// skipped unless a runtime was asked for by name.
+	runtime, runtimeErr := container.Select(*runtimeFlag)
+	if runtimeErr != nil && *runtimeFlag != "auto" {
+		fmt.Fprintf(logOut, "Error: --runtime: %s\n", runtimeErr)
+		os.Exit(exitError)
+	}
 
-	// Layer size checks (requires Docker to be installed)
-	if checks.IsDockerAvailable() {
-		sizeIssues := checks.CheckLayerSizes(dockerfile, dockerfileDir)
-		issues = append(issues, sizeIssues...)
+	// Apply the mechanical fixes, then check the fixed Dockerfile
+	if *dryRunFlag && !*fixFlag {
+		fmt.Fprintln(logOut, "Error: --dry-run requires --fix")
+		os.Exit(exitError)
+	}
+	if *fixFlag {
+		dockerfile, err = applyFixes(dockerfilePath, dockerfile, cfg, runtime, *securityFlag, *dryRunFlag, buildArgs, logOut)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
+		if *dryRunFlag {
+			os.Exit(exitClean)
+		}
+	}
+
+	// Read the image to analyze from an archive, without a daemon
+	img, err := loadImage(*imageArchiveFlag, *ociLayoutFlag)
+	if err != nil {
+		fmt.Fprintf(logOut, "Error: %s\n", err)
+		os.Exit(exitError)
+	}
+	if img != nil {
+		img.Correlate(dockerfile)
+	}
+
+	// Or build it, together with the Dockerfile to compare with
+	var comparison *build.Comparison
+	if (*buildFlag || *compareFlag != "") && img != nil {
+		fmt.Fprintln(logOut, "Error: --build and --compare cannot be combined with --image-archive or --oci-layout")
+		os.Exit(exitError)
+	}
+	buildOpts := build.Options{Runtime: runtime, Dockerfile: dockerfilePath, ContextDir: dockerfileDir, BuildArgs: buildArgs}
+	if (*buildFlag || *compareFlag != "") && runtime == nil {
+		fmt.Fprintf(logOut, "Error: --build needs a container runtime: %s\n", runtimeErr)
+		os.Exit(exitError)
+	}
+	switch {
+	case *compareFlag != "":
+		comparison, err = compareBuilds(buildOpts, dockerfile, *compareFlag, buildArgs, logOut)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
+		img = comparison.OldImage
+	case *buildFlag:
+		fmt.Fprintf(logOut, "[INFO] Building %s\n\n", dockerfilePath)
+		img, err = build.Build(buildOpts)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
+		img.Correlate(dockerfile)
+	}
+
+	// Inspect the base image in its registry
+	var baseImage *registry.Image
+	if *remoteFlag {
+		baseImage, err = inspectBaseImage(dockerfile)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: --remote: %s\n", err)
+			os.Exit(exitError)
+		}
 	}
 
-	// Security checks (if enabled)
-	if *securityFlag {
-		securityIssues := security.RunSecurityChecks(dockerfile)
-		issues = append(issues, securityIssues...)
+	// Refresh the end-of-life dates; --lifecycle wins over the configured file
+	settings := cfg.Settings()
+	lifecyclePath := cfg.LifecyclePath()
+	if *lifecycleFlag != "" {
+		lifecyclePath = *lifecycleFlag
+	}
+	if lifecyclePath != "" {
+		settings.Lifecycle, err = catalog.LoadLifecycle(lifecyclePath)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
 	}
 
+	// Load the vulnerability advisories; --advisories wins over the configured
+	// directory. Giving advisories turns on DS109 even without --security.
+	var advisories *vuln.Database
+	advisoriesPath := cfg.AdvisoriesPath()
+	if *advisoriesFlag != "" {
+		advisoriesPath = *advisoriesFlag
+	}
+	if advisoriesPath != "" {
+		advisories, err = vuln.Load(advisoriesPath)
+		if err != nil {
+			fmt.Fprintf(logOut, "Error: %s\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Fprintf(logOut, "[INFO] Loaded %d advisories from %s\n\n", advisories.Len(), advisoriesPath)
+		cfg.Rules.Enable = append(cfg.Rules.Enable, "DS109")
+	}
+
+	// Download the files ADD fetches without --checksum, for the digests
+	// DS102 suggests. Fetching them turns on DS102 even without --security.
+	var checksums map[string]string
+	if *fetchChecksumsFlag {
+		var errs []error
+		checksums, errs = security.FetchChecksums(dockerfile, &http.Client{Timeout: 5 * time.Minute})
+		for _, err := range errs {
+			fmt.Fprintf(logOut, "[INFO] Could not fetch a checksum: %s\n", err)
+		}
+		fmt.Fprintf(logOut, "[INFO] Fetched the checksums of %d ADD downloads\n\n", len(checksums))
+		cfg.Rules.Enable = append(cfg.Rules.Enable, "DS102")
+	}
+
+	// Run the enabled rules; security rules only when enabled.
+	// Without an image, layer size rules are skipped when no container runtime is found.
+	ctx := &checks.Context{
+		Dockerfile: dockerfile,
+		ContextDir: dockerfileDir,
+		Settings:   settings,
+		Image:      img,
+		Runtime:    runtime,
+		BaseImage:  baseImage,
+		Advisories: advisories,
+		Checksums:  checksums,
+	}
+	var rules []checks.Rule
+	issues := checks.Run(ctx, func(rule checks.Rule) bool {
+		if !cfg.RuleEnabled(rule, *securityFlag) {
+			return false
+		}
+		rules = append(rules, rule)
+		return true
+	})
+	cfg.ApplySeverities(issues)
+
 	// Print issues
-	printIssues(issues)
+	if format == "text" {
+		if img != nil {
+			printLayers(img)
+		}
+		if comparison != nil {
+			printComparison(comparison)
+		}
+		if baseImage != nil {
+			printBaseImage(baseImage)
+		}
+		printIssues(issues)
+	} else {
+		err := report.Write(os.Stdout, format, &report.Report{
+			ToolVersion: Version,
+			Path:        dockerfilePath,
+			Issues:      issues,
+			Rules:       rules,
+			Image:       img,
+			Comparison:  comparison,
+			BaseImage:   baseImage,
+		})
+		if err != nil {
+			fmt.Fprintf(logOut, "Error writing report: %s\n", err)
+			os.Exit(exitError)
+		}
+	}
+
+	os.Exit(exitCode(issues, threshold))
+}
+
+// exitCode tells a clean result apart from findings below and at or above the
+// threshold. Suppressed findings and informational ones never count.
+func exitCode(issues []checks.Issue, threshold checks.Severity) int {
+	code := exitClean
+	for _, issue := range checks.Unsuppressed(issues) {
+		if issue.Severity >= threshold {
+			return exitFailed
+		}
+		if issue.Severity > checks.SeverityInfo {
+			code = exitBelowThreshold
+		}
+	}
+	return code
+}
+
+// applyFixes rewrites the Dockerfile with the mechanical fixes of enabled,
+// unsuppressed rules. With dryRun the unified diff is printed instead and the
+// Dockerfile is left alone. It returns the Dockerfile to check afterwards.
+func applyFixes(path string, dockerfile *parser.Dockerfile, cfg *config.Config, runtime container.Runtime, security, dryRun bool, buildArgs buildArgsFlag, logOut io.Writer) (*parser.Dockerfile, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Dockerfile: %v", err)
+	}
+
+	suppressions := checks.ParseSuppressions(dockerfile)
+	opts := fix.Options{
+		Allow: func(ruleID string, line int) bool {
+			rule, ok := checks.LookupRule(ruleID)
+			if !ok || !cfg.RuleEnabled(rule, security) {
+				return false
+			}
+			for _, suppression := range suppressions {
+				if suppression.Covers(ruleID, line) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	if runtime != nil {
+		opts.Resolver = fix.RuntimeResolver{Runtime: runtime}
+	}
+
+	fixed, changes := fix.Apply(dockerfile, source, opts)
+	for _, change := range changes {
+		fmt.Fprintf(logOut, "[FIX] line %d: %s (%s)\n", change.Line, change.Description, change.RuleID)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(logOut, "[FIX] nothing to fix")
+	}
 
-	// Return non-zero exit code if issues were found
-	if len(issues) > 0 {
-		os.Exit(2)
+	if dryRun {
+		oldName, newName := filepath.ToSlash(path), filepath.ToSlash(path)
+		if !filepath.IsAbs(path) {
+			oldName, newName = "a/"+oldName, "b/"+newName
+		}
+		fmt.Print(fix.UnifiedDiff(oldName, newName, source, fixed))
+		return dockerfile, nil
+	}
+	if len(changes) == 0 {
+		return dockerfile, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
 	}
+	if err := os.WriteFile(path, fixed, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("could not write Dockerfile: %v", err)
+	}
+	fmt.Fprintln(logOut)
+
+	return parser.ParseDockerfileWithOptions(path, parser.Options{BuildArgs: buildArgs})
+}
+
+// validFormat reports whether an output format is supported
+func validFormat(format string) bool {
+	for _, f := range report.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig reads the configuration given with --config, or discovers one
+// from the Dockerfile directory upward
+func loadConfig(path, dockerfileDir string) (*config.Config, error) {
+	if path != "" {
+		return config.Load(path)
+	}
+	return config.Discover(dockerfileDir)
+}
+
+// loadImage reads the image given with --image-archive or --oci-layout, or
+// returns nil when neither is set
+func loadImage(archivePath, layoutDir string) (*archive.Image, error) {
+	switch {
+	case archivePath != "" && layoutDir != "":
+		return nil, fmt.Errorf("--image-archive and --oci-layout cannot be combined")
+	case archivePath != "":
+		return archive.LoadArchive(archivePath)
+	case layoutDir != "":
+		return archive.LoadOCILayout(layoutDir)
+	}
+	return nil, nil
+}
+
+// compareBuilds builds both Dockerfiles, each stage of them, and compares the
+// sizes
+func compareBuilds(opts build.Options, dockerfile *parser.Dockerfile, otherPath string, buildArgs buildArgsFlag, logOut io.Writer) (*build.Comparison, error) {
+	other, err := parser.ParseDockerfileWithOptions(otherPath, parser.Options{BuildArgs: buildArgs})
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", otherPath, err)
+	}
+	otherOpts := build.Options{Runtime: opts.Runtime, Dockerfile: otherPath, ContextDir: filepath.Dir(otherPath), BuildArgs: buildArgs}
+
+	fmt.Fprintf(logOut, "[INFO] Building %s and %s\n\n", opts.Dockerfile, otherPath)
+	return build.Compare(opts, otherOpts, dockerfile, other)
+}
+
+// buildArgsFlag collects repeated --build-arg KEY=VALUE flags. As with docker
+// build, a bare KEY takes its value from the environment.
+type buildArgsFlag map[string]string
+
+func (b buildArgsFlag) String() string {
+	var args []string
+	for key, value := range b {
+		args = append(args, key+"="+value)
+	}
+	return strings.Join(args, ",")
+}
+
+func (b buildArgsFlag) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("invalid build argument %q, expected KEY=VALUE", value)
+	}
+	if !found {
+		envValue, ok := os.LookupEnv(key)
+		if !ok {
+			return nil
+		}
+		val = envValue
+	}
+	b[key] = val
+	return nil
 }
 
 func printIssues(issues []checks.Issue) {
@@ -98,7 +480,8 @@ func printIssues(issues []checks.Issue) {
 	cyan := color.New(color.FgCyan).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
 
-	for _, issue := range issues {
+	active := checks.Unsuppressed(issues)
+	for _, issue := range active {
 		// Print issue header with a newline before each issue
 		fmt.Println()
 		prefix := yellow("[!]")
@@ -110,14 +493,34 @@ func printIssues(issues []checks.Issue) {
 
 		fmt.Printf("%s %s\n", prefix, issue.Message)
 		
+		// Print the rule and the line it points at
+		if issue.RuleID != "" {
+			location := ""
+			if issue.Line > 0 {
+				location = fmt.Sprintf(" (line %d)", issue.Line)
+			}
+			fmt.Printf("  %s Rule: %s%s\n", blue("→"), issue.RuleID, location)
+		}
+		// Print the stage for multi-stage builds
+		if issue.Stage != "" {
+			fmt.Printf("  %s Stage: %s\n", blue("→"), issue.Stage)
+		}
 		// Print severity and impact if they exist
-		if issue.Severity != "" {
+		if issue.Severity != checks.SeverityUnset {
 			fmt.Printf("  %s Severity: %s\n", blue("→"), issue.Severity)
 		}
 		if issue.Impact != "" {
 			fmt.Printf("  %s Impact: %s\n", blue("→"), issue.Impact)
 		}
 		
+		// Print supporting details, one per line
+		if len(issue.Details) > 0 {
+			fmt.Printf("  %s Details:\n", blue("→"))
+			for _, detail := range issue.Details {
+				fmt.Printf("    - %s\n", detail)
+			}
+		}
+
 		// Print fix suggestion with proper indentation
 		if issue.Fix != "" {
 			fmt.Printf("  %s Fix:\n", blue("→"))
@@ -139,5 +542,159 @@ func printIssues(issues []checks.Issue) {
 
 	// Print summary with a newline before it
 	fmt.Println()
-	fmt.Printf("[%s] Check complete — %d issues found\n", green("✓"), len(issues))
-}
\ No newline at end of file
+	summary := fmt.Sprintf("%d issues found", len(active))
+	if suppressed := len(issues) - len(active); suppressed > 0 {
+		summary += fmt.Sprintf(" (%d suppressed)", suppressed)
+	}
+	fmt.Printf("[%s] Check complete — %s\n", green("✓"), summary)
+}
+
+// printLayers lists the layers of the analyzed image with their size and the
+// instruction that created them, then the paths that waste the most space
+func printLayers(img *archive.Image) {
+	blue := color.New(color.FgBlue).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	name := img.Source
+	if len(img.RepoTags) > 0 {
+		name = img.RepoTags[0]
+	}
+	fmt.Printf("[LAYERS] %s: %d layers, %s\n", name, len(img.Layers), utils.FormatSize(img.TotalSize()))
+	for _, layer := range img.Layers {
+		wasted := ""
+		if layer.WastedSize > 0 {
+			wasted = yellow(fmt.Sprintf(" (%s wasted)", utils.FormatSize(layer.WastedSize)))
+		}
+		fmt.Printf("  %s #%-3d %9s  %-10s %s%s\n", blue("→"), layer.Index, utils.FormatSize(layer.Size), layerOrigin(layer), truncate(layer.CreatedBy(), 60), wasted)
+	}
+
+	waste := img.Waste
+	if waste == nil {
+		return
+	}
+	fmt.Printf("\n[WASTE] %s of %s wasted — image efficiency %.1f%%\n",
+		utils.FormatSize(waste.WastedSize), utils.FormatSize(waste.TotalSize), waste.Efficiency()*100)
+	for i, file := range waste.Files {
+		if i == 10 {
+			fmt.Printf("  %s ... %d more paths\n", blue("→"), len(waste.Files)-i)
+			break
+		}
+		fmt.Printf("  %s %9s  %s (added by %s, hidden by %s)\n", blue("→"), utils.FormatSize(file.Size), file.Path,
+			layerList(img, file.AddedBy), layerList(img, file.HiddenBy))
+	}
+}
+
+// inspectBaseImage reads the base image of the final stage from its
+// registry, for the platform given to FROM --platform if any. It returns
+// nil for FROM scratch.
+func inspectBaseImage(dockerfile *parser.Dockerfile) (*registry.Image, error) {
+	final := dockerfile.FinalStage()
+	if final == nil || dockerfile.BaseImage == "" || dockerfile.BaseImage == "scratch" {
+		return nil, nil
+	}
+	platform := final.Root().Platform
+	if strings.Contains(platform, "$") {
+		platform = ""
+	}
+
+	client, err := registry.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Inspect(dockerfile.BaseImage, platform)
+}
+
+// printBaseImage shows the base image as read from its registry
+func printBaseImage(img *registry.Image) {
+	blue := color.New(color.FgBlue).SprintFunc()
+
+	fmt.Printf("[BASE IMAGE] %s (%s)\n", img.Reference, img.Platform)
+	fmt.Printf("  %s Digest:       %s\n", blue("→"), img.Digest)
+	fmt.Printf("  %s Layers:       %d\n", blue("→"), len(img.Layers))
+	fmt.Printf("  %s Compressed:   %s\n", blue("→"), utils.FormatSize(img.CompressedSize()))
+	fmt.Printf("  %s Uncompressed: %s\n", blue("→"), optionalSize(img.Size()))
+	fmt.Printf("  %s Platforms:    %s\n", blue("→"), strings.Join(img.Platforms, ", "))
+}
+
+// printComparison shows how the size of each stage and layer changes from
+// the checked Dockerfile to the one given with --compare
+func printComparison(c *build.Comparison) {
+	blue := color.New(color.FgBlue).SprintFunc()
+
+	fmt.Printf("\n[COMPARE] %s → %s\n", c.OldPath, c.NewPath)
+	for _, stage := range c.Stages {
+		fmt.Printf("  %s stage %-16s %9s → %-9s %s\n", blue("→"), stage.Stage,
+			optionalSize(stage.Old), optionalSize(stage.New), sizeChange(stage.Change()))
+	}
+	for _, layer := range c.Layers {
+		oldSize, newSize := int64(-1), int64(-1)
+		origin := ""
+		if layer.Old != nil {
+			oldSize = layer.Old.Size
+			origin = layerOrigin(layer.Old)
+		}
+		if layer.New != nil {
+			newSize = layer.New.Size
+			if origin != "" {
+				origin += " → "
+			}
+			origin += layerOrigin(layer.New)
+		}
+		fmt.Printf("  %s layer #%-15d %9s → %-9s %-10s %s\n", blue("→"), layer.Index,
+			optionalSize(oldSize), optionalSize(newSize), sizeChange(layer.Change()), origin)
+	}
+}
+
+// optionalSize formats a size, or "-" for a missing stage or layer
+func optionalSize(size int64) string {
+	if size < 0 {
+		return "-"
+	}
+	return utils.FormatSize(size)
+}
+
+// sizeChange formats a size difference with its sign
+func sizeChange(change int64) string {
+	switch {
+	case change > 0:
+		return "+" + utils.FormatSize(change)
+	case change < 0:
+		return "-" + utils.FormatSize(-change)
+	default:
+		return "±0"
+	}
+}
+
+// layerOrigin tells where a layer comes from: a Dockerfile line or the base image
+func layerOrigin(layer *archive.Layer) string {
+	if inst := layer.Instruction(); inst != nil {
+		return fmt.Sprintf("line %d", inst.Line)
+	}
+	return "base image"
+}
+
+// layerList names layers by index and origin, such as "#1 line 3, #2 line 5"
+func layerList(img *archive.Image, indexes []int) string {
+	var names []string
+	for _, index := range indexes {
+		names = append(names, fmt.Sprintf("#%d %s", index, layerOrigin(img.Layers[index])))
+	}
+	return strings.Join(names, ", ")
+}
+
+// truncate shortens text to at most n runes, marking the cut with "..."
+func truncate(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// printRules lists every registered rule with its category and default severity
+func printRules() {
+	for _, rule := range checks.Rules() {
+		fmt.Printf("%s  %-22s %-14s %-7s %s\n", rule.ID(), rule.Name(), rule.Category(), rule.DefaultSeverity(), rule.Description())
+	}
+}
@@ -1,197 +1,238 @@
 package parser
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
 )
 
-// Instruction represents a Dockerfile instruction
-type Instruction struct {
-	Command   string
-	Arguments string
-	Line      int
-	Raw       string
-}
-
 // Dockerfile represents a parsed Dockerfile
 type Dockerfile struct {
 	Path         string
 	Instructions []Instruction
-	BaseImage    string
+	BaseImage    string            // Base image of the final stage, following stage references
+	Stages       []*Stage          // Build stages in the order they appear
+	Directives   map[string]string // Parser directives such as syntax and escape
+	Escape       rune              // Escape character, '\\' unless overridden
+	Args         map[string]string // Global ARG values declared before the first FROM
+	Comments     []Comment         // Comment lines, including those inside continued instructions
+}
+
+// Comment is a comment line of the Dockerfile
+type Comment struct {
+	Line int    // Line of the comment
+	Text string // Text after the '#', with surrounding whitespace removed
 }
 
 // ParseDockerfile parses a Dockerfile and returns its structure
 func ParseDockerfile(path string) (*Dockerfile, error) {
+	return ParseDockerfileWithOptions(path, Options{})
+}
+
+// ParseDockerfileWithOptions parses a Dockerfile with the given build arguments
+func ParseDockerfileWithOptions(path string, opts Options) (*Dockerfile, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not open Dockerfile: %v", err)
 	}
 	defer file.Close()
 
-	dockerfile := &Dockerfile{
-		Path:         path,
-		Instructions: []Instruction{},
-	}
-
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	continuationLine := ""
-	
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		
-		// Handle line continuations
-		trimmedLine := strings.TrimSpace(line)
-		if continuationLine != "" {
-			line = continuationLine + " " + trimmedLine
-			continuationLine = ""
-		}
-		
-		// Check for line continuation
-		if strings.HasSuffix(trimmedLine, "\\") {
-			continuationLine = strings.TrimSuffix(trimmedLine, "\\")
-			continue
-		}
-		
-		// Skip empty lines and comments
-		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
-			continue
-		}
-		
-		// Parse the instruction
-		parts := strings.SplitN(line, " ", 2)
-		command := strings.ToUpper(parts[0])
-		arguments := ""
-		if len(parts) > 1 {
-			arguments = parts[1]
-		}
-		
-		instruction := Instruction{
-			Command:   command,
-			Arguments: arguments,
-			Line:      lineNum,
-			Raw:       line,
+	dockerfile, err := ParseWithOptions(file, opts)
+	if err != nil {
+		return nil, err
+	}
+	dockerfile.Path = path
+
+	return dockerfile, nil
+}
+
+// FinalStage returns the stage that produces the shipped image
+func (d *Dockerfile) FinalStage() *Stage {
+	if len(d.Stages) == 0 {
+		return nil
+	}
+	return d.Stages[len(d.Stages)-1]
+}
+
+// StageByName returns the stage with the given name or index
+func (d *Dockerfile) StageByName(ref string) *Stage {
+	return lookupStage(d.Stages, ref)
+}
+
+// StageOf returns the stage that contains an instruction
+func (d *Dockerfile) StageOf(inst Instruction) *Stage {
+	if inst.Stage < 0 || inst.Stage >= len(d.Stages) {
+		return nil
+	}
+	return d.Stages[inst.Stage]
+}
+
+// StageName returns the name of the stage an instruction belongs to, or ""
+// for instructions before the first FROM
+func (d *Dockerfile) StageName(inst Instruction) string {
+	if stage := d.StageOf(inst); stage != nil {
+		return stage.String()
+	}
+	return ""
+}
+
+// RequiredStages returns the stages the final stage depends on, directly or
+// transitively, including the final stage itself, in Dockerfile order
+func (d *Dockerfile) RequiredStages() []*Stage {
+	final := d.FinalStage()
+	if final == nil {
+		return nil
+	}
+
+	required := map[int]bool{}
+	var visit func(stage *Stage)
+	visit = func(stage *Stage) {
+		if required[stage.Index] {
+			return
 		}
-		
-		dockerfile.Instructions = append(dockerfile.Instructions, instruction)
-		
-		// Capture the base image from FROM instruction
-		if command == "FROM" && dockerfile.BaseImage == "" {
-			// Extract just the image name and tag
-			fromArgs := strings.Fields(arguments)
-			// Skip AS name if present
-			for i, arg := range fromArgs {
-				if strings.ToUpper(arg) == "AS" && i > 0 {
-					dockerfile.BaseImage = fromArgs[0]
-					break
-				}
-			}
-			
-			// If no AS found, use the first argument
-			if dockerfile.BaseImage == "" && len(fromArgs) > 0 {
-				dockerfile.BaseImage = fromArgs[0]
-			}
+		required[stage.Index] = true
+		for _, dep := range stage.DependsOn {
+			visit(d.Stages[dep])
 		}
 	}
+	visit(final)
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error scanning Dockerfile: %v", err)
+	var stages []*Stage
+	for _, stage := range d.Stages {
+		if required[stage.Index] {
+			stages = append(stages, stage)
+		}
 	}
-
-	return dockerfile, nil
+	return stages
 }
 
 // GetInstructionsByType returns all instructions of a specific type
 func (d *Dockerfile) GetInstructionsByType(command string) []Instruction {
 	var result []Instruction
 	command = strings.ToUpper(command)
-	
+
 	for _, inst := range d.Instructions {
 		if inst.Command == command {
 			result = append(result, inst)
 		}
 	}
-	
+
 	return result
 }
 
 // HasInstruction checks if the Dockerfile has a specific instruction
 func (d *Dockerfile) HasInstruction(command string) bool {
 	command = strings.ToUpper(command)
-	
+
 	for _, inst := range d.Instructions {
 		if inst.Command == command {
 			return true
 		}
 	}
-	
+
 	return false
 }
 
-// HasHealthcheck checks if the Dockerfile has a HEALTHCHECK instruction
+// HasHealthcheck checks if the final image has a HEALTHCHECK instruction
 func (d *Dockerfile) HasHealthcheck() bool {
-	return d.HasInstruction("HEALTHCHECK")
+	final := d.FinalStage()
+	return final != nil && final.HasInstruction("HEALTHCHECK")
 }
 
-// HasUser checks if the Dockerfile has a USER instruction
+// HasUser checks if the final image sets a USER
 func (d *Dockerfile) HasUser() bool {
-	return d.HasInstruction("USER")
+	final := d.FinalStage()
+	if final == nil {
+		return false
+	}
+	user, _ := final.User()
+	return user != ""
 }
 
-// UsesRootUser checks if the Dockerfile explicitly uses root as user
+// UsesRootUser checks if the final image explicitly uses root as user
 func (d *Dockerfile) UsesRootUser() bool {
-	for _, inst := range d.Instructions {
-		if inst.Command == "USER" {
-			user := strings.TrimSpace(inst.Arguments)
-			return user == "root" || user == "0"
-		}
+	final := d.FinalStage()
+	if final == nil {
+		return false
 	}
-	
-	return false
+	user, _ := final.User()
+	return IsRootUser(user)
+}
+
+// IsRootUser reports whether a USER value refers to root
+func IsRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "root" || name == "0"
 }
 
 // HasAddWithURL checks if the Dockerfile uses ADD with a URL
 func (d *Dockerfile) HasAddWithURL() bool {
 	for _, inst := range d.Instructions {
 		if inst.Command == "ADD" {
-			// Simple pattern to match URLs
-			matched, _ := regexp.MatchString(`https?://`, inst.Arguments)
-			if matched {
-				return true
+			for _, source := range inst.Sources() {
+				if IsURL(source) {
+					return true
+				}
 			}
 		}
 	}
-	
+
 	return false
 }
 
 // HasWildcardCopy checks if the Dockerfile uses COPY with wildcards
 func (d *Dockerfile) HasWildcardCopy() bool {
-	for _, inst := range d.Instructions {
-		if inst.Command == "COPY" {
-			if strings.Contains(inst.Arguments, " . ") || strings.HasSuffix(inst.Arguments, " .") {
-				return true
+	return d.FindWildcardCopy() != nil
+}
+
+// FindWildcardCopy returns the first COPY that copies the whole build context
+func (d *Dockerfile) FindWildcardCopy() *Instruction {
+	for i, inst := range d.Instructions {
+		if inst.Command == "COPY" && !inst.HasFlag("from") {
+			for _, source := range inst.Sources() {
+				if source == "." || source == "./" {
+					return &d.Instructions[i]
+				}
 			}
 		}
 	}
-	
-	return false
+
+	return nil
 }
 
-// GetExposedPorts returns all ports exposed in the Dockerfile
+// GetExposedPorts returns all ports exposed by the final image
 func (d *Dockerfile) GetExposedPorts() []string {
 	var ports []string
-	
-	for _, inst := range d.Instructions {
-		if inst.Command == "EXPOSE" {
-			portArgs := strings.Fields(inst.Arguments)
-			ports = append(ports, portArgs...)
+
+	final := d.FinalStage()
+	if final == nil {
+		return ports
+	}
+
+	for _, stage := range final.Lineage() {
+		for _, inst := range stage.GetInstructionsByType("EXPOSE") {
+			ports = append(ports, inst.Args...)
 		}
 	}
-	
+
 	return ports
-}
\ No newline at end of file
+}
+
+// IsURL reports whether a COPY or ADD source refers to a remote location
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// IsGitSource reports whether an ADD source is a git repository, such as
+// git@github.com:org/repo.git#v1.0 or https://github.com/org/repo.git
+func IsGitSource(source string) bool {
+	if strings.HasPrefix(source, "git@") || strings.HasPrefix(source, "git://") || strings.HasPrefix(source, "ssh://") {
+		return true
+	}
+	if !IsURL(source) {
+		return false
+	}
+	repo, _, _ := strings.Cut(source, "#")
+	repo, _, _ = strings.Cut(repo, "?")
+	return strings.HasSuffix(repo, ".git")
+}
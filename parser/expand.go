@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// wordExpander removes quotes and substitutes ARG and ENV variables in a word
+// the same way the builder processes instruction arguments
+type wordExpander struct {
+	escape rune
+	lookup func(name string) (string, bool) // nil disables substitution
+}
+
+// wordLexer walks a single word while it is being expanded
+type wordLexer struct {
+	wordExpander
+	runes []rune
+	pos   int
+}
+
+// process returns the word with quotes removed and variables substituted
+func (e wordExpander) process(word string) (string, error) {
+	lexer := &wordLexer{wordExpander: e, runes: []rune(word)}
+	return lexer.processUntil(0)
+}
+
+// processUntil processes the word until the stop rune is found outside quotes.
+// A stop rune of 0 processes the remainder of the word.
+func (l *wordLexer) processUntil(stop rune) (string, error) {
+	var b strings.Builder
+
+	for l.pos < len(l.runes) {
+		ch := l.runes[l.pos]
+
+		switch {
+		case stop != 0 && ch == stop:
+			l.pos++
+			return b.String(), nil
+		case ch == l.escape && l.escape != 0:
+			l.pos++
+			if l.pos < len(l.runes) {
+				b.WriteRune(l.runes[l.pos])
+				l.pos++
+			}
+		case ch == '\'':
+			l.pos++
+			for l.pos < len(l.runes) && l.runes[l.pos] != '\'' {
+				b.WriteRune(l.runes[l.pos])
+				l.pos++
+			}
+			l.pos++
+		case ch == '"':
+			value, err := l.processDoubleQuote()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+		case ch == '$' && l.lookup != nil:
+			value, err := l.processDollar()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+		default:
+			b.WriteRune(ch)
+			l.pos++
+		}
+	}
+
+	if stop != 0 {
+		return "", fmt.Errorf("syntax error: missing '%c' in substitution", stop)
+	}
+	return b.String(), nil
+}
+
+// processDoubleQuote processes a double quoted section, where variables are
+// still substituted but the escape character only protects ", $ and itself
+func (l *wordLexer) processDoubleQuote() (string, error) {
+	var b strings.Builder
+	l.pos++
+
+	for l.pos < len(l.runes) {
+		ch := l.runes[l.pos]
+
+		switch {
+		case ch == '"':
+			l.pos++
+			return b.String(), nil
+		case ch == l.escape && l.escape != 0 && l.pos+1 < len(l.runes):
+			next := l.runes[l.pos+1]
+			if next == '"' || next == '$' || next == l.escape {
+				b.WriteRune(next)
+				l.pos += 2
+			} else {
+				b.WriteRune(ch)
+				l.pos++
+			}
+		case ch == '$' && l.lookup != nil:
+			value, err := l.processDollar()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+		default:
+			b.WriteRune(ch)
+			l.pos++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// processDollar substitutes $VAR, ${VAR} and the ${VAR:-default},
+// ${VAR:+alternative} and ${VAR:?message} forms, with or without the colon
+func (l *wordLexer) processDollar() (string, error) {
+	l.pos++
+	if l.pos >= len(l.runes) {
+		return "$", nil
+	}
+
+	if l.runes[l.pos] != '{' {
+		name := l.processName()
+		if name == "" {
+			return "$", nil
+		}
+		value, _ := l.lookup(name)
+		return value, nil
+	}
+
+	l.pos++
+	name := l.processName()
+	if name == "" || l.pos >= len(l.runes) {
+		return "", fmt.Errorf("syntax error: bad substitution in %q", string(l.runes))
+	}
+
+	if l.runes[l.pos] == '}' {
+		l.pos++
+		value, _ := l.lookup(name)
+		return value, nil
+	}
+
+	colon := false
+	if l.runes[l.pos] == ':' {
+		colon = true
+		l.pos++
+		if l.pos >= len(l.runes) {
+			return "", fmt.Errorf("syntax error: missing '}' in %q", string(l.runes))
+		}
+	}
+
+	modifier := l.runes[l.pos]
+	l.pos++
+	word, err := l.processUntil('}')
+	if err != nil {
+		return "", err
+	}
+
+	value, set := l.lookup(name)
+	if colon && value == "" {
+		set = false
+	}
+
+	switch modifier {
+	case '-':
+		if !set {
+			return word, nil
+		}
+		return value, nil
+	case '+':
+		if set {
+			return word, nil
+		}
+		return "", nil
+	case '?':
+		if !set {
+			if word == "" {
+				word = "is not allowed to be unset"
+			}
+			return "", fmt.Errorf("%s: %s", name, word)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("unsupported modifier (%c) in substitution", modifier)
+	}
+}
+
+// processName reads a variable name made of letters, digits and underscores
+func (l *wordLexer) processName() string {
+	start := l.pos
+	for l.pos < len(l.runes) {
+		ch := l.runes[l.pos]
+		if ch != '_' && !('a' <= ch && ch <= 'z') && !('A' <= ch && ch <= 'Z') && !('0' <= ch && ch <= '9') {
+			break
+		}
+		l.pos++
+	}
+	return string(l.runes[start:l.pos])
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+// variableRegex matches a $NAME or ${NAME} reference, capturing the name
+var variableRegex = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Flag represents a builder flag such as --from=builder or --link
+type Flag struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// Heredoc represents a here-document attached to RUN, COPY or ADD
+type Heredoc struct {
+	Name      string // Terminator word, without quotes
+	Body      string // Content between the instruction and the terminator
+	Expand    bool   // False when the terminator was quoted
+	Chomp     bool   // True for <<- which strips leading tabs
+	StartLine int
+	EndLine   int
+}
+
+// Instruction represents a Dockerfile instruction
+type Instruction struct {
+	Command   string        // Upper-cased instruction keyword
+	Arguments string        // Raw text after the keyword, continuations joined
+	Flags     []Flag        // Builder flags that precede the arguments
+	Args      []string      // Parsed arguments, excluding flags
+	ExecForm  bool          // True when the arguments were given as a JSON array
+	Heredocs  []Heredoc     // Here-documents consumed by this instruction
+	Trigger   *Instruction  // Instruction wrapped by ONBUILD
+	Shell     *shell.Script // Parsed command of a RUN instruction, nil if not a POSIX shell script
+	Stage     int           // Index of the enclosing stage, -1 before the first FROM
+	Line      int           // First line of the instruction
+	EndLine   int           // Last line of the instruction, including heredocs
+	Raw       string
+
+	rawFlags []Flag   // Flags as written, before variable substitution
+	rawArgs  []string // Args as written, before variable substitution
+	escape   rune     // Escape character of the Dockerfile
+}
+
+// HasFlag reports whether the instruction carries the given builder flag
+func (i Instruction) HasFlag(name string) bool {
+	_, ok := i.FlagValue(name)
+	return ok
+}
+
+// FlagValue returns the value of a builder flag and whether it was set
+func (i Instruction) FlagValue(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "--")
+	for _, flag := range i.Flags {
+		if flag.Name == name {
+			return flag.Value, true
+		}
+	}
+	return "", false
+}
+
+// RawFlagValue returns the value of a builder flag as written, before
+// variable substitution, and whether it was set
+func (i Instruction) RawFlagValue(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "--")
+	for _, flag := range i.rawFlags {
+		if flag.Name == name {
+			return flag.Value, true
+		}
+	}
+	return "", false
+}
+
+// FlagValues returns every value of a repeatable builder flag such as --mount
+func (i Instruction) FlagValues(name string) []string {
+	var values []string
+	name = strings.TrimPrefix(name, "--")
+	for _, flag := range i.Flags {
+		if flag.Name == name {
+			values = append(values, flag.Value)
+		}
+	}
+	return values
+}
+
+// ShellForm reports whether RUN, CMD or ENTRYPOINT arguments run through a shell
+func (i Instruction) ShellForm() bool {
+	return !i.ExecForm && len(i.Args) > 0
+}
+
+// Script returns the text the shell would execute for a RUN instruction.
+// Here-documents are reassembled so the result is a complete shell script.
+func (i Instruction) Script() string {
+	if len(i.Args) == 0 {
+		return ""
+	}
+	if i.ExecForm {
+		return strings.Join(i.Args, " ")
+	}
+
+	command := i.Args[0]
+	if len(i.Heredocs) == 0 {
+		return command
+	}
+
+	// A bare "RUN <<EOF" executes the heredoc body as the script itself
+	if len(i.Heredocs) == 1 && isBareHeredoc(command, i.escape) {
+		return i.Heredocs[0].Body
+	}
+
+	var b strings.Builder
+	b.WriteString(command)
+	b.WriteString("\n")
+	for _, heredoc := range i.Heredocs {
+		b.WriteString(heredoc.Body)
+		b.WriteString(heredoc.Name)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Sources returns the source operands of a COPY or ADD instruction
+func (i Instruction) Sources() []string {
+	if len(i.Args) < 2 {
+		return nil
+	}
+	return i.Args[:len(i.Args)-1]
+}
+
+// RawSources returns the source operands of a COPY or ADD instruction as
+// written, before variable substitution
+func (i Instruction) RawSources() []string {
+	if len(i.rawArgs) < 2 {
+		return nil
+	}
+	return i.rawArgs[:len(i.rawArgs)-1]
+}
+
+// Destination returns the destination operand of a COPY or ADD instruction
+func (i Instruction) Destination() string {
+	if len(i.Args) == 0 {
+		return ""
+	}
+	return i.Args[len(i.Args)-1]
+}
+
+// RawImage returns the image of a FROM instruction as written, before ARG
+// substitution
+func (i Instruction) RawImage() string {
+	for _, field := range strings.Fields(i.Arguments) {
+		if !strings.HasPrefix(field, "--") {
+			return field
+		}
+	}
+	return ""
+}
+
+// Variables returns the names of the variables a word refers to, in order of
+// first use, such as NODE_VERSION for node:${NODE_VERSION}-alpine
+func Variables(word string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range variableRegex.FindAllStringSubmatch(word, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// isBareHeredoc reports whether a command consists of a single heredoc marker,
+// splitting it with the escape character of the Dockerfile
+func isBareHeredoc(command string, escape rune) bool {
+	if escape == 0 {
+		escape = '\\'
+	}
+	words := splitWords(command, escape)
+	if len(words) != 1 {
+		return false
+	}
+	_, ok := parseHeredocWord(words[0])
+	return ok
+}
@@ -0,0 +1,460 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	directiveRegex  = regexp.MustCompile(`^#[ \t]*([a-zA-Z][a-zA-Z0-9]*)[ \t]*=[ \t]*(.+?)[ \t]*$`)
+	whitespaceRegex = regexp.MustCompile(`[\t\v\f\r ]+`)
+	heredocRegex    = regexp.MustCompile(`^(\d*)<<(-?)(.+)$`)
+)
+
+// knownDirectives lists the parser directives understood by the builder.
+// Anything else that looks like a directive is treated as a comment.
+var knownDirectives = map[string]bool{
+	"syntax": true,
+	"escape": true,
+	"check":  true,
+}
+
+// wordCommands lists the instructions whose words are unquoted by the builder
+var wordCommands = map[string]bool{
+	"ADD":        true,
+	"ARG":        true,
+	"COPY":       true,
+	"ENV":        true,
+	"EXPOSE":     true,
+	"FROM":       true,
+	"LABEL":      true,
+	"STOPSIGNAL": true,
+	"USER":       true,
+	"VOLUME":     true,
+	"WORKDIR":    true,
+}
+
+// parseState tracks the position of the parser within the source lines
+type parseState struct {
+	lines        []string
+	pos          int
+	escape       rune
+	continuation *regexp.Regexp
+}
+
+// Parse reads a Dockerfile from r following the Dockerfile grammar:
+// parser directives, escape-aware line continuations, comments inside
+// continued lines, JSON (exec form) arguments, builder flags and heredocs.
+func Parse(r io.Reader) (*Dockerfile, error) {
+	return ParseWithOptions(r, Options{})
+}
+
+// ParseWithOptions reads a Dockerfile from r, resolving ARG and ENV references
+// in instruction arguments with the given build arguments
+func ParseWithOptions(r io.Reader, opts Options) (*Dockerfile, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning Dockerfile: %v", err)
+	}
+
+	dockerfile := &Dockerfile{
+		Instructions: []Instruction{},
+		Directives:   map[string]string{},
+		Escape:       '\\',
+	}
+
+	state := &parseState{lines: lines}
+	vars := newVariableScope(opts.BuildArgs)
+	if err := state.parseDirectives(dockerfile); err != nil {
+		return nil, err
+	}
+	state.setEscape(dockerfile.Escape)
+
+	for state.pos < len(state.lines) {
+		line := state.lines[state.pos]
+		state.pos++
+		startLine := state.pos
+
+		// Skip empty lines and comments
+		trimmedLine := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmedLine, "#") {
+			dockerfile.addComment(trimmedLine, startLine)
+		}
+		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
+			continue
+		}
+
+		logical, done := state.trimContinuation(strings.TrimLeftFunc(line, unicode.IsSpace))
+		for !done && state.pos < len(state.lines) {
+			next := state.lines[state.pos]
+			state.pos++
+
+			// Comments and empty lines inside a continued instruction are dropped
+			trimmedNext := strings.TrimSpace(next)
+			if strings.HasPrefix(trimmedNext, "#") {
+				dockerfile.addComment(trimmedNext, state.pos)
+			}
+			if trimmedNext == "" || strings.HasPrefix(trimmedNext, "#") {
+				continue
+			}
+
+			var part string
+			part, done = state.trimContinuation(next)
+			logical += part
+		}
+
+		if strings.TrimSpace(logical) == "" {
+			continue
+		}
+
+		instruction, err := state.newInstruction(logical, startLine)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := state.readHeredocs(&instruction); err != nil {
+			return nil, err
+		}
+		instruction.EndLine = state.pos
+
+		if err := vars.expand(&instruction, state.escape); err != nil {
+			return nil, err
+		}
+
+		dockerfile.Instructions = append(dockerfile.Instructions, instruction)
+	}
+
+	dockerfile.Args = vars.globalArgs
+	dockerfile.Stages = buildStages(dockerfile.Instructions)
+	for i, stage := range dockerfile.Stages {
+		stage.Args = vars.stages[i].args
+		stage.Env = vars.stages[i].env
+	}
+	if final := dockerfile.FinalStage(); final != nil {
+		dockerfile.BaseImage = final.Root().BaseImage
+	}
+
+	return dockerfile, nil
+}
+
+// addComment records a comment line, given with its leading '#'
+func (d *Dockerfile) addComment(text string, line int) {
+	d.Comments = append(d.Comments, Comment{
+		Line: line,
+		Text: strings.TrimSpace(strings.TrimPrefix(text, "#")),
+	})
+}
+
+// readLines reads all lines, dropping a leading byte order mark and CRLF endings
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseDirectives consumes the parser directives at the top of the file
+func (s *parseState) parseDirectives(dockerfile *Dockerfile) error {
+	for s.pos < len(s.lines) {
+		match := directiveRegex.FindStringSubmatch(s.lines[s.pos])
+		if match == nil {
+			return nil
+		}
+
+		name := strings.ToLower(match[1])
+		if !knownDirectives[name] {
+			return nil
+		}
+		if _, exists := dockerfile.Directives[name]; exists {
+			return fmt.Errorf("line %d: only one %s parser directive can be used", s.pos+1, name)
+		}
+
+		value := match[2]
+		if name == "escape" {
+			if value != "\\" && value != "`" {
+				return fmt.Errorf("line %d: invalid escape token '%s' does not match ` or \\", s.pos+1, value)
+			}
+			dockerfile.Escape = rune(value[0])
+		}
+
+		dockerfile.Directives[name] = value
+		s.pos++
+	}
+
+	return nil
+}
+
+// setEscape configures the escape character used for line continuations
+func (s *parseState) setEscape(escape rune) {
+	s.escape = escape
+	s.continuation = regexp.MustCompile(regexp.QuoteMeta(string(escape)) + `[ \t]*$`)
+}
+
+// trimContinuation strips a trailing escape character and reports whether the
+// instruction ends on this line
+func (s *parseState) trimContinuation(line string) (string, bool) {
+	if s.continuation.MatchString(line) {
+		return s.continuation.ReplaceAllString(line, ""), false
+	}
+	return line, true
+}
+
+// newInstruction builds an instruction node from a logical line
+func (s *parseState) newInstruction(logical string, line int) (Instruction, error) {
+	trimmed := strings.TrimSpace(logical)
+	parts := whitespaceRegex.Split(trimmed, 2)
+
+	instruction := Instruction{
+		Command: strings.ToUpper(parts[0]),
+		Line:    line,
+		EndLine: line,
+		Raw:     trimmed,
+		escape:  s.escape,
+	}
+	if len(parts) > 1 {
+		instruction.Arguments = parts[1]
+	}
+
+	flags, rest := extractFlags(instruction.Arguments)
+	instruction.Flags = flags
+
+	var err error
+	switch instruction.Command {
+	case "RUN", "CMD", "ENTRYPOINT", "SHELL":
+		instruction.Args, instruction.ExecForm = parseMaybeJSON(rest)
+	case "COPY", "ADD", "VOLUME":
+		instruction.Args, instruction.ExecForm = parseMaybeJSONToList(rest, s.escape)
+	case "ENV", "LABEL":
+		instruction.Args, err = parseNameVal(instruction.Command, rest, s.escape)
+	case "HEALTHCHECK":
+		instruction.Args, instruction.ExecForm = parseHealthcheck(rest)
+	case "ONBUILD":
+		if rest != "" {
+			trigger, err := s.newInstruction(rest, line)
+			if err != nil {
+				return instruction, err
+			}
+			instruction.Trigger = &trigger
+			instruction.Args = []string{rest}
+		}
+	case "MAINTAINER", "STOPSIGNAL", "USER", "WORKDIR":
+		if rest != "" {
+			instruction.Args = []string{strings.TrimSpace(rest)}
+		}
+	default:
+		instruction.Args = splitWords(rest, s.escape)
+	}
+	if err != nil {
+		return instruction, fmt.Errorf("line %d: %v", line, err)
+	}
+	instruction.rawFlags = append([]Flag(nil), instruction.Flags...)
+	instruction.rawArgs = append([]string(nil), instruction.Args...)
+
+	if canContainHeredoc(instruction.Command) && !instruction.ExecForm && strings.Contains(rest, "<<") {
+		for _, word := range splitWords(rest, s.escape) {
+			if heredoc, ok := parseHeredocWord(word); ok {
+				instruction.Heredocs = append(instruction.Heredocs, heredoc)
+			}
+		}
+	}
+
+	return instruction, nil
+}
+
+// readHeredocs consumes the bodies of the heredocs declared by an instruction
+func (s *parseState) readHeredocs(instruction *Instruction) error {
+	for i := range instruction.Heredocs {
+		heredoc := &instruction.Heredocs[i]
+		heredoc.StartLine = s.pos + 1
+
+		var body strings.Builder
+		terminated := false
+		for s.pos < len(s.lines) {
+			line := s.lines[s.pos]
+			s.pos++
+
+			if heredoc.Chomp {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == heredoc.Name {
+				terminated = true
+				break
+			}
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+
+		if !terminated {
+			return fmt.Errorf("line %d: unterminated heredoc %s", instruction.Line, heredoc.Name)
+		}
+
+		heredoc.Body = body.String()
+		heredoc.EndLine = s.pos
+	}
+
+	return nil
+}
+
+// extractFlags splits leading --name[=value] builder flags from the arguments
+func extractFlags(args string) ([]Flag, string) {
+	var flags []Flag
+	rest := strings.TrimLeftFunc(args, unicode.IsSpace)
+
+	for strings.HasPrefix(rest, "--") {
+		end := flagEnd(rest)
+		word := rest[:end]
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+
+		// A lone "--" terminates the flag list
+		if word == "--" {
+			break
+		}
+
+		word = unquote(strings.TrimPrefix(word, "--"), 0)
+		name, value, hasValue := strings.Cut(word, "=")
+		flags = append(flags, Flag{Name: name, Value: value, HasValue: hasValue})
+	}
+
+	return flags, rest
+}
+
+// flagEnd returns the index where the flag at the start of s ends
+func flagEnd(s string) int {
+	var quote rune
+	for i, ch := range s {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case unicode.IsSpace(ch):
+			return i
+		}
+	}
+	return len(s)
+}
+
+// parseMaybeJSON parses exec form arguments, falling back to a single shell-form
+// command string when the arguments are not a JSON array of strings
+func parseMaybeJSON(rest string) ([]string, bool) {
+	if list, ok := parseJSONList(rest); ok {
+		return list, true
+	}
+	if strings.TrimSpace(rest) == "" {
+		return nil, false
+	}
+	return []string{rest}, false
+}
+
+// parseMaybeJSONToList parses a JSON array or whitespace separated words
+func parseMaybeJSONToList(rest string, escape rune) ([]string, bool) {
+	if list, ok := parseJSONList(rest); ok {
+		return list, true
+	}
+	return splitWords(rest, escape), false
+}
+
+// parseJSONList decodes a JSON array of strings
+func parseJSONList(rest string) ([]string, bool) {
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "[") {
+		return nil, false
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(rest), &list); err != nil {
+		return nil, false
+	}
+	return list, true
+}
+
+// parseNameVal parses ENV and LABEL arguments into name=value words.
+// The legacy "ENV name value" form is normalized to "name=value".
+func parseNameVal(command, rest string, escape rune) ([]string, error) {
+	words := splitWords(rest, escape)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%s requires at least one argument", command)
+	}
+
+	// Legacy form: the first word carries no '='
+	if !strings.Contains(words[0], "=") {
+		parts := whitespaceRegex.Split(strings.TrimSpace(rest), 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("%s must have two arguments", command)
+		}
+		return []string{parts[0] + "=" + parts[1]}, nil
+	}
+
+	for _, word := range words {
+		name, _, found := strings.Cut(word, "=")
+		if !found {
+			return nil, fmt.Errorf("syntax error - can't find = in %q. Must be of the form: name=value", word)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%s names can not be blank", command)
+		}
+	}
+
+	return words, nil
+}
+
+// parseHealthcheck parses "NONE" or "CMD <command>" healthcheck arguments
+func parseHealthcheck(rest string) ([]string, bool) {
+	parts := whitespaceRegex.Split(strings.TrimSpace(rest), 2)
+	if parts[0] == "" {
+		return nil, false
+	}
+
+	kind := strings.ToUpper(parts[0])
+	if kind != "CMD" || len(parts) < 2 {
+		return []string{kind}, false
+	}
+
+	command, execForm := parseMaybeJSON(parts[1])
+	return append([]string{kind}, command...), execForm
+}
+
+// canContainHeredoc reports whether an instruction accepts heredocs
+func canContainHeredoc(command string) bool {
+	return command == "RUN" || command == "COPY" || command == "ADD"
+}
+
+// parseHeredocWord recognizes a heredoc marker such as <<EOF, <<-EOF or <<"EOF"
+func parseHeredocWord(word string) (Heredoc, bool) {
+	match := heredocRegex.FindStringSubmatch(word)
+	if match == nil || strings.HasPrefix(match[3], "<") {
+		return Heredoc{}, false
+	}
+
+	name := match[3]
+	if end := strings.IndexAny(name, "<>|;&()"); end >= 0 {
+		name = name[:end]
+	}
+
+	unquoted := unquote(name, '\\')
+	if unquoted == "" {
+		return Heredoc{}, false
+	}
+
+	return Heredoc{
+		Name:   unquoted,
+		Expand: unquoted == name,
+		Chomp:  match[2] == "-",
+	}, true
+}
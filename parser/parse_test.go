@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parsed is the part of an instruction the parse tests compare
+type parsed struct {
+	Command       string
+	Line, EndLine int
+	Args          []string
+	ExecForm      bool
+	Script        string
+}
+
+func parseInstructions(t *testing.T, source string) (*Dockerfile, []parsed) {
+	t.Helper()
+	dockerfile, err := Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", source, err)
+	}
+	var got []parsed
+	for _, inst := range dockerfile.Instructions[1:] {
+		got = append(got, parsed{inst.Command, inst.Line, inst.EndLine, inst.Args, inst.ExecForm, inst.Script()})
+	}
+	return dockerfile, got
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, source string
+		want         []parsed
+	}{
+		{"escape directive",
+			"# escape=`\nFROM mcr.microsoft.com/windows/servercore\nCOPY testfile.txt c:\\\nRUN dir c:\\ && `\n    echo done\n",
+			[]parsed{
+				{"COPY", 3, 3, []string{"testfile.txt", `c:\`}, false, "testfile.txt"},
+				{"RUN", 4, 5, []string{`dir c:\ &&     echo done`}, false, `dir c:\ &&     echo done`},
+			}},
+		{"heredoc with the escape directive",
+			"# escape=`\nFROM alpine\nRUN <<EOF\napk add curl\nEOF\n",
+			[]parsed{{"RUN", 3, 5, []string{"<<EOF"}, false, "apk add curl\n"}}},
+		{"heredocs",
+			"FROM alpine\nRUN <<-'EOT' bash\n\techo $HOME\n\tEOT\nRUN cat <<A <<B > /x\na\nA\nb\nB\nCOPY <<EOF /etc/app.conf\nkey=value\nEOF\n",
+			[]parsed{
+				{"RUN", 2, 4, []string{"<<-'EOT' bash"}, false, "<<-'EOT' bash\necho $HOME\nEOT\n"},
+				{"RUN", 5, 9, []string{"cat <<A <<B > /x"}, false, "cat <<A <<B > /x\na\nA\nb\nB\n"},
+				{"COPY", 10, 12, []string{"<<EOF", "/etc/app.conf"}, false, "key=value\n"},
+			}},
+		{"JSON form",
+			"FROM alpine\nCMD [\"node\", \"server.js\"]\nCMD [node]\nCOPY [\"a b\", \"/dst/\"]\nENTRYPOINT [\"/bin/sh\", \"-c\", \"echo $HOME\"]\n",
+			[]parsed{
+				{"CMD", 2, 2, []string{"node", "server.js"}, true, "node server.js"},
+				{"CMD", 3, 3, []string{"[node]"}, false, "[node]"},
+				{"COPY", 4, 4, []string{"a b", "/dst/"}, true, "a b /dst/"},
+				{"ENTRYPOINT", 5, 5, []string{"/bin/sh", "-c", "echo $HOME"}, true, "/bin/sh -c echo $HOME"},
+			}},
+		{"continuation with comments",
+			"FROM alpine\nRUN apt-get update \\\n# comment\n\n    && apt-get install -y curl\nEXPOSE 80\n",
+			[]parsed{
+				{"RUN", 2, 5, []string{"apt-get update     && apt-get install -y curl"}, false, "apt-get update     && apt-get install -y curl"},
+				{"EXPOSE", 6, 6, []string{"80"}, false, "80"},
+			}},
+		{"ONBUILD",
+			"FROM alpine\nONBUILD COPY --chown=app . /app\nonbuild run npm install\n",
+			[]parsed{
+				{"ONBUILD", 2, 2, []string{"COPY --chown=app . /app"}, false, "COPY --chown=app . /app"},
+				{"ONBUILD", 3, 3, []string{"run npm install"}, false, "run npm install"},
+			}},
+	}
+	for _, tt := range tests {
+		_, got := parseInstructions(t, tt.source)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseEscape(t *testing.T) {
+	tests := []struct {
+		source string
+		want   rune
+	}{
+		{"FROM alpine\n", '\\'},
+		{"# escape=`\nFROM alpine\n", '`'},
+		{"# syntax=docker/dockerfile:1\n# escape=`\nFROM alpine\n", '`'},
+		// A directive after a comment is a comment
+		{"# note\n# escape=`\nFROM alpine\n", '\\'},
+	}
+	for _, tt := range tests {
+		dockerfile, _ := parseInstructions(t, tt.source)
+		if dockerfile.Escape != tt.want {
+			t.Errorf("Parse(%q) has escape %q, want %q", tt.source, dockerfile.Escape, tt.want)
+		}
+	}
+
+	for _, source := range []string{"# escape=$\nFROM alpine\n", "# escape=`\n# escape=\\\nFROM alpine\n"} {
+		if _, err := Parse(strings.NewReader(source)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestParseHeredocFields(t *testing.T) {
+	dockerfile, _ := parseInstructions(t, "FROM alpine\nRUN <<-'EOT' bash\n\techo $HOME\n\tEOT\n")
+	want := []Heredoc{{Name: "EOT", Body: "echo $HOME\n", Expand: false, Chomp: true, StartLine: 3, EndLine: 4}}
+	if got := dockerfile.Instructions[1].Heredocs; !reflect.DeepEqual(got, want) {
+		t.Errorf("got heredocs %+v, want %+v", got, want)
+	}
+}
+
+func TestParseContinuationComments(t *testing.T) {
+	dockerfile, _ := parseInstructions(t, "FROM alpine\nRUN apk add \\\n  # the client\n  curl\n")
+	want := []Comment{{Line: 3, Text: "the client"}}
+	if !reflect.DeepEqual(dockerfile.Comments, want) {
+		t.Errorf("got comments %+v, want %+v", dockerfile.Comments, want)
+	}
+}
+
+func TestParseOnbuild(t *testing.T) {
+	dockerfile, _ := parseInstructions(t, "FROM alpine\nONBUILD COPY --chown=app . /app\nONBUILD RUN npm install\n")
+	tests := []struct {
+		command string
+		args    []string
+		chown   string
+	}{
+		{"COPY", []string{".", "/app"}, "app"},
+		{"RUN", []string{"npm install"}, ""},
+	}
+	for i, tt := range tests {
+		trigger := dockerfile.Instructions[i+1].Trigger
+		if trigger == nil {
+			t.Errorf("ONBUILD at line %d has no trigger", i+2)
+			continue
+		}
+		chown, _ := trigger.FlagValue("chown")
+		if trigger.Command != tt.command || !reflect.DeepEqual(trigger.Args, tt.args) || chown != tt.chown {
+			t.Errorf("ONBUILD at line %d triggers %s %q with --chown=%q, want %s %q with --chown=%q", i+2, trigger.Command, trigger.Args, chown, tt.command, tt.args, tt.chown)
+		}
+	}
+}
+
+func TestIsBareHeredoc(t *testing.T) {
+	tests := []struct {
+		command string
+		escape  rune
+		want    bool
+	}{
+		{"<<EOF", '\\', true},
+		{"<<-'EOF'", '\\', true},
+		{"<<EOF bash", '\\', false},
+		{"cat <<EOF", '\\', false},
+		// The escape character keeps a space inside the word
+		{"<<EOF\\ bash", '\\', true},
+		{"<<EOF\\ bash", '`', false},
+	}
+	for _, tt := range tests {
+		if got := isBareHeredoc(tt.command, tt.escape); got != tt.want {
+			t.Errorf("isBareHeredoc(%q, %q) = %v, want %v", tt.command, tt.escape, got, tt.want)
+		}
+	}
+}
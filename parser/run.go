@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+// defaultShell is the shell used for shell form instructions without SHELL
+var defaultShell = []string{"/bin/sh", "-c"}
+
+// parseRunScript parses the command of a RUN instruction into a shell AST.
+// Scripts for shells that are not POSIX compatible, such as PowerShell or a
+// heredoc with a python shebang, are left unparsed and return nil.
+func parseRunScript(inst Instruction, shellCmd []string) *shell.Script {
+	if len(inst.Args) == 0 {
+		return nil
+	}
+
+	if inst.ExecForm {
+		script := shell.FromArgv(inst.Args)
+		if inline := script.Commands()[0].InlineScript(); inline != nil {
+			return inline
+		}
+		return script
+	}
+
+	if len(shellCmd) == 0 || !shell.IsShell(shellCmd[0]) {
+		return nil
+	}
+
+	source := inst.Script()
+	if interpreter, ok := shebang(source); ok && !shell.IsShell(interpreter) {
+		return nil
+	}
+
+	// A syntax error keeps the commands parsed before it
+	script, _ := shell.Parse(source)
+	return script
+}
+
+// shebang returns the interpreter named by a #! line, skipping /usr/bin/env
+func shebang(source string) (string, bool) {
+	if !strings.HasPrefix(source, "#!") {
+		return "", false
+	}
+	line, _, _ := strings.Cut(source[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+	if strings.HasSuffix(fields[0], "/env") && len(fields) > 1 {
+		return fields[1], true
+	}
+	return fields[0], true
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Options controls how a Dockerfile is parsed
+type Options struct {
+	// BuildArgs overrides ARG values, like --build-arg KEY=VALUE for docker build
+	BuildArgs map[string]string
+}
+
+// variableScope holds the ARG and ENV values visible while parsing
+type variableScope struct {
+	buildArgs  map[string]string
+	builtins   map[string]string
+	globalArgs map[string]string
+	stages     []stageScope
+}
+
+// stageScope holds the variables declared inside one stage
+type stageScope struct {
+	name  string
+	args  map[string]string
+	env   map[string]string
+	shell []string // Set by SHELL, inherited from a parent stage
+}
+
+// newVariableScope creates the scope used before the first FROM
+func newVariableScope(buildArgs map[string]string) *variableScope {
+	return &variableScope{
+		buildArgs:  buildArgs,
+		builtins:   platformArgs(),
+		globalArgs: map[string]string{},
+	}
+}
+
+// platformArgs returns the automatic platform ARGs for the host platform
+func platformArgs() map[string]string {
+	platform := "linux/" + runtime.GOARCH
+	return map[string]string{
+		"BUILDPLATFORM":  platform,
+		"BUILDOS":        "linux",
+		"BUILDARCH":      runtime.GOARCH,
+		"TARGETPLATFORM": platform,
+		"TARGETOS":       "linux",
+		"TARGETARCH":     runtime.GOARCH,
+	}
+}
+
+// current returns the scope of the stage being parsed, or nil before FROM
+func (v *variableScope) current() *stageScope {
+	if len(v.stages) == 0 {
+		return nil
+	}
+	return &v.stages[len(v.stages)-1]
+}
+
+// lookupGlobal resolves a variable visible to FROM instructions
+func (v *variableScope) lookupGlobal(name string) (string, bool) {
+	if value, ok := v.globalArgs[name]; ok {
+		return value, true
+	}
+	if value, ok := v.buildArgs[name]; ok {
+		if _, builtin := v.builtins[name]; builtin {
+			return value, true
+		}
+	}
+	value, ok := v.builtins[name]
+	return value, ok
+}
+
+// lookupStage resolves a variable inside the current stage; ENV wins over ARG
+func (v *variableScope) lookupStage(name string) (string, bool) {
+	stage := v.current()
+	if value, ok := stage.env[name]; ok {
+		return value, true
+	}
+	value, ok := stage.args[name]
+	return value, ok
+}
+
+// expand substitutes variables in the arguments of an instruction and records
+// the ARG and ENV declarations it makes
+func (v *variableScope) expand(inst *Instruction, escape rune) error {
+	if inst.Command == "FROM" {
+		return v.enterStage(inst, escape)
+	}
+
+	stage := v.current()
+	if stage == nil {
+		global := wordExpander{escape: escape, lookup: v.lookupGlobal}
+		if inst.Command == "ARG" {
+			return v.declareArgs(inst, global, v.globalArgs, nil)
+		}
+		return expandArgs(inst, global)
+	}
+
+	local := wordExpander{escape: escape, lookup: v.lookupStage}
+	switch inst.Command {
+	case "ARG":
+		return v.declareArgs(inst, local, stage.args, v.globalArgs)
+	case "ENV":
+		if err := expandArgs(inst, local); err != nil {
+			return err
+		}
+		for _, arg := range inst.Args {
+			name, value, _ := strings.Cut(arg, "=")
+			stage.env[name] = value
+		}
+		return nil
+	case "SHELL":
+		stage.shell = inst.Args
+		return nil
+	case "RUN":
+		inst.Shell = parseRunScript(*inst, stage.shell)
+		return nil
+	case "COPY", "ADD":
+		if err := expandFlags(inst, local); err != nil {
+			return err
+		}
+		return expandArgs(inst, local)
+	default:
+		if wordCommands[inst.Command] {
+			return expandArgs(inst, local)
+		}
+		return nil
+	}
+}
+
+// enterStage expands a FROM instruction with the global ARGs and opens the
+// scope of the new stage, inheriting ENV from a parent stage
+func (v *variableScope) enterStage(inst *Instruction, escape rune) error {
+	global := wordExpander{escape: escape, lookup: v.lookupGlobal}
+	if err := expandFlags(inst, global); err != nil {
+		return err
+	}
+	if err := expandArgs(inst, global); err != nil {
+		return err
+	}
+
+	stage := stageScope{
+		args:  map[string]string{},
+		env:   map[string]string{},
+		shell: defaultShell,
+	}
+	if len(inst.Args) > 2 && strings.EqualFold(inst.Args[1], "AS") {
+		stage.name = strings.ToLower(inst.Args[2])
+	}
+
+	if len(inst.Args) > 0 {
+		if parent := v.findStage(inst.Args[0]); parent != nil {
+			for name, value := range parent.env {
+				stage.env[name] = value
+			}
+			stage.shell = parent.shell
+		}
+	}
+
+	v.stages = append(v.stages, stage)
+	return nil
+}
+
+// findStage returns the scope of an earlier stage by name or index
+func (v *variableScope) findStage(ref string) *stageScope {
+	ref = strings.ToLower(ref)
+	for i := range v.stages {
+		if v.stages[i].name == ref && ref != "" {
+			return &v.stages[i]
+		}
+	}
+	if index, err := strconv.Atoi(ref); err == nil && index >= 0 && index < len(v.stages) {
+		return &v.stages[index]
+	}
+	return nil
+}
+
+// declareArgs records ARG declarations. A --build-arg override wins over the
+// default; an ARG without a default inside a stage inherits the global value.
+func (v *variableScope) declareArgs(inst *Instruction, expander wordExpander, target, inherited map[string]string) error {
+	for i, arg := range inst.Args {
+		name, defaultValue, hasDefault := strings.Cut(arg, "=")
+		name, err := expander.process(name)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", inst.Line, err)
+		}
+
+		if hasDefault {
+			defaultValue, err = expander.process(defaultValue)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", inst.Line, err)
+			}
+			inst.Args[i] = name + "=" + defaultValue
+		} else {
+			inst.Args[i] = name
+		}
+
+		switch value, ok := v.buildArgs[name]; {
+		case ok:
+			target[name] = value
+		case hasDefault:
+			target[name] = defaultValue
+		default:
+			if value, ok := inherited[name]; ok {
+				target[name] = value
+			} else if value, ok := v.builtins[name]; ok && inherited != nil {
+				target[name] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandArgs processes every argument word of an instruction
+func expandArgs(inst *Instruction, expander wordExpander) error {
+	for i, arg := range inst.Args {
+		value, err := expander.process(arg)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", inst.Line, err)
+		}
+		inst.Args[i] = value
+	}
+	return nil
+}
+
+// expandFlags processes the values of the builder flags of an instruction
+func expandFlags(inst *Instruction, expander wordExpander) error {
+	for i, flag := range inst.Flags {
+		value, err := expander.process(flag.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", inst.Line, err)
+		}
+		inst.Flags[i].Value = value
+	}
+	return nil
+}
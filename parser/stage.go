@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Stage represents a build stage started by a FROM instruction
+type Stage struct {
+	Name         string            // Name given with "AS", lower-cased
+	Index        int               // Position of the stage in the Dockerfile
+	BaseImage    string            // Image or stage named by FROM
+	Platform     string            // Value of the --platform flag
+	From         Instruction       // The FROM instruction that starts the stage
+	Instructions []Instruction     // Instructions after FROM, up to the next stage
+	Parent       *Stage            // Stage used as the base image, if any
+	DependsOn    []int             // Indexes of stages referenced by FROM, COPY --from and RUN --mount
+	Args         map[string]string // ARG values in scope at the end of the stage
+	Env          map[string]string // ENV values at the end of the stage, including inherited ones
+}
+
+// String returns the stage name, or "stage-N" when the stage is unnamed
+func (s *Stage) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "stage-" + strconv.Itoa(s.Index)
+}
+
+// Root returns the first stage in the FROM chain, whose base image is external
+func (s *Stage) Root() *Stage {
+	stage := s
+	for stage.Parent != nil {
+		stage = stage.Parent
+	}
+	return stage
+}
+
+// Lineage returns the stage followed by the stages it is built from
+func (s *Stage) Lineage() []*Stage {
+	var stages []*Stage
+	for stage := s; stage != nil; stage = stage.Parent {
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// GetInstructionsByType returns all instructions of a specific type in the stage
+func (s *Stage) GetInstructionsByType(command string) []Instruction {
+	var result []Instruction
+	command = strings.ToUpper(command)
+
+	for _, inst := range s.Instructions {
+		if inst.Command == command {
+			result = append(result, inst)
+		}
+	}
+
+	return result
+}
+
+// HasInstruction checks if the stage, or a stage it is built from, has a
+// specific instruction
+func (s *Stage) HasInstruction(command string) bool {
+	for stage := s; stage != nil; stage = stage.Parent {
+		if len(stage.GetInstructionsByType(command)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// User returns the USER in effect at the end of the stage and the instruction
+// that set it. Stages built from another stage inherit its user.
+func (s *Stage) User() (string, *Instruction) {
+	for stage := s; stage != nil; stage = stage.Parent {
+		users := stage.GetInstructionsByType("USER")
+		for i := len(users) - 1; i >= 0; i-- {
+			if len(users[i].Args) > 0 {
+				return users[i].Args[0], &users[i]
+			}
+		}
+	}
+	return "", nil
+}
+
+// buildStages splits the instructions into stages and links their dependencies
+func buildStages(instructions []Instruction) []*Stage {
+	var stages []*Stage
+
+	for i := range instructions {
+		inst := &instructions[i]
+		if inst.Command == "FROM" {
+			inst.Stage = len(stages)
+			stage := &Stage{
+				Index: len(stages),
+				From:  *inst,
+			}
+			if len(inst.Args) > 0 {
+				stage.BaseImage = inst.Args[0]
+			}
+			if len(inst.Args) > 2 && strings.EqualFold(inst.Args[1], "AS") {
+				stage.Name = strings.ToLower(inst.Args[2])
+			}
+			stage.Platform, _ = inst.FlagValue("platform")
+			stages = append(stages, stage)
+			continue
+		}
+
+		inst.Stage = len(stages) - 1
+		if inst.Stage >= 0 {
+			stage := stages[inst.Stage]
+			stage.Instructions = append(stage.Instructions, *inst)
+		}
+	}
+
+	for _, stage := range stages {
+		if parent := lookupStage(stages[:stage.Index], stage.BaseImage); parent != nil {
+			stage.Parent = parent
+			stage.addDependency(parent.Index)
+		}
+
+		for _, inst := range stage.Instructions {
+			for _, ref := range stageReferences(inst) {
+				if dep := lookupStage(stages[:stage.Index], ref); dep != nil {
+					stage.addDependency(dep.Index)
+				}
+			}
+		}
+	}
+
+	return stages
+}
+
+// addDependency records a dependency on another stage once
+func (s *Stage) addDependency(index int) {
+	for _, existing := range s.DependsOn {
+		if existing == index {
+			return
+		}
+	}
+	s.DependsOn = append(s.DependsOn, index)
+}
+
+// stageReferences returns the stage names used by COPY --from and RUN --mount=from=
+func stageReferences(inst Instruction) []string {
+	var refs []string
+
+	if from, ok := inst.FlagValue("from"); ok && (inst.Command == "COPY" || inst.Command == "ADD") {
+		refs = append(refs, from)
+	}
+
+	if inst.Command == "RUN" {
+		for _, mount := range inst.FlagValues("mount") {
+			for _, option := range strings.Split(mount, ",") {
+				if key, value, ok := strings.Cut(option, "="); ok && key == "from" {
+					refs = append(refs, value)
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// lookupStage finds a stage by name or numeric index
+func lookupStage(stages []*Stage, ref string) *Stage {
+	if ref == "" {
+		return nil
+	}
+
+	ref = strings.ToLower(ref)
+	for _, stage := range stages {
+		if stage.Name == ref {
+			return stage
+		}
+	}
+
+	if index, err := strconv.Atoi(ref); err == nil && index >= 0 && index < len(stages) {
+		return stages[index]
+	}
+
+	return nil
+}
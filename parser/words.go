@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitWords splits arguments on whitespace while keeping quoted sections and
+// escaped characters together. Quotes and escapes are preserved in the words.
+func splitWords(s string, escape rune) []string {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	escaped := false
+
+	for _, ch := range s {
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case ch == escape:
+			word.WriteRune(ch)
+			escaped = true
+			inWord = true
+		case quote != 0:
+			word.WriteRune(ch)
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			word.WriteRune(ch)
+			quote = ch
+			inWord = true
+		case unicode.IsSpace(ch):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// unquote removes quotes and escape characters from a word the same way the
+// builder does before it uses the value, without substituting variables
+func unquote(word string, escape rune) string {
+	value, _ := wordExpander{escape: escape}.process(word)
+	return value
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/fix"
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// runPin implements "dock-slimcheck pin": it rewrites every FROM image of a
+// Dockerfile as image:tag@sha256:... and returns the exit code
+func runPin(args []string) int {
+	flags := flag.NewFlagSet("pin", flag.ContinueOnError)
+	dryRunFlag := flags.Bool("dry-run", false, "Print a unified diff instead of writing the file")
+	sourceFlag := flags.String("source", "auto", "Where digests are looked up: auto (local runtime, then registry), runtime or registry")
+	runtimeFlag := flags.String("runtime", "auto", "Container runtime holding pulled images: auto, docker-api, docker, podman or nerdctl")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dock-slimcheck pin [--dry-run] [--source auto|runtime|registry] [--runtime NAME] ./Dockerfile")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitClean
+		}
+		return exitError
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+	path := flags.Arg(0)
+
+	resolver, err := pinResolver(*sourceFlag, *runtimeFlag)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return exitError
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error: could not read Dockerfile: %s\n", err)
+		return exitError
+	}
+	// ARG defaults are pinned as written, so no --build-arg is applied
+	dockerfile, err := parser.ParseDockerfile(path)
+	if err != nil {
+		fmt.Printf("Error parsing Dockerfile: %s\n", err)
+		return exitError
+	}
+
+	logOut := os.Stdout
+	if *dryRunFlag {
+		logOut = os.Stderr
+	}
+	pinned, pins := fix.PinDigests(dockerfile, source, resolver)
+	code := exitClean
+	for _, pin := range pins {
+		via := ""
+		if pin.Arg != "" {
+			via = fmt.Sprintf(" (ARG %s)", pin.Arg)
+		}
+		if pin.Skipped != "" {
+			fmt.Fprintf(logOut, "[SKIP] line %d: %s%s: %s\n", pin.Line, pin.Image, via, pin.Skipped)
+			code = exitBelowThreshold
+			continue
+		}
+		fmt.Fprintf(logOut, "[PIN] line %d: %s → %s%s\n", pin.Line, pin.Image, pin.Pinned, via)
+	}
+	if len(pins) == 0 {
+		fmt.Fprintln(logOut, "[PIN] every FROM image is already pinned")
+	}
+
+	if *dryRunFlag {
+		oldName, newName := filepath.ToSlash(path), filepath.ToSlash(path)
+		if !filepath.IsAbs(path) {
+			oldName, newName = "a/"+oldName, "b/"+newName
+		}
+		fmt.Print(fix.UnifiedDiff(oldName, newName, source, pinned))
+		return code
+	}
+	if string(pinned) == string(source) {
+		return code
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return exitError
+	}
+	if err := os.WriteFile(path, pinned, info.Mode().Perm()); err != nil {
+		fmt.Printf("Error: could not write Dockerfile: %s\n", err)
+		return exitError
+	}
+	return code
+}
+
+// pinResolver builds the digest lookup for --source
+func pinResolver(source, runtimeName string) (fix.DigestResolver, error) {
+	var resolvers fix.Resolvers
+	if source == "auto" || source == "runtime" {
+		runtime, err := container.Select(runtimeName)
+		switch {
+		case err == nil:
+			resolvers = append(resolvers, fix.RuntimeResolver{Runtime: runtime})
+		case source == "runtime" || runtimeName != "auto":
+			return nil, fmt.Errorf("--runtime: %s", err)
+		}
+	}
+	if source == "auto" || source == "registry" {
+		client, err := registry.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, fix.RegistryResolver{Client: client})
+	}
+	if resolvers == nil {
+		return nil, fmt.Errorf("unknown --source %q, expected auto, runtime or registry", source)
+	}
+	return resolvers, nil
+}
@@ -0,0 +1,317 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manifest media types, in the order they are accepted
+const (
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+const (
+	manifestAccept      = MediaTypeOCIIndex + ", " + MediaTypeDockerList + ", " + MediaTypeOCIManifest + ", " + MediaTypeDockerManifest
+	maxManifestSize     = 4 << 20 // Bytes read from a manifest, config or token response
+	contentDigestHeader = "Docker-Content-Digest"
+	authenticateHeader  = "WWW-Authenticate"
+	tokenClientID       = "dock-slimcheck" // client_id sent with OAuth token requests
+	requestTimeout      = 30 * time.Second // Limit of one request, which reads a small document or a blob trailer
+)
+
+// defaultHTTP is used by clients without an HTTP client of their own
+var defaultHTTP = &http.Client{Timeout: requestTimeout}
+
+// Client reads manifests and blobs over the Distribution v2 API. Registries
+// asking for a bearer token get one from their token service, with the
+// Keychain credentials when there are any.
+type Client struct {
+	HTTP     *http.Client // Defaults to a client with a 30 second timeout
+	Keychain Keychain     // Anonymous access when nil
+
+	// PlainHTTP lists registry hosts spoken to over http instead of https.
+	// Loopback hosts such as localhost:5000 always use http, as docker
+	// allows them without TLS.
+	PlainHTTP map[string]bool
+
+	mu     sync.Mutex
+	tokens map[string]string // Authorization header values by registry and repository
+}
+
+// NewClient returns a client using the credentials of ~/.docker/config.json
+func NewClient() (*Client, error) {
+	config, err := DefaultDockerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{HTTP: &http.Client{Timeout: requestTimeout}, Keychain: config}, nil
+}
+
+// registryError is the error body of the Distribution API
+type registryError struct {
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// tokenResponse is the answer of a token service
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// get fetches a registry API path for a repository, authenticating when
+// the registry asks for it. A non-2xx response is returned as an error.
+func (c *Client) get(ref Reference, path string, header http.Header) (*http.Response, error) {
+	return c.request(http.MethodGet, ref, path, header)
+}
+
+// request sends a GET or HEAD request for a registry API path
+func (c *Client) request(method string, ref Reference, path string, header http.Header) (*http.Response, error) {
+	target := c.baseURL(ref) + "/v2/" + ref.Repository + path
+	key := ref.Registry + "/" + ref.Repository
+
+	resp, err := c.send(method, target, header, c.token(key))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get(authenticateHeader)
+		resp.Body.Close()
+		authorization, err := c.authorize(ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.setToken(key, authorization)
+		if resp, err = c.send(method, target, header, authorization); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// send performs one request
+func (c *Client) send(method, target string, header http.Header, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach registry: %v", err)
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with the value of the
+// Authorization header to retry with
+func (c *Client) authorize(ref Reference, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	creds, found, err := c.credentials(ref.Registry)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !found || creds.Username == "" {
+			return "", fmt.Errorf("%s requires credentials, log in with docker login %s", ref.Registry, ref.Registry)
+		}
+		return "Basic " + basicAuth(creds.Username, creds.Password), nil
+	case "bearer":
+		if params["realm"] == "" {
+			return "", fmt.Errorf("%s sent a bearer challenge without a realm", ref.Registry)
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = "repository:" + ref.Repository + ":pull"
+		}
+		token, err := c.fetchToken(params["realm"], params["service"], scope, creds, found)
+		if err != nil && !found {
+			return "", fmt.Errorf("could not authenticate to %s anonymously, log in with docker login %s: %v", ref.Registry, ref.Registry, err)
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not authenticate to %s: %v", ref.Registry, err)
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("%s asks for unsupported authentication %q", ref.Registry, scheme)
+}
+
+// fetchToken gets a pull token from a token service: with a GET and basic
+// credentials, or with the OAuth refresh flow for identity tokens
+func (c *Client) fetchToken(realm, service, scope string, creds Credentials, found bool) (string, error) {
+	var req *http.Request
+	var err error
+	if found && creds.IdentityToken != "" {
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", creds.IdentityToken)
+		form.Set("service", service)
+		form.Set("scope", scope)
+		form.Set("client_id", tokenClientID)
+		req, err = http.NewRequest(http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{}
+		if service != "" {
+			query.Set("service", service)
+		}
+		query.Set("scope", scope)
+		separator := "?"
+		if strings.Contains(realm, "?") {
+			separator = "&"
+		}
+		req, err = http.NewRequest(http.MethodGet, realm+separator+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if found && creds.Username != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service answered %s", resp.Status)
+	}
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("could not parse the token response: %v", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+	return "", errors.New("token service returned no token")
+}
+
+// credentials looks the registry up in the keychain, if any
+func (c *Client) credentials(registry string) (Credentials, bool, error) {
+	if c.Keychain == nil {
+		return Credentials{}, false, nil
+	}
+	return c.Keychain.Credentials(registry)
+}
+
+func (c *Client) token(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[key]
+}
+
+func (c *Client) setToken(key, authorization string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[key] = authorization
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return defaultHTTP
+}
+
+// baseURL returns the scheme and host of the registry API
+func (c *Client) baseURL(ref Reference) string {
+	host := ref.Endpoint()
+	if c.PlainHTTP[host] || isLoopback(host) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// isLoopback reports whether a host, with or without a port, is local
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// basicAuth encodes credentials for a Basic Authorization header
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// parseChallenge splits a WWW-Authenticate value such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[name] = value[1:]
+				break
+			}
+			params[name] = value[1 : end+1]
+			rest = value[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[name] = strings.TrimSpace(value)
+		}
+	}
+	return scheme, params
+}
+
+// responseError reads the message of a Distribution API error response
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var apiErr registryError
+	if err := json.Unmarshal(body, &apiErr); err == nil && len(apiErr.Errors) > 0 {
+		var messages []string
+		for _, e := range apiErr.Errors {
+			messages = append(messages, strings.ToLower(e.Code)+": "+e.Message)
+		}
+		return fmt.Errorf("registry answered %s: %s", resp.Status, strings.Join(messages, "; "))
+	}
+	return fmt.Errorf("registry answered %s", resp.Status)
+}
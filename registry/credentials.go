@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials authenticate to one registry
+type Credentials struct {
+	Username      string
+	Password      string
+	IdentityToken string // OAuth refresh token stored by "docker login" for some registries
+}
+
+// Keychain finds the credentials for a registry host
+type Keychain interface {
+	// Credentials returns the credentials for a registry, and false when
+	// the registry should be accessed anonymously
+	Credentials(registry string) (Credentials, bool, error)
+}
+
+// DockerConfig is the credential part of ~/.docker/config.json
+type DockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+// dockerAuth is one entry of the auths section
+type dockerAuth struct {
+	Auth          string `json:"auth"` // base64 of "username:password"
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// helperCredentials is the output of a docker-credential-* helper
+type helperCredentials struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// hubAuthKey is the key "docker login" stores Docker Hub credentials under
+const hubAuthKey = "https://index.docker.io/v1/"
+
+// LoadDockerConfig reads a docker config.json. A missing file is an empty
+// configuration.
+func LoadDockerConfig(path string) (*DockerConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &DockerConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config DockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// DefaultDockerConfig reads config.json from DOCKER_CONFIG, or ~/.docker
+func DefaultDockerConfig() (*DockerConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &DockerConfig{}, nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	return LoadDockerConfig(filepath.Join(dir, "config.json"))
+}
+
+// Credentials looks the registry up in credHelpers, then in the auths
+// section, then in the credsStore helper
+func (c *DockerConfig) Credentials(registry string) (Credentials, bool, error) {
+	if helper, ok := c.CredHelpers[registry]; ok {
+		return helperLookup(helper, registry)
+	}
+
+	for key, auth := range c.Auths {
+		if authHost(key) != registry && !(registry == DockerHub && key == hubAuthKey) {
+			continue
+		}
+		creds := Credentials{Username: auth.Username, Password: auth.Password, IdentityToken: auth.IdentityToken}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, false, fmt.Errorf("invalid auth for %s in docker config: %v", key, err)
+			}
+			creds.Username, creds.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		if creds.Username != "" || creds.IdentityToken != "" {
+			return creds, true, nil
+		}
+	}
+
+	if c.CredsStore != "" {
+		return helperLookup(c.CredsStore, registry)
+	}
+	return Credentials{}, false, nil
+}
+
+// authHost returns the host of an auths key, which may be a URL such as
+// https://index.docker.io/v1/
+func authHost(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	if host == "index.docker.io" || host == dockerHubEndpoint {
+		return DockerHub
+	}
+	return host
+}
+
+// helperLookup asks a docker-credential-<helper> program for credentials.
+// A registry unknown to the helper is accessed anonymously.
+func helperLookup(helper, registry string) (Credentials, bool, error) {
+	server := registry
+	if registry == DockerHub {
+		server = hubAuthKey
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(message, "credentials not found") {
+			return Credentials{}, false, nil
+		}
+		return Credentials{}, false, fmt.Errorf("credential helper %s failed: %v: %s", helper, err, message)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return Credentials{}, false, fmt.Errorf("could not parse the output of credential helper %s: %v", helper, err)
+	}
+	// Helpers store identity tokens under the username "<token>"
+	if creds.Username == "<token>" {
+		return Credentials{IdentityToken: creds.Secret}, true, nil
+	}
+	return Credentials{Username: creds.Username, Password: creds.Secret}, true, nil
+}
+
+// StaticKeychain holds credentials by registry host
+type StaticKeychain map[string]Credentials
+
+// Credentials returns the credentials stored for the registry
+func (k StaticKeychain) Credentials(registry string) (Credentials, bool, error) {
+	creds, ok := k[registry]
+	return creds, ok, nil
+}
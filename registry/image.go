@@ -0,0 +1,298 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+)
+
+// Image describes an image in a registry, read without pulling it
+type Image struct {
+	Reference string   // Fully qualified reference that was inspected
+	Digest    string   // Digest of the manifest or index the reference points to
+	Platforms []string // Platforms of a multi-platform index, such as linux/arm64/v8
+	Platform  string   // Platform whose manifest Layers come from
+
+	// Layers from the bottom of the image up. Size is the size of the
+	// uncompressed layer tar, -1 when it could not be determined, and
+	// LargestFiles is empty.
+	Layers  []*archive.Layer
+	History []*archive.History // Config history entries, oldest first
+}
+
+// CompressedSize returns the bytes of all layer blobs, as downloaded by a pull
+func (img *Image) CompressedSize() int64 {
+	var total int64
+	for _, layer := range img.Layers {
+		total += layer.CompressedSize
+	}
+	return total
+}
+
+// Size returns the uncompressed bytes of all layers, or -1 when the size
+// of a layer is unknown
+func (img *Image) Size() int64 {
+	var total int64
+	for _, layer := range img.Layers {
+		if layer.Size < 0 {
+			return -1
+		}
+		total += layer.Size
+	}
+	return total
+}
+
+// descriptor points to a manifest or blob
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// platform is the platform of an index entry
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String formats the platform as os/architecture[/variant]
+func (p platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// manifest is an image manifest or an index, told apart by their fields
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+// imageConfig is the part of the image config blob that is read
+type imageConfig struct {
+	Architecture string             `json:"architecture"`
+	OS           string             `json:"os"`
+	Variant      string             `json:"variant"`
+	History      []*archive.History `json:"history"`
+}
+
+// DefaultPlatform is the platform picked from multi-platform images when
+// none is asked for: linux on the architecture the tool runs on
+func DefaultPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// Inspect reads the manifest and config of an image. For multi-platform
+// images it lists the platforms and describes the one matching platform,
+// "os/arch[/variant]", or DefaultPlatform when empty. Layer sizes come from
+// the manifest; uncompressed sizes are read from the end of each gzip blob
+// with a range request, so no layer is downloaded in full.
+func (c *Client) Inspect(reference, platformName string) (*Image, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	if platformName == "" {
+		platformName = DefaultPlatform()
+	}
+
+	m, digest, err := c.fetchManifest(ref, ref.manifestRef())
+	if err != nil {
+		return nil, fmt.Errorf("could not read the manifest of %s: %v", ref, err)
+	}
+	img := &Image{Reference: ref.String(), Digest: digest}
+
+	if len(m.Manifests) > 0 {
+		var chosen *descriptor
+		for i, entry := range m.Manifests {
+			// Skip attestation manifests, which are not runnable images
+			if entry.Platform == nil || entry.Platform.OS == "unknown" || entry.Annotations["vnd.docker.reference.type"] != "" {
+				continue
+			}
+			name := entry.Platform.String()
+			img.Platforms = append(img.Platforms, name)
+			if chosen == nil && platformMatches(name, platformName) {
+				chosen = &m.Manifests[i]
+			}
+		}
+		if chosen == nil {
+			return nil, fmt.Errorf("%s has no %s image, it supports %s", ref, platformName, strings.Join(img.Platforms, ", "))
+		}
+		img.Platform = chosen.Platform.String()
+		if m, _, err = c.fetchManifest(ref, chosen.Digest); err != nil {
+			return nil, fmt.Errorf("could not read the %s manifest of %s: %v", img.Platform, ref, err)
+		}
+	}
+	if len(m.Layers) == 0 && m.SchemaVersion == 1 {
+		return nil, fmt.Errorf("%s uses the deprecated schema 1 manifest format, which is not supported", ref)
+	}
+
+	var config imageConfig
+	if err := c.fetchJSON(ref, m.Config.Digest, &config); err != nil {
+		return nil, fmt.Errorf("could not read the config of %s: %v", ref, err)
+	}
+	if img.Platform == "" {
+		img.Platform = platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}.String()
+	}
+	if len(img.Platforms) == 0 {
+		img.Platforms = []string{img.Platform}
+	}
+	img.History = config.History
+
+	for i, blob := range m.Layers {
+		layer := &archive.Layer{Index: i, Digest: blob.Digest, CompressedSize: blob.Size}
+		layer.Size, err = c.uncompressedSize(ref, blob)
+		if err != nil {
+			return nil, fmt.Errorf("could not measure layer %s of %s: %v", blob.Digest, ref, err)
+		}
+		img.Layers = append(img.Layers, layer)
+	}
+
+	// Non-empty history entries created the layers, in order
+	next := 0
+	for _, entry := range img.History {
+		if entry.EmptyLayer || next >= len(img.Layers) {
+			continue
+		}
+		entry.Layer = img.Layers[next]
+		img.Layers[next].History = entry
+		next++
+	}
+	return img, nil
+}
+
+// Digest returns the digest a tag currently points to: that of the index
+// for multi-platform images, which is what a pinned FROM should name. It
+// asks with a HEAD request, which registries such as Docker Hub do not
+// count against pull rate limits, and reads the manifest only when the
+// registry does not report the digest.
+func (c *Client) Digest(reference string) (string, error) {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	resp, err := c.request(http.MethodHead, ref, "/manifests/"+ref.Tag, http.Header{"Accept": {manifestAccept}})
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %v", ref, err)
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get(contentDigestHeader); digest != "" {
+		return digest, nil
+	}
+
+	_, digest, err := c.fetchManifest(ref, ref.Tag)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %v", ref, err)
+	}
+	return digest, nil
+}
+
+// fetchManifest reads a manifest or index by tag or digest and returns the
+// digest the registry reports for it
+func (c *Client) fetchManifest(ref Reference, tagOrDigest string) (*manifest, string, error) {
+	resp, err := c.get(ref, "/manifests/"+tagOrDigest, http.Header{"Accept": {manifestAccept}})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	digest := resp.Header.Get(contentDigestHeader)
+	if digest == "" && strings.HasPrefix(tagOrDigest, "sha256:") {
+		digest = tagOrDigest
+	}
+	if digest == "" {
+		digest = sha256Digest(data)
+	}
+	return &m, digest, nil
+}
+
+// fetchJSON decodes a small blob such as the image config
+func (c *Client) fetchJSON(ref Reference, digest string, v interface{}) error {
+	resp, err := c.get(ref, "/blobs/"+digest, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(v)
+}
+
+// uncompressedSize returns the size of a layer tar. Uncompressed layers are
+// their blob size. A gzip stream ends with the uncompressed size modulo
+// 2^32, which is read with a range request; the size is then raised by 4GiB
+// steps until it is at least the compressed size. Other compressions, such
+// as zstd, and registries ignoring the range give -1.
+func (c *Client) uncompressedSize(ref Reference, blob descriptor) (int64, error) {
+	switch {
+	case strings.HasSuffix(blob.MediaType, ".tar"), strings.HasSuffix(blob.MediaType, "tar.diff"):
+		return blob.Size, nil
+	case !strings.Contains(blob.MediaType, "gzip"):
+		return -1, nil
+	case blob.Size < 18:
+		return -1, nil
+	}
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", blob.Size-4, blob.Size-1)}}
+	resp, err := c.get(ref, "/blobs/"+blob.Digest, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return -1, nil
+	}
+
+	var trailer [4]byte
+	if _, err := io.ReadFull(resp.Body, trailer[:]); err != nil {
+		return 0, err
+	}
+	size := int64(binary.LittleEndian.Uint32(trailer[:]))
+	for size < blob.Size {
+		size += 1 << 32
+	}
+	return size, nil
+}
+
+// platformMatches compares os/arch[/variant] names. A wanted name without a
+// variant matches any variant.
+func platformMatches(have, want string) bool {
+	if have == want {
+		return true
+	}
+	haveParts, wantParts := strings.Split(have, "/"), strings.Split(want, "/")
+	if len(wantParts) == 2 && len(haveParts) == 3 {
+		return haveParts[0] == wantParts[0] && haveParts[1] == wantParts[1]
+	}
+	return false
+}
+
+// sha256Digest returns the digest of content the registry did not name
+func sha256Digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Docker Hub names, as the docker command line resolves them
+const (
+	DockerHub         = "docker.io"
+	dockerHubEndpoint = "registry-1.docker.io"
+	officialPrefix    = "library/"
+)
+
+// repositoryPattern is the repository syntax of the Distribution spec
+var repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// Reference is a parsed image reference such as nginx:1.25 or
+// ghcr.io/org/app@sha256:...
+type Reference struct {
+	Registry   string // Registry host, "docker.io" for Docker Hub
+	Repository string // Repository path, with "library/" for official Hub images
+	Tag        string // Tag, "latest" when neither a tag nor a digest is given
+	Digest     string // Digest the reference is pinned to, if any
+}
+
+// ParseReference parses an image reference the way the docker command line
+// does: the first path component is a registry host when it contains a dot
+// or a colon or is "localhost"
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+		if !strings.Contains(r.Digest, ":") {
+			return r, fmt.Errorf("invalid digest in image reference %q", ref)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:i], name[i+1:]
+		if r.Tag == "" {
+			return r, fmt.Errorf("empty tag in image reference %q", ref)
+		}
+	}
+
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			r.Registry, name = first, name[i+1:]
+		}
+	}
+	if r.Registry == "" || r.Registry == "index.docker.io" {
+		r.Registry = DockerHub
+	}
+	if r.Registry == DockerHub && !strings.Contains(name, "/") {
+		name = officialPrefix + name
+	}
+	if !repositoryPattern.MatchString(name) {
+		return r, fmt.Errorf("invalid repository name in image reference %q", ref)
+	}
+	r.Repository = name
+
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// String returns the fully qualified reference
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Endpoint returns the host serving the registry API
+func (r Reference) Endpoint() string {
+	if r.Registry == DockerHub {
+		return dockerHubEndpoint
+	}
+	return r.Registry
+}
+
+// manifestRef is the tag or digest used to fetch the manifest, the digest
+// when the reference has both
+func (r Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
@@ -0,0 +1,186 @@
+package registry_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/registry"
+	"github.com/avirooppal/dock-slimscheck/registry/registrytest"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want registry.Reference
+	}{
+		{"alpine", registry.Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "latest"}},
+		{"nginx:1.25", registry.Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}},
+		{"bitnami/redis:7.2", registry.Reference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2"}},
+		{"index.docker.io/library/node:20", registry.Reference{Registry: "docker.io", Repository: "library/node", Tag: "20"}},
+		{"ghcr.io/org/app@sha256:abc", registry.Reference{Registry: "ghcr.io", Repository: "org/app", Digest: "sha256:abc"}},
+		{"ghcr.io/org/app:v1@sha256:abc", registry.Reference{Registry: "ghcr.io", Repository: "org/app", Tag: "v1", Digest: "sha256:abc"}},
+		{"localhost:5000/app", registry.Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"localhost/app:dev", registry.Reference{Registry: "localhost", Repository: "app", Tag: "dev"}},
+	}
+	for _, tt := range tests {
+		got, err := registry.ParseReference(tt.ref)
+		if err != nil {
+			t.Errorf("ParseReference(%q): %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+
+	for _, ref := range []string{"Alpine", "app@abc", "app:", "org//app"} {
+		if _, err := registry.ParseReference(ref); err == nil {
+			t.Errorf("ParseReference(%q) succeeded, want an error", ref)
+		}
+	}
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.Username, reg.Password = "user", "secret"
+	reg.Push("team/app", "1", registrytest.Image{Layers: [][]byte{registrytest.TarLayer(map[string][]byte{"a": []byte("a")})}})
+	ref := reg.Host() + "/team/app:1"
+
+	client := &registry.Client{Keychain: reg.Keychain()}
+	if _, err := client.Inspect(ref, ""); err != nil {
+		t.Fatalf("Inspect with credentials: %v", err)
+	}
+	// The token is fetched once and reused for the manifest, config and blobs
+	tokens := 0
+	for _, request := range reg.Requests() {
+		if strings.HasPrefix(request, "GET /token") {
+			tokens++
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("fetched %d tokens, want 1: %q", tokens, reg.Requests())
+	}
+
+	anonymous := &registry.Client{}
+	if _, err := anonymous.Inspect(ref, ""); err == nil || !strings.Contains(err.Error(), "docker login") {
+		t.Errorf("Inspect without credentials: got %v, want an error suggesting docker login", err)
+	}
+
+	wrong := &registry.Client{Keychain: registry.StaticKeychain{reg.Host(): {Username: "user", Password: "wrong"}}}
+	if _, err := wrong.Inspect(ref, ""); err == nil {
+		t.Error("Inspect with wrong credentials succeeded")
+	}
+}
+
+func TestInspectIndex(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	amd64 := registrytest.TarLayer(map[string][]byte{"bin/app": []byte("amd64 binary")})
+	arm64 := registrytest.TarLayer(map[string][]byte{"bin/app": []byte("arm64 binary, a little longer")})
+	config := registrytest.TarLayer(map[string][]byte{"etc/app.conf": []byte("x")})
+	digest := reg.Push("app", "1",
+		registrytest.Image{Platform: "linux/amd64", Layers: [][]byte{amd64}},
+		registrytest.Image{Platform: "linux/arm64/v8", Layers: [][]byte{arm64, config}, History: []string{"ADD rootfs /", "COPY app.conf /etc/"}},
+	)
+
+	img, err := (&registry.Client{}).Inspect(reg.Host()+"/app:1", "linux/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Digest != digest {
+		t.Errorf("Digest = %s, want the index digest %s", img.Digest, digest)
+	}
+	if img.Platform != "linux/arm64/v8" {
+		t.Errorf("Platform = %s, want linux/arm64/v8", img.Platform)
+	}
+	// The attestation manifest is not a platform
+	if strings.Join(img.Platforms, ",") != "linux/amd64,linux/arm64/v8" {
+		t.Errorf("Platforms = %q, want linux/amd64 and linux/arm64/v8", img.Platforms)
+	}
+	if len(img.Layers) != 2 {
+		t.Fatalf("got %d layers, want 2", len(img.Layers))
+	}
+	// Uncompressed sizes come from the gzip trailer
+	for i, want := range []int{len(arm64), len(config)} {
+		if img.Layers[i].Size != int64(want) {
+			t.Errorf("layer %d size = %d, want %d", i, img.Layers[i].Size, want)
+		}
+		if img.Layers[i].CompressedSize <= 0 {
+			t.Errorf("layer %d has no compressed size", i)
+		}
+	}
+	if img.Size() != int64(len(arm64)+len(config)) {
+		t.Errorf("Size() = %d, want %d", img.Size(), len(arm64)+len(config))
+	}
+	if img.Layers[1].History == nil || img.Layers[1].History.CreatedBy != "COPY app.conf /etc/" {
+		t.Errorf("layer 1 history = %+v, want COPY app.conf /etc/", img.Layers[1].History)
+	}
+
+	if _, err := (&registry.Client{}).Inspect(reg.Host()+"/app:1", "linux/s390x"); err == nil || !strings.Contains(err.Error(), "linux/amd64, linux/arm64/v8") {
+		t.Errorf("Inspect of a missing platform: got %v, want an error listing the platforms", err)
+	}
+}
+
+func TestInspectWithoutRangeRequests(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.NoRange = true
+	reg.Push("app", "1", registrytest.Image{Layers: [][]byte{registrytest.TarLayer(map[string][]byte{"a": []byte("a")})}})
+
+	img, err := (&registry.Client{}).Inspect(reg.Host()+"/app:1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Layers[0].Size != -1 || img.Size() != -1 {
+		t.Errorf("layer size = %d and image size = %d without range support, want -1", img.Layers[0].Size, img.Size())
+	}
+	if img.CompressedSize() <= 0 {
+		t.Errorf("CompressedSize() = %d, want the manifest size", img.CompressedSize())
+	}
+}
+
+func TestDigest(t *testing.T) {
+	for _, noHeader := range []bool{false, true} {
+		reg := registrytest.New()
+		reg.NoDigestHeader = noHeader
+		want := reg.Push("app", "1",
+			registrytest.Image{Platform: "linux/amd64", Layers: [][]byte{registrytest.TarLayer(nil)}},
+			registrytest.Image{Platform: "linux/arm64", Layers: [][]byte{registrytest.TarLayer(nil)}},
+		)
+
+		got, err := (&registry.Client{}).Digest(reg.Host() + "/app:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Digest (no header %v) = %s, want %s", noHeader, got, want)
+		}
+
+		requests := strings.Join(reg.Requests(), "\n")
+		if !strings.Contains(requests, "HEAD /v2/app/manifests/1") {
+			t.Errorf("no HEAD request for the tag: %q", requests)
+		}
+		// The manifest is only read when the registry does not name the digest
+		if read := strings.Contains(requests, "GET /v2/app/manifests/1"); read != noHeader {
+			t.Errorf("GET of the manifest = %v with no header %v: %q", read, noHeader, requests)
+		}
+		reg.Close()
+	}
+
+	pinned := "sha256:" + strings.Repeat("a", 64)
+	if got, err := (&registry.Client{}).Digest("127.0.0.1:1/app@" + pinned); err != nil || got != pinned {
+		t.Errorf("Digest of a pinned reference = %s, %v, want %s without a request", got, err, pinned)
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	client, err := registry.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.HTTP == nil || client.HTTP.Timeout <= 0 {
+		t.Errorf("NewClient has HTTP client %+v, want one with a timeout", client.HTTP)
+	}
+}
@@ -0,0 +1,324 @@
+package registrytest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// Image is one platform image to push
+type Image struct {
+	Platform string   // os/arch[/variant], linux/amd64 when empty
+	Layers   [][]byte // Uncompressed layer tars, bottom first
+	History  []string // created_by of the layers, one per layer when set
+}
+
+// Registry is an in-process registry serving the Distribution v2 read API,
+// for exercising registry.Client without the network. With Username set,
+// it answers like Docker Hub: a bearer challenge pointing at its own token
+// service, which checks the credentials.
+type Registry struct {
+	*httptest.Server
+	Username, Password string // Credentials the token service requires, if any
+	NoRange            bool   // Ignore Range headers on blobs, as some registries do
+	NoDigestHeader     bool   // Leave out Docker-Content-Digest, as some registries do
+
+	mu        sync.Mutex
+	requests  []string
+	manifests map[string]stored // By "repository/tag" and "repository@digest"
+	blobs     map[string][]byte // By digest
+	tokens    map[string]bool
+}
+
+// stored is a manifest with its media type
+type stored struct {
+	mediaType string
+	data      []byte
+}
+
+// New starts an empty registry. Close it when done.
+func New() *Registry {
+	r := &Registry{manifests: map[string]stored{}, blobs: map[string][]byte{}, tokens: map[string]bool{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// Host returns the host:port to use in image references, such as
+// 127.0.0.1:40123/library/alpine:3.19
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// Requests returns "METHOD path" of every request so far
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+// Keychain returns a keychain holding the registry's credentials
+func (r *Registry) Keychain() registry.StaticKeychain {
+	return registry.StaticKeychain{r.Host(): {Username: r.Username, Password: r.Password}}
+}
+
+// Push stores images under repository:tag and returns the digest of what the
+// tag points to: the image manifest for one image, or an index listing all
+// of them, followed by an attestation manifest, for several
+func (r *Registry) Push(repository, tag string, images ...Image) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []map[string]interface{}
+	var digest string
+	for _, image := range images {
+		data := r.pushImage(image)
+		digest = r.putManifest(repository, "", registry.MediaTypeOCIManifest, data)
+		entries = append(entries, map[string]interface{}{
+			"mediaType": registry.MediaTypeOCIManifest,
+			"digest":    digest,
+			"size":      len(data),
+			"platform":  platformJSON(image.Platform),
+		})
+	}
+	if len(images) == 1 {
+		r.manifests[repository+":"+tag] = r.manifests[repository+"@"+digest]
+		return digest
+	}
+
+	attestation := r.putManifest(repository, "", registry.MediaTypeOCIManifest, mustJSON(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     registry.MediaTypeOCIManifest,
+		"config":        r.putBlob("application/vnd.oci.image.config.v1+json", []byte("{}")),
+		"layers":        []interface{}{},
+	}))
+	entries = append(entries, map[string]interface{}{
+		"mediaType":   registry.MediaTypeOCIManifest,
+		"digest":      attestation,
+		"size":        1,
+		"platform":    map[string]string{"os": "unknown", "architecture": "unknown"},
+		"annotations": map[string]string{"vnd.docker.reference.type": "attestation-manifest"},
+	})
+	index := mustJSON(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     registry.MediaTypeOCIIndex,
+		"manifests":     entries,
+	})
+	return r.putManifest(repository, tag, registry.MediaTypeOCIIndex, index)
+}
+
+// pushImage stores the layers and config of an image and returns its manifest
+func (r *Registry) pushImage(image Image) []byte {
+	platform := platformJSON(image.Platform)
+	var layers []interface{}
+	var diffIDs []string
+	var history []map[string]interface{}
+	for i, layer := range image.Layers {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(layer)
+		zw.Close()
+		layers = append(layers, r.putBlob("application/vnd.oci.image.layer.v1.tar+gzip", compressed.Bytes()))
+		diffIDs = append(diffIDs, digestOf(layer))
+
+		createdBy := fmt.Sprintf("layer %d", i)
+		if i < len(image.History) {
+			createdBy = image.History[i]
+		}
+		history = append(history, map[string]interface{}{"created_by": createdBy})
+	}
+
+	config := map[string]interface{}{
+		"architecture": platform["architecture"],
+		"os":           platform["os"],
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+		"history":      history,
+	}
+	if variant, ok := platform["variant"]; ok {
+		config["variant"] = variant
+	}
+	return mustJSON(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     registry.MediaTypeOCIManifest,
+		"config":        r.putBlob("application/vnd.oci.image.config.v1+json", mustJSON(config)),
+		"layers":        layers,
+	})
+}
+
+// putBlob stores a blob and returns its descriptor
+func (r *Registry) putBlob(mediaType string, data []byte) map[string]interface{} {
+	digest := digestOf(data)
+	r.blobs[digest] = data
+	return map[string]interface{}{"mediaType": mediaType, "digest": digest, "size": len(data)}
+}
+
+// putManifest stores a manifest by digest, and by tag when one is given
+func (r *Registry) putManifest(repository, tag, mediaType string, data []byte) string {
+	digest := digestOf(data)
+	r.manifests[repository+"@"+digest] = stored{mediaType: mediaType, data: data}
+	if tag != "" {
+		r.manifests[repository+":"+tag] = stored{mediaType: mediaType, data: data}
+	}
+	return digest
+}
+
+func (r *Registry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if req.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !r.authorized(req) {
+		scope := ""
+		if repository, _, ok := splitPath(req.URL.Path); ok {
+			scope = fmt.Sprintf(`,scope="repository:%s:pull"`, repository)
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registrytest"%s`, r.URL, scope))
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	repository, rest, ok := splitPath(req.URL.Path)
+	if !ok || req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "not found")
+		return
+	}
+	if ref, isManifest := strings.CutPrefix(rest, "manifests/"); isManifest {
+		key := repository + ":" + ref
+		if strings.Contains(ref, ":") {
+			key = repository + "@" + ref
+		}
+		manifest, found := r.manifests[key]
+		if !found {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", manifest.mediaType)
+		if !r.NoDigestHeader {
+			w.Header().Set("Docker-Content-Digest", digestOf(manifest.data))
+		}
+		w.Write(manifest.data)
+		return
+	}
+	if digest, isBlob := strings.CutPrefix(rest, "blobs/"); isBlob {
+		blob, found := r.blobs[digest]
+		if !found {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+			return
+		}
+		if r.NoRange {
+			req.Header.Del("Range")
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob))
+		return
+	}
+	writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "not found")
+}
+
+// serveToken issues a token when the basic credentials match
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	if username != r.Username || password != r.Password {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+	token := fmt.Sprintf("token-%d", len(r.tokens)+1)
+	r.tokens[token] = true
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(mustJSON(map[string]string{"token": token}))
+}
+
+// authorized reports whether the request may read, always true without
+// credentials
+func (r *Registry) authorized(req *http.Request) bool {
+	if r.Username == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && r.tokens[token]
+}
+
+// TarLayer returns a layer tar holding the given files
+func TarLayer(files map[string][]byte) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write(files[name])
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+// splitPath splits /v2/<repository>/(manifests|blobs)/<ref>
+func splitPath(path string) (string, string, bool) {
+	path, ok := strings.CutPrefix(path, "/v2/")
+	if !ok {
+		return "", "", false
+	}
+	for _, kind := range []string{"/manifests/", "/blobs/"} {
+		if i := strings.LastIndex(path, kind); i > 0 {
+			return path[:i], path[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// platformJSON turns os/arch[/variant] into an OCI platform object
+func platformJSON(name string) map[string]string {
+	if name == "" {
+		name = "linux/amd64"
+	}
+	parts := strings.Split(name, "/")
+	platform := map[string]string{"os": parts[0]}
+	if len(parts) > 1 {
+		platform["architecture"] = parts[1]
+	}
+	if len(parts) > 2 {
+		platform["variant"] = parts[2]
+	}
+	return platform
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(mustJSON(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	}))
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
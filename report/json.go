@@ -0,0 +1,310 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/build"
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// JSONSchemaVersion is bumped whenever a field of the JSON output is renamed,
+// removed or changes meaning. Adding fields does not change the version.
+const JSONSchemaVersion = 1
+
+// jsonReport is the top-level JSON document
+type jsonReport struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Tool          jsonTool     `json:"tool"`
+	File          string       `json:"file"`
+	Issues        []jsonIssue  `json:"issues"`
+	Summary       jsonSummary  `json:"summary"`
+	Image         *jsonImage   `json:"image,omitempty"`
+	Comparison    *jsonCompare `json:"comparison,omitempty"`
+	BaseImage     *jsonRemote  `json:"baseImage,omitempty"`
+}
+
+type jsonTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type jsonIssue struct {
+	RuleID            string   `json:"ruleId"`
+	Type              string   `json:"type"`
+	Severity          string   `json:"severity"`
+	Message           string   `json:"message"`
+	Fix               string   `json:"fix,omitempty"`
+	Impact            string   `json:"impact,omitempty"`
+	References        []string `json:"references"`
+	Details           []string `json:"details,omitempty"`
+	Stage             string   `json:"stage,omitempty"`
+	Line              int      `json:"line"`
+	EndLine           int      `json:"endLine"`
+	Suppressed        bool     `json:"suppressed"`
+	SuppressionReason string   `json:"suppressionReason,omitempty"`
+}
+
+// jsonImage describes the analyzed image and its layers
+type jsonImage struct {
+	Source      string       `json:"source"`
+	RepoTags    []string     `json:"repoTags"`
+	Platform    string       `json:"platform,omitempty"`
+	TotalSize   int64        `json:"totalSize"`
+	WastedSize  int64        `json:"wastedSize"`
+	Efficiency  float64      `json:"efficiency"`
+	Layers      []jsonLayer  `json:"layers"`
+	WastedFiles []jsonWasted `json:"wastedFiles"`
+}
+
+type jsonLayer struct {
+	Index          int    `json:"index"`
+	Digest         string `json:"digest"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+	WastedSize     int64  `json:"wastedSize"`
+	CreatedBy      string `json:"createdBy,omitempty"`
+	Instruction    string `json:"instruction,omitempty"`
+	Line           int    `json:"line,omitempty"`
+}
+
+// jsonWasted is a path hidden by a later layer, with the layer indexes that
+// added and hid its copies
+type jsonWasted struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	AddedBy  []int  `json:"addedBy"`
+	HiddenBy []int  `json:"hiddenBy"`
+}
+
+// jsonRemote describes the base image as read from its registry. Sizes that
+// could not be determined are null.
+type jsonRemote struct {
+	Reference      string            `json:"reference"`
+	Digest         string            `json:"digest"`
+	Platform       string            `json:"platform"`
+	Platforms      []string          `json:"platforms"`
+	LayerCount     int               `json:"layerCount"`
+	CompressedSize int64             `json:"compressedSize"`
+	Size           *int64            `json:"size"`
+	Layers         []jsonRemoteLayer `json:"layers"`
+}
+
+type jsonRemoteLayer struct {
+	Index          int    `json:"index"`
+	Digest         string `json:"digest"`
+	Size           *int64 `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+	CreatedBy      string `json:"createdBy,omitempty"`
+}
+
+// jsonCompare holds the size changes between two Dockerfiles. Sizes of
+// stages or layers that one side does not have are null.
+type jsonCompare struct {
+	Old    string           `json:"old"`
+	New    string           `json:"new"`
+	Stages []jsonStageDelta `json:"stages"`
+	Layers []jsonLayerDelta `json:"layers"`
+}
+
+type jsonStageDelta struct {
+	Stage   string `json:"stage"`
+	OldSize *int64 `json:"oldSize"`
+	NewSize *int64 `json:"newSize"`
+	Change  int64  `json:"change"`
+}
+
+type jsonLayerDelta struct {
+	Index   int    `json:"index"`
+	OldSize *int64 `json:"oldSize"`
+	NewSize *int64 `json:"newSize"`
+	Change  int64  `json:"change"`
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+}
+
+// jsonSummary counts the unsuppressed issues
+type jsonSummary struct {
+	Total      int            `json:"total"`
+	Suppressed int            `json:"suppressed"`
+	BySeverity map[string]int `json:"bySeverity"`
+}
+
+// WriteJSON writes the report as an indented JSON document
+func WriteJSON(w io.Writer, r *Report) error {
+	doc := jsonReport{
+		SchemaVersion: JSONSchemaVersion,
+		Tool:          jsonTool{Name: ToolName, Version: r.ToolVersion},
+		File:          r.Path,
+		Issues:        []jsonIssue{},
+		Summary:       jsonSummary{BySeverity: map[string]int{}},
+	}
+
+	for _, severity := range checks.Severities {
+		doc.Summary.BySeverity[severity.String()] = 0
+	}
+
+	for _, issue := range r.Issues {
+		references := issue.References
+		if references == nil {
+			references = []string{}
+		}
+		doc.Issues = append(doc.Issues, jsonIssue{
+			RuleID:            issue.RuleID,
+			Type:              issue.Type.String(),
+			Severity:          issue.Severity.String(),
+			Message:           issue.Message,
+			Fix:               issue.Fix,
+			Impact:            issue.Impact,
+			References:        references,
+			Details:           issue.Details,
+			Stage:             issue.Stage,
+			Line:              issue.Line,
+			EndLine:           issue.EndLine,
+			Suppressed:        issue.Suppressed,
+			SuppressionReason: issue.SuppressionReason,
+		})
+
+		if issue.Suppressed {
+			doc.Summary.Suppressed++
+			continue
+		}
+		doc.Summary.Total++
+		doc.Summary.BySeverity[issue.Severity.String()]++
+	}
+
+	if r.Image != nil {
+		doc.Image = newJSONImage(r.Image)
+	}
+	if r.Comparison != nil {
+		doc.Comparison = newJSONCompare(r.Comparison)
+	}
+	if r.BaseImage != nil {
+		doc.BaseImage = newJSONRemote(r.BaseImage)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(doc)
+}
+
+// newJSONImage lists the layers of an image with the instructions that
+// created them
+func newJSONImage(img *archive.Image) *jsonImage {
+	doc := &jsonImage{
+		Source:      img.Source,
+		RepoTags:    img.RepoTags,
+		TotalSize:   img.TotalSize(),
+		Efficiency:  1,
+		Layers:      []jsonLayer{},
+		WastedFiles: []jsonWasted{},
+	}
+	if doc.RepoTags == nil {
+		doc.RepoTags = []string{}
+	}
+	if img.OS != "" {
+		doc.Platform = img.OS + "/" + img.Architecture
+	}
+
+	for _, layer := range img.Layers {
+		entry := jsonLayer{
+			Index:          layer.Index,
+			Digest:         layer.Digest,
+			Size:           layer.Size,
+			CompressedSize: layer.CompressedSize,
+			WastedSize:     layer.WastedSize,
+			CreatedBy:      layer.CreatedBy(),
+		}
+		if inst := layer.Instruction(); inst != nil {
+			entry.Instruction = inst.Command
+			entry.Line = inst.Line
+		}
+		doc.Layers = append(doc.Layers, entry)
+	}
+
+	if img.Waste != nil {
+		doc.WastedSize = img.Waste.WastedSize
+		doc.Efficiency = img.Waste.Efficiency()
+		for _, file := range img.Waste.Files {
+			doc.WastedFiles = append(doc.WastedFiles, jsonWasted{
+				Path:     file.Path,
+				Size:     file.Size,
+				AddedBy:  file.AddedBy,
+				HiddenBy: file.HiddenBy,
+			})
+		}
+	}
+	return doc
+}
+
+// newJSONRemote describes a base image read from its registry
+func newJSONRemote(img *registry.Image) *jsonRemote {
+	doc := &jsonRemote{
+		Reference:      img.Reference,
+		Digest:         img.Digest,
+		Platform:       img.Platform,
+		Platforms:      img.Platforms,
+		LayerCount:     len(img.Layers),
+		CompressedSize: img.CompressedSize(),
+		Size:           optionalSize(img.Size()),
+		Layers:         []jsonRemoteLayer{},
+	}
+	for _, layer := range img.Layers {
+		doc.Layers = append(doc.Layers, jsonRemoteLayer{
+			Index:          layer.Index,
+			Digest:         layer.Digest,
+			Size:           optionalSize(layer.Size),
+			CompressedSize: layer.CompressedSize,
+			CreatedBy:      layer.CreatedBy(),
+		})
+	}
+	return doc
+}
+
+// newJSONCompare lists the size changes per stage and per layer
+func newJSONCompare(c *build.Comparison) *jsonCompare {
+	doc := &jsonCompare{
+		Old:    c.OldPath,
+		New:    c.NewPath,
+		Stages: []jsonStageDelta{},
+		Layers: []jsonLayerDelta{},
+	}
+
+	for _, stage := range c.Stages {
+		doc.Stages = append(doc.Stages, jsonStageDelta{
+			Stage:   stage.Stage,
+			OldSize: optionalSize(stage.Old),
+			NewSize: optionalSize(stage.New),
+			Change:  stage.Change(),
+		})
+	}
+
+	for _, layer := range c.Layers {
+		entry := jsonLayerDelta{Index: layer.Index, Change: layer.Change()}
+		if layer.Old != nil {
+			entry.OldSize = &layer.Old.Size
+			if inst := layer.Old.Instruction(); inst != nil {
+				entry.OldLine = inst.Line
+			}
+		}
+		if layer.New != nil {
+			entry.NewSize = &layer.New.Size
+			if inst := layer.New.Instruction(); inst != nil {
+				entry.NewLine = inst.Line
+			}
+		}
+		doc.Layers = append(doc.Layers, entry)
+	}
+	return doc
+}
+
+// optionalSize returns nil for the -1 of a missing stage or unknown size
+func optionalSize(size int64) *int64 {
+	if size < 0 {
+		return nil
+	}
+	return &size
+}
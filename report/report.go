@@ -0,0 +1,40 @@
+package report
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/build"
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/registry"
+)
+
+// ToolName is the name reported in machine-readable output
+const ToolName = "dock-slimcheck"
+
+// Report is the result of checking one Dockerfile
+type Report struct {
+	ToolVersion string
+	Path        string            // Path of the Dockerfile as given on the command line
+	Issues      []checks.Issue    // All issues, including suppressed ones
+	Rules       []checks.Rule     // Rules that were run
+	Image       *archive.Image    // Image analyzed with --image-archive, --oci-layout or --build, if any
+	Comparison  *build.Comparison // Size changes measured with --compare, if any
+	BaseImage   *registry.Image   // Base image inspected in its registry with --remote, if any
+}
+
+// Formats lists the supported output formats
+var Formats = []string{"text", "json", "sarif"}
+
+// Write writes the report in a machine-readable format
+func Write(w io.Writer, format string, r *Report) error {
+	switch format {
+	case "json":
+		return WriteJSON(w, r)
+	case "sarif":
+		return WriteSARIF(w, r)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
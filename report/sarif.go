@@ -0,0 +1,212 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolInfoURI  = "https://github.com/avirooppal/dock-slimscheck"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	Help                 *sarifMessage     `json:"help,omitempty"`
+	HelpURI              string            `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfig       `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties,omitempty"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// sarifLevel maps an issue severity to a SARIF result level
+func sarifLevel(severity checks.Severity) string {
+	switch {
+	case severity >= checks.SeverityHigh:
+		return "error"
+	case severity == checks.SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// resultText returns the message of a result, followed by the issue details
+func resultText(issue checks.Issue) string {
+	if len(issue.Details) == 0 {
+		return issue.Message
+	}
+	return issue.Message + "\n- " + strings.Join(issue.Details, "\n- ")
+}
+
+// artifactURI returns the SARIF URI of the Dockerfile. Relative paths stay
+// relative so code-scanning tools can resolve them against the repository.
+func artifactURI(path string) string {
+	if filepath.IsAbs(path) {
+		return "file://" + filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// WriteSARIF writes the report as a SARIF 2.1.0 log with a single run
+func WriteSARIF(w io.Writer, r *Report) error {
+	driver := sarifDriver{
+		Name:           ToolName,
+		Version:        r.ToolVersion,
+		InformationURI: toolInfoURI,
+		Rules:          []sarifRule{},
+	}
+
+	// Rule help comes from the first issue of each rule
+	firstIssue := map[string]checks.Issue{}
+	for _, issue := range r.Issues {
+		if _, ok := firstIssue[issue.RuleID]; !ok {
+			firstIssue[issue.RuleID] = issue
+		}
+	}
+
+	ruleIndex := map[string]int{}
+	addRule := func(id, name, description string, severity checks.Severity, category string) {
+		rule := sarifRule{
+			ID:                   id,
+			Name:                 name,
+			ShortDescription:     sarifMessage{Text: description},
+			DefaultConfiguration: sarifConfig{Level: sarifLevel(severity)},
+		}
+		if category != "" {
+			rule.Properties = map[string]string{"category": category}
+		}
+		if issue, ok := firstIssue[id]; ok {
+			if issue.Fix != "" {
+				rule.Help = &sarifMessage{Text: issue.Fix}
+			}
+			if len(issue.References) > 0 {
+				rule.HelpURI = issue.References[0]
+			}
+		}
+		ruleIndex[id] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, rule)
+	}
+
+	for _, rule := range r.Rules {
+		addRule(rule.ID(), rule.Name(), rule.Description(), rule.DefaultSeverity(), string(rule.Category()))
+	}
+	// Issues from rules that were not listed still need a descriptor
+	for _, issue := range r.Issues {
+		if _, ok := ruleIndex[issue.RuleID]; !ok {
+			addRule(issue.RuleID, issue.RuleID, issue.Message, issue.Severity, "")
+		}
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	uri := artifactURI(r.Path)
+
+	for _, issue := range r.Issues {
+		location := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: uri},
+			},
+		}
+		// Findings about the image as a whole point at the top of the file
+		startLine, endLine := issue.Line, issue.EndLine
+		if startLine <= 0 {
+			startLine, endLine = 1, 1
+		}
+		if endLine < startLine {
+			endLine = startLine
+		}
+		location.PhysicalLocation.Region = &sarifRegion{StartLine: startLine, EndLine: endLine}
+
+		result := sarifResult{
+			RuleID:    issue.RuleID,
+			RuleIndex: ruleIndex[issue.RuleID],
+			Level:     sarifLevel(issue.Severity),
+			Message:   sarifMessage{Text: resultText(issue)},
+			Locations: []sarifLocation{location},
+		}
+		if issue.Suppressed {
+			result.Suppressions = []sarifSuppression{{
+				Kind:          "inSource",
+				Justification: issue.SuppressionReason,
+			}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,241 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+var (
+	// digestRegex matches the digests ADD --checksum accepts for URLs
+	digestRegex = regexp.MustCompile(`^(sha256:[0-9a-f]{64}|sha384:[0-9a-f]{96}|sha512:[0-9a-f]{128})$`)
+	// commitRegex matches a full SHA-1 or SHA-256 git commit hash
+	commitRegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+)
+
+// maxChecksumSize limits the bytes downloaded to compute the digest of a file
+const maxChecksumSize = 2 << 30
+
+// checkAddWithURL reports ADD instructions that download a URL without
+// --checksum, or with a value that is not a digest. The fix names the digest
+// of the file when it was fetched with --fetch-checksums.
+func checkAddWithURL(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		for _, inst := range stage.GetInstructionsByType("ADD") {
+			var urls, raw []string
+			rawSources := inst.RawSources()
+			for i, source := range inst.Sources() {
+				if parser.IsURL(source) && !parser.IsGitSource(source) {
+					urls = append(urls, source)
+					raw = append(raw, rawSources[i])
+				}
+			}
+			if len(urls) == 0 {
+				continue
+			}
+
+			issue := checks.Issue{
+				Type:       checks.SecurityIssue,
+				Fix:        checksumFlagFix(ctx, inst, urls, raw),
+				Impact:     "A compromised server or mirror can replace the file without the build noticing",
+				References: []string{"https://docs.docker.com/reference/dockerfile/#add---checksum"},
+				Stage:      stage.String(),
+				Line:       inst.Line,
+				EndLine:    inst.EndLine,
+			}
+			checksum, ok := inst.FlagValue("checksum")
+			rawChecksum, _ := inst.RawFlagValue("checksum")
+			switch {
+			case ok && (digestRegex.MatchString(checksum) || strings.Contains(rawChecksum, "$")):
+				continue
+			case ok:
+				issue.Message = fmt.Sprintf("ADD --checksum=%s is not a sha256, sha384 or sha512 digest such as sha256:<64 hex digits>", checksum)
+			case len(urls) > 1:
+				issue.Message = fmt.Sprintf("ADD downloads %s and %d more without --checksum, so a changed or tampered file goes unnoticed", urls[0], len(urls)-1)
+			default:
+				issue.Message = fmt.Sprintf("ADD downloads %s without --checksum, so a changed or tampered file goes unnoticed", urls[0])
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// checksumFlagFix suggests ADD --checksum for each URL of an instruction,
+// with the digests fetched with --fetch-checksums. URLs built from
+// variables are written as they are in the Dockerfile.
+func checksumFlagFix(ctx *checks.Context, inst parser.Instruction, urls, raw []string) string {
+	var flags []string
+	for _, flag := range inst.Flags {
+		if flag.Name == "checksum" {
+			continue
+		}
+		if flag.Value == "" {
+			flags = append(flags, "--"+flag.Name)
+		} else {
+			flags = append(flags, "--"+flag.Name+"="+flag.Value)
+		}
+	}
+
+	fix := "Pin the download to the digest of the file (Dockerfile syntax 1.6 or later):\n# syntax=docker/dockerfile:1\n"
+	if len(urls) > 1 {
+		fix = "--checksum takes a single source, so download each URL with its own ADD (Dockerfile syntax 1.6 or later):\n# syntax=docker/dockerfile:1\n"
+	}
+	missing, variable := false, false
+	for i, u := range urls {
+		digest := ctx.Checksums[u]
+		if strings.Contains(raw[i], "$") {
+			u, digest = raw[i], ""
+			variable = true
+		}
+		if digest == "" {
+			digest = "sha256:<digest>"
+			missing = true
+		}
+		fix += strings.Join(append(append([]string{"ADD"}, flags...), "--checksum="+digest, u, inst.Destination()), " ") + "\n"
+	}
+	switch {
+	case variable:
+		fix += "The URL is built from variables, so pass the digest of each version with the URL, for example as a build argument"
+	case missing && ctx.Checksums != nil:
+		fix += "The file could not be fetched to compute the digest"
+	case missing:
+		fix += "Run with --fetch-checksums to compute the digest"
+	}
+	return strings.TrimSuffix(fix, "\n")
+}
+
+// checkGitSources reports ADD instructions that take a git repository at
+// its default branch, a branch or a tag rather than a commit, unless
+// --checksum or a checksum query parameter names the expected commit
+func checkGitSources(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		for _, inst := range stage.GetInstructionsByType("ADD") {
+			checksum, _ := inst.FlagValue("checksum")
+			rawSources := inst.RawSources()
+			for i, source := range inst.Sources() {
+				if !parser.IsGitSource(source) {
+					continue
+				}
+				repo, ref, pinned := gitRef(source)
+				_, rawRef, _ := gitRef(rawSources[i])
+				if commitRegex.MatchString(ref) || commitRegex.MatchString(pinned) || commitRegex.MatchString(checksum) || strings.Contains(rawRef, "$") {
+					continue
+				}
+
+				message := fmt.Sprintf("ADD takes %s at %s, a branch or tag that can move to another commit", repo, ref)
+				if ref == "" {
+					message = fmt.Sprintf("ADD takes the default branch of %s, which moves with every push", repo)
+					ref = "HEAD"
+				}
+				issues = append(issues, checks.Issue{
+					Type:       checks.SecurityIssue,
+					Message:    message,
+					Fix:        fmt.Sprintf("Pin the repository to the commit that git ls-remote %s %s prints:\nADD %s#<commit> %s\nor keep the ref and have a recent Dockerfile syntax verify the commit:\nADD --checksum=<commit> %s %s", repo, ref, repo, inst.Destination(), source, inst.Destination()),
+					Impact:     "A force-push or a compromised repository changes what is built, and builds stop being reproducible",
+					References: []string{"https://docs.docker.com/reference/dockerfile/#adding-files-from-a-git-repository"},
+					Stage:      stage.String(),
+					Line:       inst.Line,
+					EndLine:    inst.EndLine,
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// gitRef splits a git source into the repository, the ref given after # or
+// in a ref query parameter, and the commit of a checksum query parameter,
+// as in https://github.com/org/repo.git#v1.0:subdir or
+// https://github.com/org/repo.git?ref=v1.0&checksum=<commit>
+func gitRef(source string) (string, string, string) {
+	repo, fragment, _ := strings.Cut(source, "#")
+	ref, _, _ := strings.Cut(fragment, ":")
+
+	checksum := ""
+	if i := strings.Index(repo, "?"); i >= 0 {
+		if query, err := url.ParseQuery(repo[i+1:]); err == nil {
+			if ref == "" {
+				ref = query.Get("ref")
+			}
+			checksum = query.Get("checksum")
+		}
+		repo = repo[:i]
+	}
+	return repo, ref, checksum
+}
+
+// FetchChecksums downloads the files that ADD instructions fetch without a
+// valid --checksum and returns their sha256 digests by URL, with an error for
+// each URL that could not be fetched. Sources built from variables are
+// skipped, as their digest changes with the build arguments.
+func FetchChecksums(dockerfile *parser.Dockerfile, client *http.Client) (map[string]string, []error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	checksums := map[string]string{}
+	var errs []error
+	seen := map[string]bool{}
+	for _, inst := range dockerfile.Instructions {
+		if inst.Command != "ADD" {
+			continue
+		}
+		checksum, ok := inst.FlagValue("checksum")
+		rawChecksum, _ := inst.RawFlagValue("checksum")
+		if ok && (digestRegex.MatchString(checksum) || strings.Contains(rawChecksum, "$")) {
+			continue
+		}
+		rawSources := inst.RawSources()
+		for i, source := range inst.Sources() {
+			if !parser.IsURL(source) || parser.IsGitSource(source) || strings.Contains(rawSources[i], "$") || seen[source] {
+				continue
+			}
+			seen[source] = true
+
+			digest, err := fetchChecksum(client, source)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", source, err))
+				continue
+			}
+			checksums[source] = digest
+		}
+	}
+	return checksums, errs
+}
+
+// fetchChecksum downloads a URL and returns the sha256 digest of its body
+func fetchChecksum(client *http.Client, source string) (string, error) {
+	resp, err := client.Get(source)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(resp.Body, maxChecksumSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxChecksumSize {
+		return "", fmt.Errorf("file is larger than %d bytes", int64(maxChecksumSize))
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
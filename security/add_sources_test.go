@@ -0,0 +1,83 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchChecksums(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path != "/app.tgz" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "app")
+	}))
+	defer server.Close()
+
+	pinned := "sha256:" + strings.Repeat("a", 64)
+	ctx := parseContext(t, "FROM alpine:3.19\nARG VERSION=1.0\nARG APP_SHA256\n"+
+		"ADD "+server.URL+"/app.tgz /app/\n"+
+		"ADD "+server.URL+"/app.tgz /again/\n"+
+		"ADD "+server.URL+"/missing.tgz /missing/\n"+
+		"ADD "+server.URL+"/$VERSION/app.tgz /versioned/\n"+
+		"ADD "+server.URL+"/repo.git#v1.0 /src\n"+
+		"ADD --checksum="+pinned+" "+server.URL+"/pinned.tgz /pinned/\n"+
+		"ADD --checksum=$APP_SHA256 "+server.URL+"/from-arg.tgz /from-arg/\n")
+
+	checksums, errs := FetchChecksums(ctx.Dockerfile, server.Client())
+
+	sum := sha256.Sum256([]byte("app"))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if len(checksums) != 1 || checksums[server.URL+"/app.tgz"] != digest {
+		t.Errorf("got checksums %v, want only %s for app.tgz", checksums, digest)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "/missing.tgz: unexpected status 404 Not Found") {
+		t.Errorf("got errors %v, want one for missing.tgz", errs)
+	}
+	if strings.Join(requested, " ") != "/app.tgz /missing.tgz" {
+		t.Errorf("requested %v, want app.tgz once and missing.tgz", requested)
+	}
+
+	ctx.Checksums = checksums
+	issues := checkAddWithURL(ctx)
+	if len(issues) != 4 {
+		t.Fatalf("got %d issues, want 4: %+v", len(issues), issues)
+	}
+	if want := "ADD --checksum=" + digest + " " + server.URL + "/app.tgz /app/"; !strings.Contains(issues[0].Fix, want) {
+		t.Errorf("got fix %q, want it to contain %q", issues[0].Fix, want)
+	}
+	if !strings.HasSuffix(issues[2].Fix, "The file could not be fetched to compute the digest") {
+		t.Errorf("got fix %q for missing.tgz, want it to say the file could not be fetched", issues[2].Fix)
+	}
+	if want := "ADD --checksum=sha256:<digest> " + server.URL + "/$VERSION/app.tgz /versioned/"; !strings.Contains(issues[3].Fix, want) {
+		t.Errorf("got fix %q for a URL built from ARG VERSION, want it to contain %q", issues[3].Fix, want)
+	}
+}
+
+func TestCheckGitSources(t *testing.T) {
+	commit := strings.Repeat("a", 40)
+	tests := []struct {
+		add  string
+		want int
+	}{
+		{"ADD https://github.com/moby/buildkit.git /src", 1},
+		{"ADD https://github.com/moby/buildkit.git#v0.12.0 /src", 1},
+		{"ADD https://github.com/moby/buildkit.git#" + commit + " /src", 0},
+		{"ADD --checksum=" + commit + " https://github.com/moby/buildkit.git#v0.12.0 /src", 0},
+		{"ADD https://github.com/moby/buildkit.git#$REF /src", 0},
+	}
+	for _, tt := range tests {
+		ctx := parseContext(t, "FROM alpine:3.19\nARG REF=main\n"+tt.add+"\n")
+		if issues := checkGitSources(ctx); len(issues) != tt.want {
+			t.Errorf("checkGitSources(%q) = %d issues, want %d", tt.add, len(issues), tt.want)
+		}
+	}
+}
@@ -0,0 +1,614 @@
+package security
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+// downloaders are the commands that fetch a URL
+var downloaders = map[string]bool{
+	"curl": true,
+	"wget": true,
+}
+
+// interpreters run a script read from standard input, a file or an argument,
+// in addition to the shells
+var interpreters = map[string]bool{
+	"perl":       true,
+	"ruby":       true,
+	"node":       true,
+	"nodejs":     true,
+	"php":        true,
+	"pwsh":       true,
+	"powershell": true,
+	"eval":       true,
+	"source":     true,
+	".":          true,
+}
+
+// extractors are commands a download is piped into to unpack it to disk
+var extractors = map[string]bool{
+	"tar":    true,
+	"bsdtar": true,
+	"unzip":  true,
+	"gunzip": true,
+	"gzip":   true,
+	"xz":     true,
+	"bzip2":  true,
+	"zstd":   true,
+	"cpio":   true,
+}
+
+// checksumTools verify a file against a published digest
+var checksumTools = map[string]bool{
+	"sha224sum": true,
+	"sha256sum": true,
+	"sha384sum": true,
+	"sha512sum": true,
+	"sha3sum":   true,
+	"shasum":    true,
+	"b2sum":     true,
+}
+
+// weakChecksumTools compute digests that do not protect against tampering
+var weakChecksumTools = map[string]bool{
+	"md5sum":  true,
+	"sha1sum": true,
+}
+
+// verificationFiles are the names of the checksum, signature and key files a
+// download is verified with, which are not verified themselves
+var verificationFiles = []string{
+	".asc", ".sig", ".gpg", ".pub", ".key", ".pem", ".crt",
+	".sha256", ".sha256sum", ".sha512", ".sha512sum", ".md5",
+	"sha256sums", "sha512sums", "shasums256.txt", "checksums.txt",
+}
+
+// tlsVariables are environment variables that turn off TLS certificate
+// verification, with the values that do so
+var tlsVariables = map[string]func(value string) bool{
+	"GIT_SSL_NO_VERIFY":            func(v string) bool { return v != "" && v != "0" && !strings.EqualFold(v, "false") },
+	"NODE_TLS_REJECT_UNAUTHORIZED": func(v string) bool { return v == "0" },
+	"PYTHONHTTPSVERIFY":            func(v string) bool { return v == "0" },
+	"NPM_CONFIG_STRICT_SSL":        func(v string) bool { return strings.EqualFold(v, "false") },
+	"PIP_TRUSTED_HOST":             func(v string) bool { return v != "" },
+}
+
+const (
+	remoteScriptFix = "Download the script to a file and check it against a published checksum before running it:\nRUN curl -fsSLo /tmp/install.sh https://example.com/install.sh \\\n    && echo \"<sha256>  /tmp/install.sh\" | sha256sum -c - \\\n    && sh /tmp/install.sh\nor install the tool from a package manager or an official image instead"
+
+	tlsFix = "Keep certificate verification on. If the server uses a private CA, add its certificate to the trust store of the image instead:\nCOPY corp-ca.crt /usr/local/share/ca-certificates/\nRUN update-ca-certificates"
+
+	signatureFix = "Keep signature checks on and import the key the repository is signed with instead"
+
+	plainHTTPFix = "Download over HTTPS, or verify the file against a checksum obtained over HTTPS"
+
+	checksumFix = "Verify the download against a published checksum in the same RUN:\nRUN curl -fsSLo /tmp/tool.tar.gz https://example.com/tool.tar.gz \\\n    && echo \"<sha256>  /tmp/tool.tar.gz\" | sha256sum -c - \\\n    && tar -xzf /tmp/tool.tar.gz -C /usr/local/bin\nor check its signature with gpg --verify when the project publishes one"
+)
+
+// download is a curl or wget command and the URL it fetches
+type download struct {
+	cmd *shell.SimpleCommand
+	url string // "" when no URL could be told from the arguments
+}
+
+// checkRemoteScripts reports RUN instructions that run a downloaded script
+// without saving it first: curl ... | sh, wget -O- ... | python3,
+// sh -c "$(curl ...)" and bash <(curl ...), including in scripts run with
+// sh -c
+func checkRemoteScripts(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		for _, inst := range stage.GetInstructionsByType("RUN") {
+			seen := map[string]bool{}
+			report := func(message string) {
+				if seen[message] {
+					return
+				}
+				seen[message] = true
+				issues = append(issues, checks.Issue{
+					Type:       checks.SecurityIssue,
+					Message:    message,
+					Fix:        remoteScriptFix,
+					Impact:     "Whatever the server, a compromised mirror or anyone on the network path returns runs in the build, without being reviewed or verified",
+					References: []string{"https://docs.docker.com/build/building/best-practices/#run"},
+					Stage:      stage.String(),
+					Line:       inst.Line,
+					EndLine:    inst.EndLine,
+				})
+			}
+
+			for _, script := range runScripts(inst) {
+				shell.WalkPipelines(script, func(pipeline *shell.Pipeline) {
+					for i, command := range pipeline.Commands {
+						fetched := downloadOf(command)
+						if fetched == nil {
+							continue
+						}
+						for _, next := range pipeline.Commands[i+1:] {
+							if cmd, ok := next.(*shell.SimpleCommand); ok && isInterpreter(cmd.EffectiveName()) {
+								report(fmt.Sprintf("RUN pipes a script downloaded from %s into %s", fetched.source(), cmd.EffectiveName()))
+								break
+							}
+						}
+					}
+				})
+
+				// sh -c "$(curl ...)", bash <(curl ...) and sh < <(curl ...)
+				for _, cmd := range script.Commands() {
+					if !isInterpreter(cmd.EffectiveName()) {
+						continue
+					}
+					words := append([]*shell.Word(nil), cmd.Words[1:]...)
+					for _, redirect := range cmd.Redirects {
+						if redirect.Target != nil {
+							words = append(words, redirect.Target)
+						}
+					}
+					for _, word := range words {
+						for _, subst := range word.Substs {
+							for _, inner := range subst.Commands() {
+								if fetched := downloadOf(inner); fetched != nil {
+									report(fmt.Sprintf("RUN runs a script downloaded from %s with %s", fetched.source(), cmd.EffectiveName()))
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// checkInsecureTransport reports downloads that turn off TLS certificate or
+// package signature verification, through command options, configuration
+// or environment variables, and downloads over plain HTTP
+func checkInsecureTransport(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		for _, inst := range stage.Instructions {
+			var found []checks.Issue
+			switch inst.Command {
+			case "ENV":
+				for _, arg := range inst.Args {
+					name, value, _ := strings.Cut(arg, "=")
+					if disables, ok := tlsVariables[name]; ok && disables(value) {
+						found = append(found, checks.Issue{
+							Message: fmt.Sprintf("ENV %s=%s turns off TLS certificate verification for every later command and the running container", name, value),
+							Fix:     tlsFix,
+						})
+					}
+				}
+			case "RUN":
+				found = insecureCommands(inst)
+			case "ADD":
+				for _, source := range inst.Sources() {
+					if plainHTTP(source) {
+						found = append(found, checks.Issue{
+							Message:  fmt.Sprintf("ADD downloads %s over plain HTTP", source),
+							Fix:      plainHTTPFix,
+							Severity: checks.SeverityMedium,
+						})
+					}
+				}
+			}
+
+			for _, issue := range found {
+				issue.Type = checks.SecurityIssue
+				issue.Impact = "Anyone on the network path can replace what is downloaded, and the build runs or ships it"
+				issue.References = []string{"https://curl.se/docs/sslcerts.html"}
+				issue.Stage = stage.String()
+				issue.Line, issue.EndLine = inst.Line, inst.EndLine
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	return issues
+}
+
+// insecureCommands reports the commands of a RUN instruction that turn off
+// TLS or signature verification or download over plain HTTP
+func insecureCommands(inst parser.Instruction) []checks.Issue {
+	var issues []checks.Issue
+	seen := map[string]bool{}
+	report := func(message, fix string, severity checks.Severity) {
+		if !seen[message] {
+			seen[message] = true
+			issues = append(issues, checks.Issue{Message: message, Fix: fix, Severity: severity})
+		}
+	}
+
+	for _, script := range runScripts(inst) {
+		for _, cmd := range script.Commands() {
+			for _, assign := range cmd.Assigns {
+				if disables, ok := tlsVariables[assign.Name]; ok && disables(assign.Value.Value) {
+					report(fmt.Sprintf("RUN sets %s=%s, which turns off TLS certificate verification", assign.Name, assign.Value.Value), tlsFix, checks.SeverityUnset)
+				}
+			}
+			if message, fix := verificationDisabled(cmd); message != "" {
+				report("RUN "+message, fix, checks.SeverityUnset)
+			}
+
+			name := cmd.EffectiveName()
+			if !downloaders[name] && name != "git" && !strings.HasPrefix(name, "pip") {
+				continue
+			}
+			for _, arg := range cmd.Effective()[1:] {
+				// --index-url=http://...
+				if strings.HasPrefix(arg, "--") {
+					_, arg, _ = strings.Cut(arg, "=")
+				}
+				if plainHTTP(arg) {
+					report(fmt.Sprintf("RUN %s downloads %s over plain HTTP", name, arg), plainHTTPFix, checks.SeverityMedium)
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// verificationDisabled describes how a command turns off TLS certificate or
+// package signature verification, with the fix, or returns empty strings
+func verificationDisabled(cmd *shell.SimpleCommand) (string, string) {
+	argv := cmd.Effective()
+	if len(argv) == 0 {
+		return "", ""
+	}
+	joined := strings.ToLower(strings.Join(argv[1:], " "))
+
+	switch name := cmd.EffectiveName(); {
+	case name == "curl" && cmd.HasFlag("-k", "--insecure"):
+		return "curl skips TLS certificate verification with --insecure", tlsFix
+	case name == "wget" && cmd.HasFlag("--no-check-certificate"):
+		return "wget skips TLS certificate verification with --no-check-certificate", tlsFix
+	case name == "git" && (strings.Contains(joined, "http.sslverify=false") || strings.Contains(joined, "http.sslverify false")):
+		return "git turns off TLS certificate verification with http.sslVerify=false", tlsFix
+	case strings.HasPrefix(name, "pip") && strings.Contains(joined, "trusted-host"):
+		return name + " trusts a host without TLS certificate verification with --trusted-host", tlsFix
+	case (name == "npm" || name == "yarn" || name == "pnpm") && (strings.Contains(joined, "strict-ssl false") || strings.Contains(joined, "strict-ssl=false")):
+		return name + " turns off TLS certificate verification with strict-ssl=false", tlsFix
+	case name == "apk" && cmd.HasFlag("--allow-untrusted"):
+		return "apk installs packages without checking their signatures with --allow-untrusted", signatureFix
+	case (name == "apt-get" || name == "apt") && cmd.HasFlag("--allow-unauthenticated", "--allow-insecure-repositories"):
+		return name + " installs packages without checking their signatures with --allow-unauthenticated", signatureFix
+	case (name == "apt-get" || name == "apt") && strings.Contains(joined, "verify-peer=false"):
+		return name + " skips TLS certificate verification with Acquire::https::Verify-Peer=false", tlsFix
+	case name == "echo" || name == "printf":
+		// echo insecure >> ~/.curlrc
+		for _, redirect := range cmd.Redirects {
+			if redirect.Target == nil {
+				continue
+			}
+			switch target := path.Base(redirect.Target.Value); {
+			case target == ".curlrc" && strings.Contains(joined, "insecure"):
+				return "writes insecure to .curlrc, which makes every later curl skip TLS certificate verification", tlsFix
+			case target == ".wgetrc" && strings.Contains(joined, "check_certificate"):
+				return "turns off check_certificate in .wgetrc, which makes every later wget skip TLS certificate verification", tlsFix
+			}
+		}
+	}
+	return "", ""
+}
+
+// checkUnverifiedDownloads reports RUN instructions that save files
+// downloaded with curl or wget without checking a checksum or signature, in
+// the same RUN or in the next RUN of the stage when its verifying command
+// names the file. Checksum, signature and key files are not reported, nor are
+// scripts piped into an interpreter, which DS111 covers.
+func checkUnverifiedDownloads(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		runs := stage.GetInstructionsByType("RUN")
+		for i, inst := range runs {
+			downloads := savedDownloads(inst)
+			if len(downloads) == 0 {
+				continue
+			}
+			verified, weak := verifies(inst)
+			if verified {
+				continue
+			}
+			if i+1 < len(runs) {
+				downloads = unnamed(downloads, verifiedFiles(runs[i+1]))
+			}
+			if len(downloads) == 0 {
+				continue
+			}
+
+			message := fmt.Sprintf("RUN downloads %s without verifying a checksum or signature", downloads[0].source())
+			if weak != "" {
+				message = fmt.Sprintf("RUN downloads %s and only checks it with %s, which does not protect against tampering", downloads[0].source(), weak)
+			}
+			if len(downloads) > 1 {
+				message = strings.Replace(message, downloads[0].source(), fmt.Sprintf("%s and %d more", downloads[0].source(), len(downloads)-1), 1)
+			}
+			var details []string
+			for _, d := range downloads {
+				details = append(details, "Downloaded by: "+d.cmd.String())
+			}
+
+			issues = append(issues, checks.Issue{
+				Type:       checks.SecurityIssue,
+				Message:    message,
+				Fix:        checksumFix,
+				Impact:     "A compromised server or mirror can replace the file without the build noticing",
+				References: []string{"https://docs.docker.com/reference/dockerfile/#add---checksum"},
+				Details:    details,
+				Stage:      stage.String(),
+				Line:       inst.Line,
+				EndLine:    inst.EndLine,
+			})
+		}
+	}
+
+	return issues
+}
+
+// savedDownloads returns the downloads of a RUN instruction that end up on
+// disk: written to a file or piped into an archive extractor
+func savedDownloads(inst parser.Instruction) []download {
+	var downloads []download
+	for _, script := range runScripts(inst) {
+		shell.WalkPipelines(script, func(pipeline *shell.Pipeline) {
+			for i, command := range pipeline.Commands {
+				fetched := downloadOf(command)
+				if fetched == nil || fetched.url == "" || verificationFile(fetched.url) || loopback(fetched.url) {
+					continue
+				}
+				if fetched.savesFile() || extractedBy(pipeline.Commands[i+1:]) {
+					downloads = append(downloads, *fetched)
+				}
+			}
+		})
+	}
+	return downloads
+}
+
+// unnamed drops the downloads whose file is among the verified files
+func unnamed(downloads []download, verified map[string]bool) []download {
+	var kept []download
+	for _, d := range downloads {
+		named := false
+		for _, file := range d.files() {
+			if verified[file] {
+				named = true
+			}
+		}
+		if !named {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// verifiedFiles returns the base names of the words given to the verifying
+// commands of a RUN instruction, and of the words piped into them, as in
+// echo "$SHA256  app.tgz" | sha256sum -c -
+func verifiedFiles(inst parser.Instruction) map[string]bool {
+	files := map[string]bool{}
+	for _, script := range runScripts(inst) {
+		shell.WalkPipelines(script, func(pipeline *shell.Pipeline) {
+			for i, command := range pipeline.Commands {
+				cmd, ok := command.(*shell.SimpleCommand)
+				if !ok {
+					continue
+				}
+				if verified, _ := verification(cmd); !verified {
+					continue
+				}
+				words := cmd.Effective()[1:]
+				for _, fed := range pipeline.Commands[:i] {
+					if fedCmd, ok := fed.(*shell.SimpleCommand); ok && len(fedCmd.Effective()) > 0 {
+						words = append(words, fedCmd.Effective()[1:]...)
+					}
+				}
+				for _, word := range words {
+					for _, field := range strings.Fields(word) {
+						files[path.Base(field)] = true
+					}
+				}
+			}
+		})
+	}
+	return files
+}
+
+// verifies reports whether a RUN instruction checks a checksum or signature,
+// and otherwise names the weak checksum tool it uses, if any
+func verifies(inst parser.Instruction) (bool, string) {
+	weak := ""
+	for _, script := range runScripts(inst) {
+		for _, cmd := range script.Commands() {
+			verified, tool := verification(cmd)
+			if verified {
+				return true, ""
+			}
+			if tool != "" {
+				weak = tool
+			}
+		}
+	}
+	return false, weak
+}
+
+// verification reports whether a command checks a checksum or signature,
+// and otherwise names the weak checksum tool it is, if any
+func verification(cmd *shell.SimpleCommand) (bool, string) {
+	argv := cmd.Effective()
+	if len(argv) == 0 {
+		return false, ""
+	}
+	switch name := cmd.EffectiveName(); {
+	case checksumTools[name], name == "gpgv":
+		return true, ""
+	case name == "gpg" || name == "gpg2":
+		return cmd.HasFlag("--verify"), ""
+	case name == "openssl":
+		return len(argv) > 1 && (argv[1] == "dgst" || strings.HasPrefix(argv[1], "sha")), ""
+	case name == "cosign":
+		return len(argv) > 1 && strings.HasPrefix(argv[1], "verify"), ""
+	case name == "minisign" || name == "signify":
+		return cmd.HasFlag("-V"), ""
+	case name == "rpm":
+		return cmd.HasFlag("-K", "--checksig"), ""
+	case weakChecksumTools[name]:
+		return false, name
+	}
+	return false, ""
+}
+
+// downloadOf returns the download a command makes, or nil when it is not a
+// curl or wget command
+func downloadOf(command shell.Command) *download {
+	cmd, ok := command.(*shell.SimpleCommand)
+	if !ok || !downloaders[cmd.EffectiveName()] || cmd.HasFlag("--spider") {
+		return nil
+	}
+
+	fetched := &download{cmd: cmd}
+	argv := cmd.Effective()
+	for _, arg := range argv[1:] {
+		if !strings.HasPrefix(arg, "-") && strings.Contains(arg, "://") {
+			fetched.url = arg
+			return fetched
+		}
+	}
+	// The URL is usually the last argument when it comes from a variable
+	for i := len(argv) - 1; i > 0; i-- {
+		if strings.HasPrefix(argv[i], "$") {
+			fetched.url = argv[i]
+			break
+		}
+	}
+	return fetched
+}
+
+// source names where a download comes from
+func (d *download) source() string {
+	if d.url == "" {
+		return "the network"
+	}
+	return d.url
+}
+
+// files returns the names a download may be saved under: the last path
+// segment of its URL and the file given with -o or -O
+func (d *download) files() []string {
+	var files []string
+	if d.url != "" && !strings.HasPrefix(d.url, "$") {
+		if u, err := url.Parse(d.url); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			files = append(files, path.Base(u.Path))
+		}
+	}
+	argv := d.cmd.Effective()
+	for i, arg := range argv[:len(argv)-1] {
+		if arg == "-o" || arg == "-O" || arg == "--output" || arg == "--output-document" {
+			if next := argv[i+1]; next != "-" {
+				files = append(files, path.Base(next))
+			}
+		}
+	}
+	return files
+}
+
+// savesFile reports whether a download is written to a file rather than to
+// standard output
+func (d *download) savesFile() bool {
+	for _, redirect := range d.cmd.Redirects {
+		if (redirect.Op == ">" || redirect.Op == ">>") && (redirect.Fd == "" || redirect.Fd == "1") {
+			return true
+		}
+	}
+
+	if d.cmd.EffectiveName() == "curl" {
+		return d.cmd.HasFlag("-o", "-O", "--output", "--remote-name", "--remote-name-all")
+	}
+
+	// wget saves to a file unless given -O -
+	argv := d.cmd.Effective()
+	for i, arg := range argv {
+		switch {
+		case arg == "--output-document=-", arg == "-O-":
+			return false
+		case (arg == "-O" || arg == "--output-document") && i+1 < len(argv) && argv[i+1] == "-":
+			return false
+		case !strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, "O-"):
+			return false // -qO-
+		}
+	}
+	return true
+}
+
+// extractedBy reports whether the commands a download is piped into unpack
+// it to disk
+func extractedBy(commands []shell.Command) bool {
+	for _, command := range commands {
+		if cmd, ok := command.(*shell.SimpleCommand); ok && extractors[cmd.EffectiveName()] {
+			return true
+		}
+	}
+	return false
+}
+
+// isInterpreter reports whether a command runs the script it is given
+func isInterpreter(name string) bool {
+	return shell.IsShell(name) || interpreters[name] || strings.HasPrefix(name, "python")
+}
+
+// runScripts returns the script of a RUN instruction and the scripts its
+// commands pass to a shell with -c
+func runScripts(inst parser.Instruction) []*shell.Script {
+	if inst.Shell == nil {
+		return nil
+	}
+	scripts := []*shell.Script{inst.Shell}
+	for i := 0; i < len(scripts); i++ {
+		for _, cmd := range scripts[i].Commands() {
+			if inline := cmd.InlineScript(); inline != nil {
+				scripts = append(scripts, inline)
+			}
+		}
+	}
+	return scripts
+}
+
+// verificationFile reports whether a URL is a checksum, signature or key
+// file
+func verificationFile(rawURL string) bool {
+	name := strings.ToLower(path.Base(rawURL))
+	for _, suffix := range verificationFiles {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainHTTP reports whether a URL is fetched over unencrypted HTTP from a
+// host other than the build machine itself
+func plainHTTP(rawURL string) bool {
+	return strings.HasPrefix(strings.ToLower(rawURL), "http://") && !loopback(rawURL)
+}
+
+// loopback reports whether a URL points at the build machine itself
+func loopback(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || host == "::1" || host == "0.0.0.0" || strings.HasPrefix(host, "127.")
+}
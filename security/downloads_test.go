@@ -0,0 +1,43 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// parseContext parses a Dockerfile into a rule context
+func parseContext(t *testing.T, source string) *checks.Context {
+	t.Helper()
+	dockerfile, err := parser.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &checks.Context{Dockerfile: dockerfile}
+}
+
+func TestCheckUnverifiedDownloads(t *testing.T) {
+	tests := []struct {
+		name, runs string
+		want       int
+	}{
+		{"unverified", "RUN curl -fsSL https://example.com/app.tgz -o /tmp/app.tgz", 1},
+		{"same RUN", "RUN curl -fsSL https://example.com/app.tgz -o app.tgz && echo \"$SHA256  app.tgz\" | sha256sum -c -", 0},
+		{"next RUN pipes the file name", "RUN curl -fsSL https://example.com/app.tgz -o /tmp/app.tgz\nRUN echo \"$SHA256  /tmp/app.tgz\" | sha256sum -c -", 0},
+		{"next RUN checks the signature", "RUN curl -fsSLO https://example.com/app.tgz\nRUN gpg --verify app.tgz.asc app.tgz", 0},
+		{"near miss", "RUN curl -k https://x -o /tmp/x\nRUN sha256sum -c x.sha", 1},
+		{"next RUN verifies another file", "RUN curl -fsSL https://example.com/app.tgz -o app.tgz\nRUN sha256sum -c other.sha256 && tar xzf app.tgz", 1},
+		{"next RUN only uses the file", "RUN curl -fsSL https://example.com/app.tgz -o app.tgz\nRUN tar xzf app.tgz", 1},
+		{"weak checksum", "RUN curl -fsSL https://example.com/app.tgz -o app.tgz && md5sum app.tgz", 1},
+		{"checksum file", "RUN curl -fsSLO https://example.com/app.tgz.sha256", 0},
+		{"piped into a shell", "RUN curl -fsSL https://example.com/install.sh | sh", 0},
+	}
+	for _, tt := range tests {
+		ctx := parseContext(t, "FROM alpine:3.19\n"+tt.runs+"\n")
+		if issues := checkUnverifiedDownloads(ctx); len(issues) != tt.want {
+			t.Errorf("%s: got %d issues, want %d: %+v", tt.name, len(issues), tt.want, issues)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+)
+
+// checkUnpinnedBaseImage finds stages starting from an external image that
+// is named by a tag alone. A tag, even a specific version, can be re-pushed
+// to point at different content; only a digest names fixed content.
+func checkUnpinnedBaseImage(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, stage := range ctx.Dockerfile.Stages {
+		image := stage.BaseImage
+		if stage.Parent != nil || image == "" || image == "scratch" || strings.Contains(image, "@sha256:") {
+			continue
+		}
+
+		// Name the ARG when the image comes from one, since that is where
+		// the digest has to go
+		subject := image
+		if raw := stage.From.RawImage(); strings.Contains(raw, "$") {
+			subject = fmt.Sprintf("%s (%s)", raw, image)
+		}
+
+		path := ctx.Dockerfile.Path
+		if path == "" {
+			path = "Dockerfile"
+		}
+		issues = append(issues, checks.Issue{
+			Type:    checks.SecurityIssue,
+			Message: fmt.Sprintf("Base image %s is not pinned to a digest — the tag can be re-pushed with different content", subject),
+			Fix:     fmt.Sprintf("Run 'dock-slimcheck pin %s' to pin it to the digest the tag points to now, as image:tag@sha256:...", path),
+			Impact:  "Builds may silently pick up a different, possibly compromised, base image",
+			References: []string{
+				"https://docs.docker.com/build/building/best-practices/#pin-base-image-versions",
+			},
+			Stage: stage.String(),
+			Line:  stage.From.Line,
+		})
+	}
+
+	return issues
+}
@@ -0,0 +1,243 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/container"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// Limits of the scan of the files a COPY or ADD instruction brings in
+const (
+	maxScannedFiles    = 5000
+	maxScannedFileSize = 1 << 20
+)
+
+// configExtensions are the file types whose key/value lines are checked for
+// secret-like keys; other text files are only checked for token formats
+var configExtensions = map[string]bool{
+	".env": true, ".properties": true, ".ini": true, ".cfg": true, ".conf": true,
+	".yaml": true, ".yml": true, ".toml": true, ".json": true, ".xml": true,
+}
+
+// fileSecret is a secret found on a line of a file
+type fileSecret struct {
+	line     int
+	kind     string
+	value    string
+	severity checks.Severity
+}
+
+// copiedSecrets reports the local files and here-documents a COPY or ADD
+// instruction brings into the image that hold secrets. Files left out by
+// .dockerignore are not sent to the builder and are skipped.
+func copiedSecrets(ctx *checks.Context, inst parser.Instruction) []checks.Issue {
+	var issues []checks.Issue
+	if inst.HasFlag("from") {
+		return issues
+	}
+
+	for _, heredoc := range inst.Heredocs {
+		target := inst.Destination()
+		if secrets := scanFile(path.Base(target), []byte(heredoc.Body)); len(secrets) > 0 {
+			issues = append(issues, fileSecretIssue(inst.Command, "a here-document copied to "+target, target, secrets))
+		}
+	}
+	if ctx.ContextDir == "" {
+		return issues
+	}
+
+	ignored, err := container.ContextFilter(ctx.ContextDir)
+	if err != nil {
+		ignored = func(string) bool { return false }
+	}
+	root, err := filepath.Abs(ctx.ContextDir)
+	if err != nil {
+		return issues
+	}
+	// Secrets written in the Dockerfile itself are reported by instruction
+	dockerfile, _ := filepath.Abs(ctx.Dockerfile.Path)
+
+	budget := maxScannedFiles
+	for _, source := range inst.Sources() {
+		if parser.IsURL(source) || parser.IsGitSource(source) || strings.HasPrefix(source, "<<") || strings.Contains(source, "$") {
+			continue
+		}
+		pattern := filepath.Join(root, filepath.FromSlash(path.Clean("/"+source)))
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			_ = filepath.WalkDir(match, func(file string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				rel, err := filepath.Rel(root, file)
+				if err != nil {
+					return nil
+				}
+				rel = filepath.ToSlash(rel)
+				if entry.IsDir() {
+					if entry.Name() == ".git" || rel != "." && ignored(rel) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !entry.Type().IsRegular() || ignored(rel) || file == dockerfile {
+					return nil
+				}
+				if budget--; budget < 0 {
+					return filepath.SkipAll
+				}
+
+				info, err := entry.Info()
+				if err != nil || info.Size() > maxScannedFileSize {
+					return nil
+				}
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return nil
+				}
+				if secrets := scanFile(entry.Name(), data); len(secrets) > 0 {
+					issues = append(issues, fileSecretIssue(inst.Command, rel, copiedPath(inst, match, file), secrets))
+				}
+				return nil
+			})
+		}
+	}
+
+	return issues
+}
+
+// scanFile finds secrets in a text file: token formats on any line, and
+// values of secret-like keys in configuration files
+func scanFile(name string, data []byte) []fileSecret {
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return nil // Binary file
+	}
+	config := configExtensions[strings.ToLower(filepath.Ext(name))] || strings.HasPrefix(name, ".env") || credentialFile(name) != ""
+
+	var secrets []fileSecret
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxScannedFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if pattern := matchSecretPattern(text); pattern != "" {
+			secrets = append(secrets, fileSecret{line, pattern, secretMatch(text), checks.SeverityCritical})
+			continue
+		}
+		if match := urlCredentialRegex.FindStringSubmatch(text); match != nil && !isPlaceholder(match[1]) {
+			secrets = append(secrets, fileSecret{line, "password in a URL", match[1], checks.SeverityHigh})
+			continue
+		}
+		if !config {
+			continue
+		}
+		if key, value := keyValue(text); key != "" && isSecretName(key) && looksLikeSecret(value) {
+			secrets = append(secrets, fileSecret{line, key, value, checks.SeverityHigh})
+		}
+	}
+	return secrets
+}
+
+// keyValue splits a configuration line such as KEY=value, key: value,
+// "key": "value" or a .netrc "password value" pair
+func keyValue(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+		return "", ""
+	}
+	fields := strings.Fields(line)
+	for i, field := range fields[:len(fields)-1] {
+		if field == "password" {
+			return "password", fields[i+1]
+		}
+	}
+
+	line = strings.TrimPrefix(line, "export ")
+	separator := strings.Index(line, "=")
+	if separator < 0 {
+		separator = strings.Index(line, ":")
+	}
+	if separator <= 0 {
+		return "", ""
+	}
+	key := strings.Trim(strings.TrimSpace(line[:separator]), `"'`)
+	value := strings.TrimSpace(line[separator+1:])
+	value = strings.Trim(strings.TrimSuffix(value, ","), `"' `)
+	// The last segment names the setting: _authToken in //registry/:_authToken
+	key = key[strings.LastIndexAny(key, "/:")+1:]
+	return key, value
+}
+
+// looksLikeSecret reports whether a value of a secret-like key is an actual
+// secret rather than a placeholder or a weak example such as "changeme"
+func looksLikeSecret(value string) bool {
+	return len(value) >= 8 && !isPlaceholder(value) && entropy(value) >= 3
+}
+
+// fileSecretIssue describes the secrets found in a copied file
+func fileSecretIssue(command, source, target string, secrets []fileSecret) checks.Issue {
+	first := secrets[0]
+	message := fmt.Sprintf("%s brings %s into the image, which holds %s (%s) on line %d", command, source, describeSecret(first.kind), redact(first.value), first.line)
+	if len(secrets) > 1 {
+		message += fmt.Sprintf(" and %d more", len(secrets)-1)
+	}
+
+	var details []string
+	severity := checks.SeverityUnset
+	for _, secret := range secrets {
+		details = append(details, fmt.Sprintf("Line %d: %s (%s)", secret.line, describeSecret(secret.kind), redact(secret.value)))
+		if secret.severity > severity {
+			severity = secret.severity
+		}
+	}
+
+	fix := fmt.Sprintf(secretFileMountFix, secretID(path.Base(target)), target)
+	if !strings.HasPrefix(source, "a here-document") {
+		fix = fmt.Sprintf("Add %s to .dockerignore so that it is not sent to the builder. ", source) + fix
+	}
+	return checks.Issue{
+		Message:  message,
+		Fix:      fix,
+		Severity: severity,
+		Details:  details,
+	}
+}
+
+// describeSecret names a secret by its token format or the key it is
+// assigned to
+func describeSecret(kind string) string {
+	for _, pattern := range secretPatterns {
+		if pattern.name == kind {
+			return withArticle(kind)
+		}
+	}
+	if kind == "password in a URL" {
+		return withArticle(kind)
+	}
+	return "a secret in its " + kind + " setting"
+}
+
+// copiedPath returns where a file copied from a source match lands in the
+// image
+func copiedPath(inst parser.Instruction, match, file string) string {
+	destination := inst.Destination()
+	if rel, err := filepath.Rel(match, file); err == nil && rel != "." {
+		// A directory source copies its contents into the destination
+		return path.Join(destination, filepath.ToSlash(rel))
+	}
+	if strings.HasSuffix(destination, "/") || len(inst.Sources()) > 1 {
+		return path.Join(destination, filepath.Base(file))
+	}
+	return destination
+}
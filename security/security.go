@@ -5,114 +5,210 @@ import (
 	"github.com/avirooppal/dock-slimscheck/parser"
 )
 
+func init() {
+	checks.Register(checks.NewRule("DS101", "root-user", checks.CategorySecurity, checks.SeverityHigh,
+		"The container runs as root, explicitly or because USER is never set", checkRootUser))
+	checks.Register(checks.NewRule("DS102", "add-url", checks.CategorySecurity, checks.SeverityHigh,
+		"ADD downloads a remote URL without verifying it with --checksum", checkAddWithURL))
+	checks.Register(checks.NewRule("DS103", "exposed-ports", checks.CategorySecurity, checks.SeverityLow,
+		"EXPOSE declares ports that should be reviewed", checkExposedPorts))
+	checks.Register(checks.NewRule("DS104", "copy-without-chown", checks.CategorySecurity, checks.SeverityLow,
+		"Files are copied without --chown although a USER is set", checkCopyChown))
+	checks.Register(checks.NewRule("DS105", "no-nonroot-user", checks.CategorySecurity, checks.SeverityHigh,
+		"The final USER is missing or root", checkNonRootUser))
+	checks.Register(checks.NewRule("DS106", "no-healthcheck", checks.CategorySecurity, checks.SeverityLow,
+		"The final stage has no HEALTHCHECK for health monitoring", checkHealthcheck))
+	checks.Register(checks.NewRule("DS107", "arg-before-from", checks.CategorySecurity, checks.SeverityMedium,
+		"ARG is declared before the first FROM", checkArgBeforeFrom))
+	checks.Register(checks.NewRule("DS108", "unpinned-base-image", checks.CategorySecurity, checks.SeverityMedium,
+		"A FROM image is not pinned to a digest", checkUnpinnedBaseImage))
+	checks.Register(checks.NewRule("DS109", "vulnerable-package", checks.CategorySecurity, checks.SeverityMedium,
+		"An installed OS package has known vulnerabilities in the advisories given with --advisories", checkVulnerablePackages))
+	checks.Register(checks.NewRule("DS110", "hardcoded-secret", checks.CategorySecurity, checks.SeverityHigh,
+		"A secret is written into the image or its history by ENV, ARG, RUN or a copied file", checkSecrets))
+	checks.Register(checks.NewRule("DS111", "remote-script-pipe", checks.CategorySecurity, checks.SeverityHigh,
+		"A RUN instruction runs a script straight from a download, as in curl | sh", checkRemoteScripts))
+	checks.Register(checks.NewRule("DS112", "insecure-transport", checks.CategorySecurity, checks.SeverityHigh,
+		"A download turns off TLS or signature verification, or uses plain HTTP", checkInsecureTransport))
+	checks.Register(checks.NewRule("DS113", "unverified-download", checks.CategorySecurity, checks.SeverityMedium,
+		"A RUN instruction saves a download without verifying a checksum or signature", checkUnverifiedDownloads))
+	checks.Register(checks.NewRule("DS114", "unpinned-git-source", checks.CategorySecurity, checks.SeverityMedium,
+		"ADD takes a git repository at a branch, tag or default branch instead of a commit", checkGitSources))
+}
+
 // RunSecurityChecks performs security checks on the Dockerfile
 func RunSecurityChecks(dockerfile *parser.Dockerfile) []checks.Issue {
+	return checks.RunCategory(&checks.Context{Dockerfile: dockerfile}, checks.CategorySecurity)
+}
+
+// checkRootUser checks for root user (either explicit or implicit)
+func checkRootUser(ctx *checks.Context) []checks.Issue {
 	var issues []checks.Issue
 
-	// Check for root user (either explicit or implicit)
+	dockerfile := ctx.Dockerfile
+	final := dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
 	if dockerfile.UsesRootUser() || !dockerfile.HasUser() {
 		issues = append(issues, checks.Issue{
 			Type:    checks.SecurityIssue,
 			Message: "Container runs as root — create a non-root user",
+			Stage:   final.String(),
+			Line:    userLine(final),
 		})
 	}
 
-	// Check for ADD with URL
-	if dockerfile.HasAddWithURL() {
-		issues = append(issues, checks.Issue{
-			Type:    checks.SecurityIssue, 
-			Message: "Using ADD with URL — risky, use curl+wget instead",
-		})
+	return issues
+}
+
+// checkExposedPorts checks for unnecessary EXPOSE ports
+func checkExposedPorts(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
 	}
 
-	// Check for unnecessary EXPOSE ports
-	exposedPorts := dockerfile.GetExposedPorts()
+	exposedPorts := ctx.Dockerfile.GetExposedPorts()
 	if len(exposedPorts) > 0 {
 		// This is a simple heuristic - in a real implementation we would
 		// want to check if these exposed ports are actually needed
 		issues = append(issues, checks.Issue{
 			Type:    checks.SecurityIssue,
 			Message: "EXPOSE ports found — verify each port is necessary",
+			Stage:   final.String(),
+			Line:    firstLine(final, "EXPOSE"),
 		})
 	}
 
-	// Check for COPY --chown usage
-	hasCopyChown := false
-	for _, inst := range dockerfile.GetInstructionsByType("COPY") {
-		if inst.Arguments != "" && !hasCopyChown {
-			// Check if --chown is used
-			if containsFlag(inst.Arguments, "--chown") {
-				hasCopyChown = true
-				break
+	return issues
+}
+
+// checkCopyChown checks for COPY --chown usage
+func checkCopyChown(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
+	// Report the first COPY without --chown, nearest the final stage first,
+	// unless some COPY of the lineage sets an owner
+	var unowned *parser.Instruction
+	var unownedStage *parser.Stage
+	lineage := final.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		for _, inst := range lineage[i].GetInstructionsByType("COPY") {
+			if inst.HasFlag("chown") {
+				return issues
+			}
+			if unowned == nil {
+				copied := inst
+				unowned, unownedStage = &copied, lineage[i]
 			}
 		}
 	}
 
-	if !hasCopyChown && dockerfile.HasUser() {
+	if unowned != nil && ctx.Dockerfile.HasUser() {
 		issues = append(issues, checks.Issue{
 			Type:    checks.SecurityIssue,
 			Message: "COPY without --chown flag — may cause permission issues for non-root user",
+			Stage:   unownedStage.String(),
+			Line:    unowned.Line,
 		})
 	}
 
-	// Additional security checks
-	issues = append(issues, checkSecurityBestPractices(dockerfile)...)
-
 	return issues
 }
 
-// containsFlag checks if a string contains a specific flag
-func containsFlag(s, flag string) bool {
-	return len(s) >= len(flag) && s[:len(flag)] == flag
-}
-
-// checkSecurityBestPractices checks for additional security best practices
-func checkSecurityBestPractices(dockerfile *parser.Dockerfile) []checks.Issue {
+// checkNonRootUser checks if a specific USER is set and it's not root
+func checkNonRootUser(ctx *checks.Context) []checks.Issue {
 	var issues []checks.Issue
 
-	// Check if a specific USER is set and it's not root
-	hasNonRootUser := false
-	for _, inst := range dockerfile.GetInstructionsByType("USER") {
-		if inst.Arguments != "root" && inst.Arguments != "0" {
-			hasNonRootUser = true
-			break
-		}
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
 	}
 
-	if !hasNonRootUser {
+	user, _ := final.User()
+	if user == "" || parser.IsRootUser(user) {
 		issues = append(issues, checks.Issue{
 			Type:    checks.SecurityIssue,
 			Message: "No non-root USER specified — add 'USER nonroot' or similar",
+			Stage:   final.String(),
+			Line:    userLine(final),
 		})
 	}
 
-	// Check for HEALTHCHECK
-	if !dockerfile.HasHealthcheck() {
+	return issues
+}
+
+// checkHealthcheck checks for HEALTHCHECK
+func checkHealthcheck(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
+	if !ctx.Dockerfile.HasHealthcheck() {
 		issues = append(issues, checks.Issue{
 			Type:    checks.SecurityIssue,
 			Message: "No HEALTHCHECK — add one to ensure container health monitoring",
+			Stage:   final.String(),
+			Line:    final.From.Line,
 		})
 	}
 
-	// Check for ARG usage before FROM
-	hasArgBeforeFrom := false
-	seenFrom := false
-	
-	for _, inst := range dockerfile.Instructions {
+	return issues
+}
+
+// checkArgBeforeFrom checks for ARG usage before FROM
+func checkArgBeforeFrom(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+
+	for _, inst := range ctx.Dockerfile.Instructions {
 		if inst.Command == "FROM" {
-			seenFrom = true
-		} else if inst.Command == "ARG" && !seenFrom {
-			hasArgBeforeFrom = true
 			break
 		}
-	}
-	
-	if hasArgBeforeFrom {
-		issues = append(issues, checks.Issue{
-			Type:    checks.SecurityIssue,
-			Message: "ARG used before FROM — these values persist in image history",
-		})
+		if inst.Command == "ARG" {
+			issues = append(issues, checks.Issue{
+				Type:    checks.SecurityIssue,
+				Message: "ARG used before FROM — these values persist in image history",
+				Line:    inst.Line,
+			})
+			break
+		}
 	}
 
 	return issues
-}
\ No newline at end of file
+}
+
+// userLine returns the line of the USER instruction in effect for a stage,
+// or the line of its FROM when no USER is set
+func userLine(stage *parser.Stage) int {
+	for _, s := range stage.Lineage() {
+		users := s.GetInstructionsByType("USER")
+		if len(users) > 0 {
+			return users[len(users)-1].Line
+		}
+	}
+	return stage.From.Line
+}
+
+// firstLine returns the line of the first instruction of a type in the stage
+// or the stages it is built from, or 0 when there is none
+func firstLine(stage *parser.Stage, command string) int {
+	lineage := stage.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		if insts := lineage[i].GetInstructionsByType(command); len(insts) > 0 {
+			return insts[0].Line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,25 @@
+package security
+
+import "testing"
+
+func TestCheckCopyChown(t *testing.T) {
+	tests := []struct {
+		name, source string
+		line         int // Line reported, 0 for no issue
+	}{
+		{"no COPY", "FROM alpine:3.19\nRUN adduser -D app\nUSER app\n", 0},
+		{"COPY without --chown", "FROM alpine:3.19\nRUN adduser -D app\nCOPY app /app\nUSER app\n", 3},
+		{"COPY with --chown", "FROM alpine:3.19\nRUN adduser -D app\nCOPY app /app\nCOPY --chown=app conf /conf\nUSER app\n", 0},
+		{"no USER", "FROM alpine:3.19\nCOPY app /app\n", 0},
+		{"COPY in the parent stage", "FROM alpine:3.19 AS base\nCOPY app /app\nFROM base\nUSER app\n", 2},
+	}
+	for _, tt := range tests {
+		issues := checkCopyChown(parseContext(t, tt.source))
+		switch {
+		case tt.line == 0 && len(issues) != 0:
+			t.Errorf("%s: got %+v, want no issue", tt.name, issues)
+		case tt.line != 0 && (len(issues) != 1 || issues[0].Line != tt.line):
+			t.Errorf("%s: got %+v, want one issue at line %d", tt.name, issues, tt.line)
+		}
+	}
+}
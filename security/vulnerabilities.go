@@ -0,0 +1,171 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/checks"
+	"github.com/avirooppal/dock-slimscheck/vuln"
+)
+
+// maxListedCVEs limits the CVE IDs named in an issue message
+const maxListedCVEs = 5
+
+// checkVulnerablePackages matches the OS packages of the image against the
+// advisories given with --advisories. The packages are read from the
+// dpkg, apk and rpm databases of the analyzed image, or, without an image,
+// from the versions pinned by apt-get install and apk add. Each vulnerable
+// package becomes one issue, rated by its most severe advisory.
+func checkVulnerablePackages(ctx *checks.Context) []checks.Issue {
+	var issues []checks.Issue
+	if ctx.Advisories == nil {
+		return issues
+	}
+	final := ctx.Dockerfile.FinalStage()
+	if final == nil {
+		return issues
+	}
+
+	packages := vuln.DockerfileInventory(ctx.Dockerfile)
+	source := "version pins of the Dockerfile"
+	if ctx.Image != nil {
+		var err error
+		packages, err = vuln.ImageInventory(ctx.Image)
+		if err != nil {
+			return append(issues, checks.Issue{
+				Type:     checks.InfoIssue,
+				Message:  fmt.Sprintf("Could not read the installed packages of the image: %v", err),
+				Severity: checks.SeverityInfo,
+				Stage:    final.String(),
+				Line:     final.Root().From.Line,
+			})
+		}
+		source = "package databases of the image"
+	}
+
+	for _, pkg := range packages {
+		findings := ctx.Advisories.Match(pkg)
+		if len(findings) == 0 {
+			continue
+		}
+		issue := vulnerabilityIssue(pkg, findings)
+		origin := fmt.Sprintf("Packages read from the %s, as %s", source, pkg.Ecosystem())
+		if pkg.Ecosystem() == "" {
+			origin = fmt.Sprintf("Packages read from the %s; the distro is not known, so advisories of every release apply", source)
+		}
+		issue.Details = append(issue.Details, installedBy(pkg), origin)
+
+		issue.Stage, issue.Line = final.String(), final.Root().From.Line
+		if pkg.Instruction != nil && pkg.Instruction.Line > 0 {
+			if stage := ctx.Dockerfile.StageOf(*pkg.Instruction); stage != nil {
+				issue.Stage = stage.String()
+			}
+			issue.Line, issue.EndLine = pkg.Instruction.Line, pkg.Instruction.EndLine
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// vulnerabilityIssue describes the advisories affecting a package
+func vulnerabilityIssue(pkg vuln.Package, findings []vuln.Finding) checks.Issue {
+	var cves, details, references, unfixed []string
+	seen := map[string]bool{}
+	fixed := ""
+	severity := checks.SeverityUnset
+
+	for _, finding := range findings {
+		advisory := finding.Advisory
+		ids := advisory.CVEs()
+		if len(ids) == 0 {
+			ids = []string{advisory.ID}
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				cves = append(cves, id)
+				seen[id] = true
+			}
+		}
+
+		detail := advisory.ID
+		if finding.Severity != "" {
+			detail += " (" + finding.Severity + ")"
+		}
+		if finding.Fixed != "" {
+			detail += ": fixed in " + finding.Fixed
+		} else {
+			detail += ": no fixed version yet"
+			unfixed = append(unfixed, ids[0])
+		}
+		if finding.Package != pkg.Name {
+			detail += ", through source package " + finding.Package
+		}
+		if advisory.Summary != "" {
+			detail += " — " + advisory.Summary
+		}
+		details = append(details, detail)
+		references = append(references, advisory.URL())
+
+		if finding.Fixed != "" && (fixed == "" || vuln.CompareVersions(pkg.Format, finding.Fixed, fixed) > 0) {
+			fixed = finding.Fixed
+		}
+		if rated, err := checks.ParseSeverity(finding.Severity); err == nil && rated > severity {
+			severity = rated
+		}
+	}
+
+	listed := cves
+	if len(listed) > maxListedCVEs {
+		listed = append(listed[:maxListedCVEs:maxListedCVEs], fmt.Sprintf("and %d more", len(cves)-maxListedCVEs))
+	}
+	noun := "vulnerability"
+	if len(cves) > 1 {
+		noun = "vulnerabilities"
+	}
+
+	var fix string
+	switch {
+	case fixed == "":
+		fix = fmt.Sprintf("No fixed version of %s is published yet; remove the package if the image does not need it", pkg.Name)
+	case pkg.Layer != nil && pkg.Instruction == nil:
+		fix = fmt.Sprintf("Rebuild on an updated base image, or upgrade %s to %s or later", pkg.Name, fixed)
+	case pkg.Layer == nil:
+		fix = fmt.Sprintf("Pin %s to %s or later", pkg.Name, fixed)
+	default:
+		fix = fmt.Sprintf("Upgrade %s to %s or later", pkg.Name, fixed)
+	}
+	if fixed != "" && len(unfixed) > 0 {
+		fix += fmt.Sprintf("; %s %s no fix yet", strings.Join(unfixed, ", "), hasOrHave(len(unfixed)))
+	}
+
+	return checks.Issue{
+		Type:       checks.SecurityIssue,
+		Message:    fmt.Sprintf("%s %s has %d known %s: %s", pkg.Name, pkg.Version, len(cves), noun, strings.Join(listed, ", ")),
+		Fix:        fix,
+		Severity:   severity,
+		Impact:     "Known vulnerabilities in installed packages can be exploited in the running container",
+		References: references,
+		Details:    details,
+	}
+}
+
+// installedBy names the layer or instruction that brought in a package
+func installedBy(pkg vuln.Package) string {
+	switch {
+	case pkg.Layer != nil && pkg.Layer.CreatedBy() != "":
+		return fmt.Sprintf("Installed by layer %d: %s", pkg.Layer.Index, strings.TrimSpace(pkg.Layer.CreatedBy()))
+	case pkg.Layer != nil:
+		return fmt.Sprintf("Installed by layer %d", pkg.Layer.Index)
+	case pkg.Instruction != nil:
+		return fmt.Sprintf("Pinned as %s=%s at line %d", pkg.Name, pkg.Version, pkg.Instruction.Line)
+	}
+	return "Installed by an unknown layer"
+}
+
+func hasOrHave(n int) string {
+	if n == 1 {
+		return "has"
+	}
+	return "have"
+}
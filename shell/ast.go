@@ -0,0 +1,167 @@
+package shell
+
+import "strings"
+
+// Script is a parsed shell program: a sequence of and-or lists separated by
+// ';', '&' or newlines
+type Script struct {
+	Lists []*AndOr
+}
+
+// AndOr is a chain of pipelines joined by && and ||
+type AndOr struct {
+	Pipelines  []*Pipeline
+	Ops        []string // Ops[i] joins Pipelines[i] and Pipelines[i+1]
+	Background bool     // Terminated by '&'
+}
+
+// Pipeline is a sequence of commands joined by '|'
+type Pipeline struct {
+	Negated  bool
+	Commands []Command
+}
+
+// Command is a simple command or a compound command
+type Command interface {
+	command()
+}
+
+// SimpleCommand is a command name with its arguments, assignments and redirects
+type SimpleCommand struct {
+	Assigns   []*Assign
+	Words     []*Word
+	Redirects []*Redirect
+	Pos       int  // Byte offset of the command in the source
+	Line      int  // Line of the command in the source, starting at 1
+	OnFailure bool // Runs only when an earlier command in its && / || chain failed
+}
+
+// Subshell is a list run in a child shell: ( list )
+type Subshell struct {
+	Body      *Script
+	Redirects []*Redirect
+}
+
+// Group is a list run in the current shell: { list; }
+type Group struct {
+	Body      *Script
+	Redirects []*Redirect
+}
+
+// IfClause is an if/elif/else conditional
+type IfClause struct {
+	Conds     []*Script
+	Thens     []*Script // Thens[i] runs when Conds[i] succeeds; nil when the script ends before its then
+	Else      *Script
+	Redirects []*Redirect
+}
+
+// LoopClause is a while or until loop
+type LoopClause struct {
+	Until     bool
+	Cond      *Script
+	Body      *Script
+	Redirects []*Redirect
+}
+
+// ForClause is a for loop over a list of words
+type ForClause struct {
+	Name      string
+	Items     []*Word
+	Body      *Script
+	Redirects []*Redirect
+}
+
+// CaseClause is a case statement
+type CaseClause struct {
+	Word      *Word
+	Items     []*CaseItem
+	Redirects []*Redirect
+}
+
+// CaseItem is one pattern list and body inside a case statement
+type CaseItem struct {
+	Patterns []*Word
+	Body     *Script
+}
+
+// FuncDecl is a shell function definition
+type FuncDecl struct {
+	Name string
+	Body Command
+}
+
+func (*SimpleCommand) command() {}
+func (*Subshell) command()      {}
+func (*Group) command()         {}
+func (*IfClause) command()      {}
+func (*LoopClause) command()    {}
+func (*ForClause) command()     {}
+func (*CaseClause) command()    {}
+func (*FuncDecl) command()      {}
+
+// Word is a shell word. Value has quotes and escapes removed while parameter
+// expansions and command substitutions are kept as written.
+type Word struct {
+	Raw    string
+	Value  string
+	Quoted bool      // Some part of the word was quoted
+	Substs []*Script // Command substitutions inside the word
+}
+
+// Assign is a NAME=value prefix of a simple command
+type Assign struct {
+	Name  string
+	Value *Word
+}
+
+// Redirect is an I/O redirection such as > file, 2>&1 or <<EOF
+type Redirect struct {
+	Fd      string // Explicit file descriptor, if any
+	Op      string
+	Target  *Word
+	Heredoc string // Body of a << or <<- redirection
+}
+
+// Name returns the command name, or "" for a command made of assignments only
+func (c *SimpleCommand) Name() string {
+	if len(c.Words) == 0 {
+		return ""
+	}
+	return c.Words[0].Value
+}
+
+// Argv returns the command name and arguments with quotes removed
+func (c *SimpleCommand) Argv() []string {
+	argv := make([]string, len(c.Words))
+	for i, word := range c.Words {
+		argv[i] = word.Value
+	}
+	return argv
+}
+
+// Args returns the arguments following the command name
+func (c *SimpleCommand) Args() []string {
+	argv := c.Argv()
+	if len(argv) == 0 {
+		return nil
+	}
+	return argv[1:]
+}
+
+// BaseName returns the command name without any leading directory
+func (c *SimpleCommand) BaseName() string {
+	return baseName(c.Name())
+}
+
+// String returns the command as written, without redirects
+func (c *SimpleCommand) String() string {
+	var parts []string
+	for _, assign := range c.Assigns {
+		parts = append(parts, assign.Name+"="+assign.Value.Raw)
+	}
+	for _, word := range c.Words {
+		parts = append(parts, word.Raw)
+	}
+	return strings.Join(parts, " ")
+}
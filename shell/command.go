@@ -0,0 +1,116 @@
+package shell
+
+import "strings"
+
+// wrappers are commands that run their arguments as another command
+var wrappers = map[string]bool{
+	"sudo":    true,
+	"env":     true,
+	"nohup":   true,
+	"time":    true,
+	"command": true,
+	"exec":    true,
+}
+
+// wrapperValueOptions are wrapper options that take a separate value
+var wrapperValueOptions = map[string]bool{
+	"-u": true,
+	"-g": true,
+	"-C": true,
+}
+
+// shells are interpreters that accept a script with -c
+var shells = map[string]bool{
+	"sh":   true,
+	"bash": true,
+	"dash": true,
+	"ash":  true,
+	"zsh":  true,
+	"ksh":  true,
+}
+
+// Effective returns the argv of the command that actually runs, skipping
+// wrappers such as sudo, env and nohup together with their options
+func (c *SimpleCommand) Effective() []string {
+	argv := c.Argv()
+
+	for len(argv) > 0 && wrappers[baseName(argv[0])] {
+		argv = skipWrapperOptions(baseName(argv[0]), argv[1:])
+	}
+
+	return argv
+}
+
+// skipWrapperOptions drops the options a wrapper takes before its command
+func skipWrapperOptions(wrapper string, argv []string) []string {
+	for len(argv) > 0 {
+		arg := argv[0]
+		switch {
+		case wrapperValueOptions[arg] && len(argv) > 1:
+			argv = argv[2:]
+		case strings.HasPrefix(arg, "-"), wrapper == "env" && strings.Contains(arg, "="):
+			argv = argv[1:]
+		default:
+			return argv
+		}
+	}
+	return argv
+}
+
+// EffectiveName returns the base name of the command that actually runs
+func (c *SimpleCommand) EffectiveName() string {
+	argv := c.Effective()
+	if len(argv) == 0 {
+		return ""
+	}
+	return baseName(argv[0])
+}
+
+// InlineScript parses the script passed to a shell with -c, as in
+// sh -c "apt-get update && apt-get install -y curl"
+func (c *SimpleCommand) InlineScript() *Script {
+	argv := c.Effective()
+	if len(argv) < 3 || !IsShell(argv[0]) {
+		return nil
+	}
+
+	for i, arg := range argv[1 : len(argv)-1] {
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") {
+			script, _ := Parse(argv[i+2])
+			return script
+		}
+	}
+	return nil
+}
+
+// IsShell reports whether a command name refers to a POSIX-like shell
+func IsShell(name string) bool {
+	return shells[baseName(name)]
+}
+
+// HasFlag reports whether the command was given an option, matching long
+// options exactly and short options inside combined flags such as -yq
+func (c *SimpleCommand) HasFlag(names ...string) bool {
+	for _, arg := range c.Effective() {
+		if arg == "--" {
+			return false
+		}
+		for _, name := range names {
+			switch {
+			case strings.HasPrefix(name, "--"):
+				if arg == name || strings.HasPrefix(arg, name+"=") {
+					return true
+				}
+			case len(name) == 2 && strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+				if strings.Contains(arg[1:], name[1:]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func baseName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
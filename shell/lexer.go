@@ -0,0 +1,427 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind classifies the tokens produced by the lexer
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokOperator
+	tokRedirect
+)
+
+// token is a single lexical token of a shell script
+type token struct {
+	kind tokenKind
+	text string // Operator text, or raw word text
+	word *Word
+	fd   string // File descriptor prefix of a redirect
+	pos  int
+	line int
+}
+
+// controlOperators lists operators in longest-match order
+var controlOperators = []string{"&&", "||", ";;", ";", "&", "|", "(", ")"}
+
+// redirectOperators lists redirection operators in longest-match order
+var redirectOperators = []string{"<<-", "<<", ">>", "<&", ">&", "<>", ">|", "<", ">"}
+
+// lexer splits a shell script into tokens
+type lexer struct {
+	src      string
+	pos      int
+	line     int
+	base     int // Offset of src within the enclosing script
+	heredocs []*heredocRequest
+}
+
+// heredocRequest is a heredoc whose body follows the next newline
+type heredocRequest struct {
+	redirect *Redirect
+	strip    bool
+}
+
+func newLexer(src string, line, base int) *lexer {
+	return &lexer{src: src, line: line, base: base}
+}
+
+// next returns the next token
+func (l *lexer) next() (token, error) {
+	l.skipBlanks()
+
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.base + l.pos, line: l.line}, nil
+	}
+
+	start, line := l.base+l.pos, l.line
+	c := l.src[l.pos]
+
+	if c == '\n' {
+		l.pos++
+		l.line++
+		if err := l.readHeredocs(); err != nil {
+			return token{}, err
+		}
+		return token{kind: tokOperator, text: "\n", pos: start, line: line}, nil
+	}
+
+	// Process substitution, as in bash <(curl -fsSL https://example.com)
+	if strings.HasPrefix(l.src[l.pos:], "<(") || strings.HasPrefix(l.src[l.pos:], ">(") {
+		word, err := l.readProcessSubstitution()
+		if err != nil {
+			return token{}, err
+		}
+		return token{kind: tokWord, text: word.Raw, word: word, pos: start, line: line}, nil
+	}
+
+	for _, op := range redirectOperators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokRedirect, text: op, pos: start, line: line}, nil
+		}
+	}
+
+	for _, op := range controlOperators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOperator, text: op, pos: start, line: line}, nil
+		}
+	}
+
+	word, err := l.readWord()
+	if err != nil {
+		return token{}, err
+	}
+
+	// A number directly followed by a redirection is a file descriptor
+	if isDigits(word.Raw) && l.pos < len(l.src) && (l.src[l.pos] == '<' || l.src[l.pos] == '>') {
+		for _, op := range redirectOperators {
+			if strings.HasPrefix(l.src[l.pos:], op) {
+				l.pos += len(op)
+				return token{kind: tokRedirect, text: op, fd: word.Raw, pos: start, line: line}, nil
+			}
+		}
+	}
+
+	return token{kind: tokWord, text: word.Raw, word: word, pos: start, line: line}, nil
+}
+
+// skipBlanks skips spaces, tabs, escaped newlines and comments
+func (l *lexer) skipBlanks() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '\n':
+			l.pos += 2
+			l.line++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readHeredocs consumes the bodies of heredocs declared on the previous line
+func (l *lexer) readHeredocs() error {
+	requests := l.heredocs
+	l.heredocs = nil
+
+	for _, request := range requests {
+		delimiter := request.redirect.Target.Value
+		var body strings.Builder
+		terminated := false
+
+		for l.pos < len(l.src) {
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			var line string
+			if end < 0 {
+				line = l.src[l.pos:]
+				l.pos = len(l.src)
+			} else {
+				line = l.src[l.pos : l.pos+end]
+				l.pos += end + 1
+			}
+			l.line++
+
+			if request.strip {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delimiter {
+				terminated = true
+				break
+			}
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+
+		if !terminated {
+			return fmt.Errorf("line %d: here-document delimited by end-of-file (wanted %q)", l.line, delimiter)
+		}
+		request.redirect.Heredoc = body.String()
+	}
+
+	return nil
+}
+
+// isMeta reports whether a byte ends an unquoted word
+func isMeta(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ';', '&', '|', '(', ')', '<', '>':
+		return true
+	}
+	return false
+}
+
+// readWord reads a word, tracking its quote-removed value and parsing any
+// command substitutions it contains
+func (l *lexer) readWord() (*Word, error) {
+	word := &Word{}
+	var raw, value strings.Builder
+
+	for l.pos < len(l.src) && !isMeta(l.src[l.pos]) {
+		c := l.src[l.pos]
+
+		switch c {
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				raw.WriteByte(c)
+				l.pos++
+				continue
+			}
+			next := l.src[l.pos+1]
+			l.pos += 2
+			if next == '\n' {
+				l.line++
+				continue
+			}
+			raw.WriteByte(c)
+			raw.WriteByte(next)
+			value.WriteByte(next)
+			word.Quoted = true
+		case '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", l.line)
+			}
+			quoted := l.src[l.pos+1 : l.pos+1+end]
+			raw.WriteString(l.src[l.pos : l.pos+end+2])
+			value.WriteString(quoted)
+			l.line += strings.Count(quoted, "\n")
+			l.pos += end + 2
+			word.Quoted = true
+		case '"':
+			if err := l.readDoubleQuote(word, &raw, &value); err != nil {
+				return nil, err
+			}
+			word.Quoted = true
+		case '$', '`':
+			text, err := l.readExpansion(word)
+			if err != nil {
+				return nil, err
+			}
+			raw.WriteString(text)
+			value.WriteString(text)
+		default:
+			raw.WriteByte(c)
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	word.Raw = raw.String()
+	word.Value = value.String()
+	return word, nil
+}
+
+// readDoubleQuote reads a double quoted section of a word
+func (l *lexer) readDoubleQuote(word *Word, raw, value *strings.Builder) error {
+	raw.WriteByte('"')
+	l.pos++
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		switch c {
+		case '"':
+			raw.WriteByte(c)
+			l.pos++
+			return nil
+		case '\\':
+			if l.pos+1 < len(l.src) {
+				next := l.src[l.pos+1]
+				l.pos += 2
+				switch next {
+				case '\n':
+					l.line++
+				case '$', '`', '"', '\\':
+					raw.WriteByte(c)
+					raw.WriteByte(next)
+					value.WriteByte(next)
+				default:
+					raw.WriteByte(c)
+					raw.WriteByte(next)
+					value.WriteByte(c)
+					value.WriteByte(next)
+				}
+				continue
+			}
+			raw.WriteByte(c)
+			value.WriteByte(c)
+			l.pos++
+		case '$', '`':
+			text, err := l.readExpansion(word)
+			if err != nil {
+				return err
+			}
+			raw.WriteString(text)
+			value.WriteString(text)
+		default:
+			if c == '\n' {
+				l.line++
+			}
+			raw.WriteByte(c)
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return fmt.Errorf("line %d: unterminated double quote", l.line)
+}
+
+// readExpansion reads a parameter expansion, arithmetic expansion or command
+// substitution starting at '$' or '`', returning its text as written
+func (l *lexer) readExpansion(word *Word) (string, error) {
+	start := l.pos
+
+	if l.src[l.pos] == '`' {
+		end := l.pos + 1
+		for end < len(l.src) && l.src[end] != '`' {
+			if l.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(l.src) {
+			return "", fmt.Errorf("line %d: unterminated backquote", l.line)
+		}
+		l.addSubstitution(word, l.pos+1, end)
+		l.pos = end + 1
+		return l.consumed(start), nil
+	}
+
+	l.pos++
+	if l.pos >= len(l.src) {
+		return "$", nil
+	}
+
+	switch l.src[l.pos] {
+	case '(':
+		arithmetic := strings.HasPrefix(l.src[l.pos:], "((")
+		end, err := l.matchClose(l.pos, '(', ')')
+		if err != nil {
+			return "", err
+		}
+		if !arithmetic {
+			l.addSubstitution(word, l.pos+1, end)
+		}
+		l.pos = end + 1
+	case '{':
+		end, err := l.matchClose(l.pos, '{', '}')
+		if err != nil {
+			return "", err
+		}
+		l.pos = end + 1
+	default:
+		for l.pos < len(l.src) && isNameByte(l.src[l.pos]) {
+			l.pos++
+		}
+		// Special parameters such as $? $@ $1
+		if l.pos == start+1 && l.pos < len(l.src) && strings.IndexByte("?@*#$!-0123456789", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+	}
+
+	return l.consumed(start), nil
+}
+
+// readProcessSubstitution reads a <(list) or >(list) word, whose list is
+// kept as a command substitution of the word
+func (l *lexer) readProcessSubstitution() (*Word, error) {
+	start := l.pos
+	end, err := l.matchClose(l.pos+1, '(', ')')
+	if err != nil {
+		return nil, err
+	}
+	word := &Word{}
+	l.addSubstitution(word, l.pos+2, end)
+	l.pos = end + 1
+	word.Raw = l.consumed(start)
+	word.Value = word.Raw
+	return word, nil
+}
+
+// consumed returns the source consumed since start and counts its newlines
+func (l *lexer) consumed(start int) string {
+	text := l.src[start:l.pos]
+	l.line += strings.Count(text, "\n")
+	return text
+}
+
+// matchClose finds the bracket closing the one at open, skipping quotes
+func (l *lexer) matchClose(open int, opening, closing byte) (int, error) {
+	depth := 0
+	for i := open; i < len(l.src); i++ {
+		switch c := l.src[i]; c {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(l.src[i+1:], '\'')
+			if end < 0 {
+				return 0, fmt.Errorf("line %d: unterminated single quote", l.line)
+			}
+			i += end + 1
+		case opening:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("line %d: missing closing '%c'", l.line, closing)
+}
+
+// addSubstitution parses the body of a command substitution, ignoring errors
+// so that unusual constructs do not hide the rest of the word
+func (l *lexer) addSubstitution(word *Word, start, end int) {
+	line := l.line + strings.Count(l.src[l.pos:start], "\n")
+	if script, _ := parse(l.src[start:end], line, l.base+start); script != nil {
+		word.Substs = append(word.Substs, script)
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,614 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var assignRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// reservedWords are recognized only in command position and when unquoted
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"do": true, "done": true, "while": true, "until": true, "for": true,
+	"case": true, "esac": true, "in": true, "{": true, "}": true, "!": true,
+}
+
+// parser builds a Script from the tokens of a lexer
+type parser struct {
+	lexer  *lexer
+	peeked *token
+}
+
+// Parse parses a POSIX shell script. On a syntax error it returns the part of
+// the script parsed so far together with the error.
+func Parse(src string) (*Script, error) {
+	return parse(src, 1, 0)
+}
+
+// parse parses a script that starts at the given line and byte offset
+func parse(src string, line, base int) (*Script, error) {
+	p := &parser{lexer: newLexer(src, line, base)}
+
+	script, err := p.parseList(nil)
+	if err == nil {
+		if tok, perr := p.peek(); perr != nil {
+			err = perr
+		} else if tok.kind != tokEOF {
+			err = fmt.Errorf("line %d: syntax error near unexpected token %q", tok.line, tok.text)
+		}
+	}
+
+	markFailurePaths(script, false)
+	return script, err
+}
+
+// FromArgv builds a script holding a single command, for exec form arguments
+func FromArgv(argv []string) *Script {
+	command := &SimpleCommand{Line: 1}
+	for _, arg := range argv {
+		command.Words = append(command.Words, &Word{Raw: arg, Value: arg})
+	}
+
+	return &Script{Lists: []*AndOr{{
+		Pipelines: []*Pipeline{{Commands: []Command{command}}},
+	}}}
+}
+
+func (p *parser) peek() (token, error) {
+	if p.peeked == nil {
+		tok, err := p.lexer.next()
+		if err != nil {
+			return tok, err
+		}
+		p.peeked = &tok
+	}
+	return *p.peeked, nil
+}
+
+func (p *parser) next() (token, error) {
+	tok, err := p.peek()
+	p.peeked = nil
+	return tok, err
+}
+
+// isOperator reports whether a token is the given control operator
+func isOperator(tok token, op string) bool {
+	return tok.kind == tokOperator && tok.text == op
+}
+
+// isReserved reports whether a token is the given unquoted reserved word
+func isReserved(tok token, word string) bool {
+	return tok.kind == tokWord && !tok.word.Quoted && tok.text == word
+}
+
+// skipNewlines consumes newline tokens
+func (p *parser) skipNewlines() error {
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return err
+		}
+		if !isOperator(tok, "\n") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+// parseList parses and-or lists until EOF, ')' , ';;' or one of the stop words
+func (p *parser) parseList(stops []string) (*Script, error) {
+	script := &Script{}
+
+	for {
+		if err := p.skipNewlines(); err != nil {
+			return script, err
+		}
+
+		tok, err := p.peek()
+		if err != nil {
+			return script, err
+		}
+		if tok.kind == tokEOF || isOperator(tok, ")") || isOperator(tok, ";;") {
+			return script, nil
+		}
+		for _, stop := range stops {
+			if isReserved(tok, stop) {
+				return script, nil
+			}
+		}
+
+		andOr, err := p.parseAndOr()
+		if andOr != nil {
+			script.Lists = append(script.Lists, andOr)
+		}
+		if err != nil {
+			return script, err
+		}
+
+		tok, err = p.peek()
+		if err != nil {
+			return script, err
+		}
+		switch {
+		case isOperator(tok, ";"), isOperator(tok, "\n"):
+			p.next()
+		case isOperator(tok, "&"):
+			p.next()
+			andOr.Background = true
+		}
+	}
+}
+
+// parseAndOr parses pipelines joined by && and ||
+func (p *parser) parseAndOr() (*AndOr, error) {
+	andOr := &AndOr{}
+
+	for {
+		pipeline, err := p.parsePipeline()
+		if pipeline != nil {
+			andOr.Pipelines = append(andOr.Pipelines, pipeline)
+		}
+		if err != nil {
+			return andOr, err
+		}
+
+		tok, err := p.peek()
+		if err != nil {
+			return andOr, err
+		}
+		if !isOperator(tok, "&&") && !isOperator(tok, "||") {
+			return andOr, nil
+		}
+		p.next()
+		andOr.Ops = append(andOr.Ops, tok.text)
+
+		if err := p.skipNewlines(); err != nil {
+			return andOr, err
+		}
+	}
+}
+
+// parsePipeline parses commands joined by '|', with an optional leading '!'
+func (p *parser) parsePipeline() (*Pipeline, error) {
+	pipeline := &Pipeline{}
+
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if isReserved(tok, "!") {
+		p.next()
+		pipeline.Negated = true
+	}
+
+	for {
+		command, err := p.parseCommand()
+		if command != nil {
+			pipeline.Commands = append(pipeline.Commands, command)
+		}
+		if err != nil {
+			return pipeline, err
+		}
+
+		tok, err := p.peek()
+		if err != nil {
+			return pipeline, err
+		}
+		if !isOperator(tok, "|") {
+			return pipeline, nil
+		}
+		p.next()
+
+		if err := p.skipNewlines(); err != nil {
+			return pipeline, err
+		}
+	}
+}
+
+// parseCommand parses a simple command, or a compound command followed by
+// its redirects
+func (p *parser) parseCommand() (Command, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	var compound Command
+	switch {
+	case isOperator(tok, "("):
+		compound, err = p.parseSubshell()
+	case isReserved(tok, "{"):
+		compound, err = p.parseGroup()
+	case isReserved(tok, "if"):
+		compound, err = p.parseIf()
+	case isReserved(tok, "while"), isReserved(tok, "until"):
+		compound, err = p.parseLoop()
+	case isReserved(tok, "for"):
+		compound, err = p.parseFor()
+	case isReserved(tok, "case"):
+		compound, err = p.parseCase()
+	}
+	if compound != nil {
+		if err != nil {
+			return compound, err
+		}
+		redirects, err := p.parseRedirects()
+		setRedirects(compound, redirects)
+		return compound, err
+	}
+
+	switch {
+	case tok.kind == tokWord && reservedWords[tok.text] && !tok.word.Quoted:
+		return nil, fmt.Errorf("line %d: syntax error near unexpected token %q", tok.line, tok.text)
+	case tok.kind == tokOperator && tok.text != "\n":
+		return nil, fmt.Errorf("line %d: syntax error near unexpected token %q", tok.line, tok.text)
+	}
+
+	return p.parseSimpleCommand()
+}
+
+// parseSubshell parses ( list )
+func (p *parser) parseSubshell() (Command, error) {
+	p.next()
+	subshell := &Subshell{}
+
+	var err error
+	subshell.Body, err = p.parseList(nil)
+	if err != nil {
+		return subshell, err
+	}
+	return subshell, p.expectOperator(")")
+}
+
+// parseGroup parses { list; }
+func (p *parser) parseGroup() (Command, error) {
+	p.next()
+	group := &Group{}
+
+	var err error
+	group.Body, err = p.parseList([]string{"}"})
+	if err != nil {
+		return group, err
+	}
+	return group, p.expectReserved("}")
+}
+
+// setRedirects attaches trailing redirects to a compound command
+func setRedirects(command Command, redirects []*Redirect) {
+	switch c := command.(type) {
+	case *Subshell:
+		c.Redirects = redirects
+	case *Group:
+		c.Redirects = redirects
+	case *IfClause:
+		c.Redirects = redirects
+	case *LoopClause:
+		c.Redirects = redirects
+	case *ForClause:
+		c.Redirects = redirects
+	case *CaseClause:
+		c.Redirects = redirects
+	}
+}
+
+// parseSimpleCommand parses assignments, words and redirects
+func (p *parser) parseSimpleCommand() (Command, error) {
+	command := &SimpleCommand{}
+	started := false
+
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return command, err
+		}
+		if !started {
+			command.Pos, command.Line = tok.pos, tok.line
+			started = true
+		}
+
+		switch tok.kind {
+		case tokRedirect:
+			redirect, err := p.parseRedirect()
+			if redirect != nil {
+				command.Redirects = append(command.Redirects, redirect)
+			}
+			if err != nil {
+				return command, err
+			}
+		case tokWord:
+			// "name()" starts a function definition
+			if len(command.Words) == 0 && len(command.Assigns) == 0 {
+				if fn, ok, err := p.tryFuncDecl(tok); ok || err != nil {
+					return fn, err
+				}
+			}
+
+			p.next()
+			if len(command.Words) == 0 && assignRegex.MatchString(tok.text) {
+				name, _, _ := strings.Cut(tok.text, "=")
+				value := *tok.word
+				value.Raw = tok.text[len(name)+1:]
+				value.Value = strings.TrimPrefix(value.Value, name+"=")
+				command.Assigns = append(command.Assigns, &Assign{Name: name, Value: &value})
+				continue
+			}
+			command.Words = append(command.Words, tok.word)
+		default:
+			if len(command.Words) == 0 && len(command.Assigns) == 0 && len(command.Redirects) == 0 {
+				return nil, fmt.Errorf("line %d: syntax error near unexpected token %q", tok.line, tok.text)
+			}
+			return command, nil
+		}
+	}
+}
+
+// tryFuncDecl parses "name() compound-command" when the tokens match
+func (p *parser) tryFuncDecl(name token) (Command, bool, error) {
+	rest := p.lexer.src[p.lexer.pos:]
+	trimmed := strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(trimmed, "()") || !assignRegex.MatchString(name.text+"=") {
+		return nil, false, nil
+	}
+
+	p.next()
+	p.lexer.pos += len(rest) - len(trimmed) + 2
+	if err := p.skipNewlines(); err != nil {
+		return nil, true, err
+	}
+
+	body, err := p.parseCommand()
+	return &FuncDecl{Name: name.text, Body: body}, true, err
+}
+
+// parseRedirect parses a redirection operator and its target
+func (p *parser) parseRedirect() (*Redirect, error) {
+	tok, _ := p.next()
+	redirect := &Redirect{Fd: tok.fd, Op: tok.text}
+
+	target, err := p.next()
+	if err != nil {
+		return redirect, err
+	}
+	if target.kind != tokWord {
+		return redirect, fmt.Errorf("line %d: syntax error near unexpected token %q", target.line, target.text)
+	}
+	redirect.Target = target.word
+
+	if redirect.Op == "<<" || redirect.Op == "<<-" {
+		p.lexer.heredocs = append(p.lexer.heredocs, &heredocRequest{
+			redirect: redirect,
+			strip:    redirect.Op == "<<-",
+		})
+	}
+
+	return redirect, nil
+}
+
+// parseRedirects parses the redirects following a compound command
+func (p *parser) parseRedirects() ([]*Redirect, error) {
+	var redirects []*Redirect
+	for {
+		tok, err := p.peek()
+		if err != nil || tok.kind != tokRedirect {
+			return redirects, err
+		}
+		redirect, err := p.parseRedirect()
+		redirects = append(redirects, redirect)
+		if err != nil {
+			return redirects, err
+		}
+	}
+}
+
+// parseIf parses if ... then ... [elif ... then ...] [else ...] fi
+func (p *parser) parseIf() (Command, error) {
+	clause := &IfClause{}
+	p.next()
+
+	for {
+		// Conds and Thens are appended in pairs, so walkers can index both
+		cond, err := p.parseList([]string{"then"})
+		if err == nil {
+			err = p.expectReserved("then")
+		}
+		if err != nil {
+			clause.Conds = append(clause.Conds, cond)
+			clause.Thens = append(clause.Thens, nil)
+			return clause, err
+		}
+
+		body, err := p.parseList([]string{"elif", "else", "fi"})
+		clause.Conds = append(clause.Conds, cond)
+		clause.Thens = append(clause.Thens, body)
+		if err != nil {
+			return clause, err
+		}
+
+		tok, err := p.next()
+		if err != nil {
+			return clause, err
+		}
+		switch {
+		case isReserved(tok, "elif"):
+			continue
+		case isReserved(tok, "else"):
+			clause.Else, err = p.parseList([]string{"fi"})
+			if err != nil {
+				return clause, err
+			}
+			return clause, p.expectReserved("fi")
+		case isReserved(tok, "fi"):
+			return clause, nil
+		default:
+			return clause, fmt.Errorf("line %d: syntax error: expected 'fi'", tok.line)
+		}
+	}
+}
+
+// parseLoop parses while/until ... do ... done
+func (p *parser) parseLoop() (Command, error) {
+	tok, _ := p.next()
+	loop := &LoopClause{Until: tok.text == "until"}
+
+	var err error
+	loop.Cond, err = p.parseList([]string{"do"})
+	if err != nil {
+		return loop, err
+	}
+	loop.Body, err = p.parseDoGroup()
+	return loop, err
+}
+
+// parseFor parses for name [in words]; do ... done
+func (p *parser) parseFor() (Command, error) {
+	p.next()
+	clause := &ForClause{}
+
+	name, err := p.next()
+	if err != nil {
+		return clause, err
+	}
+	if name.kind != tokWord {
+		return clause, fmt.Errorf("line %d: syntax error: expected a name after 'for'", name.line)
+	}
+	clause.Name = name.text
+
+	if err := p.skipNewlines(); err != nil {
+		return clause, err
+	}
+	tok, err := p.peek()
+	if err != nil {
+		return clause, err
+	}
+	if isReserved(tok, "in") {
+		p.next()
+		for {
+			tok, err = p.peek()
+			if err != nil {
+				return clause, err
+			}
+			if tok.kind != tokWord {
+				break
+			}
+			p.next()
+			clause.Items = append(clause.Items, tok.word)
+		}
+	}
+	if isOperator(tok, ";") {
+		p.next()
+	}
+
+	clause.Body, err = p.parseDoGroup()
+	return clause, err
+}
+
+// parseDoGroup parses do ... done
+func (p *parser) parseDoGroup() (*Script, error) {
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	if err := p.expectReserved("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseList([]string{"done"})
+	if err != nil {
+		return body, err
+	}
+	return body, p.expectReserved("done")
+}
+
+// parseCase parses case word in pattern) list ;; ... esac
+func (p *parser) parseCase() (Command, error) {
+	p.next()
+	clause := &CaseClause{}
+
+	word, err := p.next()
+	if err != nil {
+		return clause, err
+	}
+	if word.kind != tokWord {
+		return clause, fmt.Errorf("line %d: syntax error: expected a word after 'case'", word.line)
+	}
+	clause.Word = word.word
+
+	if err := p.skipNewlines(); err != nil {
+		return clause, err
+	}
+	if err := p.expectReserved("in"); err != nil {
+		return clause, err
+	}
+
+	for {
+		if err := p.skipNewlines(); err != nil {
+			return clause, err
+		}
+		tok, err := p.next()
+		if err != nil {
+			return clause, err
+		}
+		if isReserved(tok, "esac") {
+			return clause, nil
+		}
+		if isOperator(tok, "(") {
+			if tok, err = p.next(); err != nil {
+				return clause, err
+			}
+		}
+
+		item := &CaseItem{}
+		for tok.kind == tokWord {
+			item.Patterns = append(item.Patterns, tok.word)
+			if tok, err = p.next(); err != nil {
+				return clause, err
+			}
+			if isOperator(tok, "|") {
+				if tok, err = p.next(); err != nil {
+					return clause, err
+				}
+			}
+		}
+		if !isOperator(tok, ")") {
+			return clause, fmt.Errorf("line %d: syntax error in case pattern near %q", tok.line, tok.text)
+		}
+
+		item.Body, err = p.parseList([]string{"esac"})
+		clause.Items = append(clause.Items, item)
+		if err != nil {
+			return clause, err
+		}
+
+		tok, err = p.peek()
+		if err != nil {
+			return clause, err
+		}
+		if isOperator(tok, ";;") {
+			p.next()
+		}
+	}
+}
+
+// expectOperator consumes the given control operator
+func (p *parser) expectOperator(op string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !isOperator(tok, op) {
+		return fmt.Errorf("line %d: syntax error: expected %q", tok.line, op)
+	}
+	return nil
+}
+
+// expectReserved consumes the given reserved word
+func (p *parser) expectReserved(word string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if !isReserved(tok, word) {
+		return fmt.Errorf("line %d: syntax error: expected %q", tok.line, word)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package shell
+
+import "testing"
+
+func TestParseIncompleteIf(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string // Names of the commands kept, in execution order
+	}{
+		{"if true", []string{"true"}},
+		{"if [ -f a ]; echo x", []string{"[", "echo"}},
+		{"if true; then echo x", []string{"true", "echo"}},
+		{"if true; then echo x; elif false", []string{"true", "echo", "false"}},
+		{"if true; then echo x; else echo y", []string{"true", "echo", "echo"}},
+	}
+
+	for _, tt := range tests {
+		script, err := Parse(tt.src)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want a syntax error", tt.src)
+		}
+		if script == nil {
+			t.Fatalf("Parse(%q) returned no script", tt.src)
+		}
+
+		var names []string
+		Walk(script, func(cmd *SimpleCommand) {
+			names = append(names, cmd.Name())
+		})
+		markFailurePaths(script, false)
+
+		if len(names) != len(tt.want) {
+			t.Errorf("Parse(%q) kept commands %q, want %q", tt.src, names, tt.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.want[i] {
+				t.Errorf("Parse(%q) kept commands %q, want %q", tt.src, names, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseIfPairsConditionsAndBodies(t *testing.T) {
+	script, err := Parse("if a; then b; elif c; then d; else e; fi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clause, ok := script.Lists[0].Pipelines[0].Commands[0].(*IfClause)
+	if !ok {
+		t.Fatalf("got %T, want *IfClause", script.Lists[0].Pipelines[0].Commands[0])
+	}
+	if len(clause.Conds) != 2 || len(clause.Thens) != 2 || clause.Else == nil {
+		t.Errorf("got %d conditions, %d bodies and else %v, want 2, 2 and an else", len(clause.Conds), len(clause.Thens), clause.Else != nil)
+	}
+}
@@ -0,0 +1,185 @@
+package shell
+
+// Walk calls fn for every simple command in the script in execution order,
+// including commands nested in compound commands and command substitutions
+func Walk(script *Script, fn func(cmd *SimpleCommand)) {
+	if script == nil {
+		return
+	}
+	for _, andOr := range script.Lists {
+		for _, pipeline := range andOr.Pipelines {
+			for _, command := range pipeline.Commands {
+				walkCommand(command, fn)
+			}
+		}
+	}
+}
+
+// Commands returns every simple command in the script in execution order
+func (s *Script) Commands() []*SimpleCommand {
+	var commands []*SimpleCommand
+	Walk(s, func(cmd *SimpleCommand) {
+		commands = append(commands, cmd)
+	})
+	return commands
+}
+
+// WalkPipelines calls fn for every pipeline in the script, including
+// pipelines nested in compound commands and command substitutions
+func WalkPipelines(script *Script, fn func(pipeline *Pipeline)) {
+	if script == nil {
+		return
+	}
+	for _, andOr := range script.Lists {
+		for _, pipeline := range andOr.Pipelines {
+			fn(pipeline)
+			for _, command := range pipeline.Commands {
+				for _, nested := range nestedScripts(command) {
+					WalkPipelines(nested, fn)
+				}
+			}
+		}
+	}
+}
+
+// nestedScripts returns the lists a command runs: the bodies of a compound
+// command and the command substitutions of its words and redirections
+func nestedScripts(command Command) []*Script {
+	var scripts []*Script
+	switch c := command.(type) {
+	case *SimpleCommand:
+		for _, assign := range c.Assigns {
+			scripts = append(scripts, assign.Value.Substs...)
+		}
+		for _, word := range c.Words {
+			scripts = append(scripts, word.Substs...)
+		}
+		for _, redirect := range c.Redirects {
+			if redirect.Target != nil {
+				scripts = append(scripts, redirect.Target.Substs...)
+			}
+		}
+	case *Subshell:
+		scripts = append(scripts, c.Body)
+	case *Group:
+		scripts = append(scripts, c.Body)
+	case *IfClause:
+		for i := range c.Conds {
+			scripts = append(scripts, c.Conds[i], c.Thens[i])
+		}
+		scripts = append(scripts, c.Else)
+	case *LoopClause:
+		scripts = append(scripts, c.Cond, c.Body)
+	case *ForClause:
+		for _, item := range c.Items {
+			scripts = append(scripts, item.Substs...)
+		}
+		scripts = append(scripts, c.Body)
+	case *CaseClause:
+		if c.Word != nil {
+			scripts = append(scripts, c.Word.Substs...)
+		}
+		for _, item := range c.Items {
+			scripts = append(scripts, item.Body)
+		}
+	case *FuncDecl:
+		scripts = append(scripts, nestedScripts(c.Body)...)
+	}
+	return scripts
+}
+
+func walkCommand(command Command, fn func(cmd *SimpleCommand)) {
+	switch c := command.(type) {
+	case *SimpleCommand:
+		for _, assign := range c.Assigns {
+			walkWord(assign.Value, fn)
+		}
+		for _, word := range c.Words {
+			walkWord(word, fn)
+		}
+		fn(c)
+	case *Subshell:
+		Walk(c.Body, fn)
+	case *Group:
+		Walk(c.Body, fn)
+	case *IfClause:
+		for i := range c.Conds {
+			Walk(c.Conds[i], fn)
+			Walk(c.Thens[i], fn)
+		}
+		Walk(c.Else, fn)
+	case *LoopClause:
+		Walk(c.Cond, fn)
+		Walk(c.Body, fn)
+	case *ForClause:
+		for _, item := range c.Items {
+			walkWord(item, fn)
+		}
+		Walk(c.Body, fn)
+	case *CaseClause:
+		walkWord(c.Word, fn)
+		for _, item := range c.Items {
+			Walk(item.Body, fn)
+		}
+	case *FuncDecl:
+		walkCommand(c.Body, fn)
+	}
+}
+
+func walkWord(word *Word, fn func(cmd *SimpleCommand)) {
+	if word == nil {
+		return
+	}
+	for _, subst := range word.Substs {
+		Walk(subst, fn)
+	}
+}
+
+// markFailurePaths flags the commands that only run after a failure, i.e. the
+// pipelines that follow a || operator, and everything nested inside them
+func markFailurePaths(script *Script, onFailure bool) {
+	if script == nil {
+		return
+	}
+	for _, andOr := range script.Lists {
+		for i, pipeline := range andOr.Pipelines {
+			failure := onFailure || (i > 0 && andOr.Ops[i-1] == "||")
+			for _, command := range pipeline.Commands {
+				markCommand(command, failure)
+			}
+		}
+	}
+}
+
+func markCommand(command Command, onFailure bool) {
+	switch c := command.(type) {
+	case *SimpleCommand:
+		c.OnFailure = onFailure
+		for _, word := range c.Words {
+			for _, subst := range word.Substs {
+				markFailurePaths(subst, onFailure)
+			}
+		}
+	case *Subshell:
+		markFailurePaths(c.Body, onFailure)
+	case *Group:
+		markFailurePaths(c.Body, onFailure)
+	case *IfClause:
+		for i := range c.Conds {
+			markFailurePaths(c.Conds[i], onFailure)
+			markFailurePaths(c.Thens[i], onFailure)
+		}
+		markFailurePaths(c.Else, onFailure)
+	case *LoopClause:
+		markFailurePaths(c.Cond, onFailure)
+		markFailurePaths(c.Body, onFailure)
+	case *ForClause:
+		markFailurePaths(c.Body, onFailure)
+	case *CaseClause:
+		for _, item := range c.Items {
+			markFailurePaths(item.Body, onFailure)
+		}
+	case *FuncDecl:
+		markCommand(c.Body, onFailure)
+	}
+}
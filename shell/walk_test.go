@@ -0,0 +1,42 @@
+package shell
+
+import "testing"
+
+func TestWalkPipelinesIncompleteIf(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int // Pipelines visited
+	}{
+		{"if true", 2},
+		{"if [ -f a ]; echo x", 3},
+		{"if curl -fsSL https://example.com | sh; then echo x", 3},
+		{"if true; then echo $(curl https://example.com)", 4},
+	}
+
+	for _, tt := range tests {
+		script, _ := Parse(tt.src)
+		count := 0
+		WalkPipelines(script, func(*Pipeline) {
+			count++
+		})
+		if count != tt.want {
+			t.Errorf("WalkPipelines(%q) visited %d pipelines, want %d", tt.src, count, tt.want)
+		}
+	}
+}
+
+func TestWalkPipelinesProcessSubstitution(t *testing.T) {
+	script, err := Parse("bash <(curl -fsSL https://example.com/install.sh)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	WalkPipelines(script, func(pipeline *Pipeline) {
+		if cmd, ok := pipeline.Commands[0].(*SimpleCommand); ok {
+			names = append(names, cmd.Name())
+		}
+	})
+	if len(names) != 2 || names[0] != "bash" || names[1] != "curl" {
+		t.Errorf("got pipelines %q, want bash and curl", names)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
-	"strings"
 )
 
 // ExecuteCommand runs a shell command and returns its output
@@ -30,54 +29,17 @@ func CommandExists(command string) bool {
 	return err == nil
 }
 
-// ParseDockerImageSize parses the size from docker image ls output
-func ParseDockerImageSize(output string) map[string]string {
-	sizes := make(map[string]string)
-	
-	lines := strings.Split(output, "\n")
-	if len(lines) <= 1 {
-		return sizes
-	}
-	
-	// Skip header line
-	for i := 1; i < len(lines); i++ {
-		fields := strings.Fields(lines[i])
-		if len(fields) >= 3 {
-			// Image name and size
-			imageName := fields[0]
-			size := fields[2]
-			
-			// If image has a tag
-			if strings.Contains(imageName, ":") {
-				sizes[imageName] = size
-			}
-		}
-	}
-	
-	return sizes
-}
-
-// ExtractSizeInMB converts a Docker size string to MB
-func ExtractSizeInMB(sizeStr string) float64 {
-	// Docker sizes are like "156MB", "1.2GB", etc.
-	var value float64
-	var unit string
-	
-	_, err := fmt.Sscanf(sizeStr, "%f%s", &value, &unit)
-	if err != nil {
-		return 0
-	}
-	
-	switch strings.ToUpper(unit) {
-	case "B":
-		return value / 1000000
-	case "KB":
-		return value / 1000
-	case "MB":
-		return value
-	case "GB":
-		return value * 1000
+// FormatSize formats a byte count in the decimal units Docker prints, such as
+// "156MB" or "1.2GB"
+func FormatSize(bytes int64) string {
+	switch {
+	case bytes >= 1000000000:
+		return fmt.Sprintf("%.1fGB", float64(bytes)/1000000000)
+	case bytes >= 1000000:
+		return fmt.Sprintf("%.1fMB", float64(bytes)/1000000)
+	case bytes >= 1000:
+		return fmt.Sprintf("%.1fkB", float64(bytes)/1000)
 	default:
-		return 0
+		return fmt.Sprintf("%dB", bytes)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,138 @@
+package vuln
+
+import (
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/catalog"
+	"github.com/avirooppal/dock-slimscheck/parser"
+	"github.com/avirooppal/dock-slimscheck/shell"
+)
+
+// pinInstallers are the package managers whose installs pin versions as
+// name=version, with their format, install subcommands and the options that
+// take a separate value
+var pinInstallers = map[string]struct {
+	format       string
+	install      []string
+	valueOptions []string
+}{
+	"apt-get":  {FormatDpkg, []string{"install"}, []string{"-o", "-c", "-t"}},
+	"apt":      {FormatDpkg, []string{"install"}, []string{"-o", "-c", "-t"}},
+	"aptitude": {FormatDpkg, []string{"install"}, []string{"-o", "-t"}},
+	"apk":      {FormatApk, []string{"add"}, []string{"-X", "--repository", "-p", "--root", "-t", "--virtual"}},
+}
+
+// lifecycleDistros maps lifecycle products to OSV ecosystems
+var lifecycleDistros = map[string]string{
+	"debian": "Debian",
+	"ubuntu": "Ubuntu",
+	"alpine": "Alpine",
+}
+
+// DockerfileInventory returns the packages that the RUN instructions of the
+// final stage and the stages it is built from install at a pinned version,
+// as in apt-get install curl=7.88.1-10+deb12u5 or apk add curl=8.5.0-r0.
+// The distro is taken from the base image when it names one.
+func DockerfileInventory(dockerfile *parser.Dockerfile) []Package {
+	final := dockerfile.FinalStage()
+	if final == nil {
+		return nil
+	}
+	distro, release := baseImageDistro(final.Root().BaseImage)
+
+	// A later pin of the same package replaces the version of an earlier one
+	var packages []Package
+	index := map[string]int{}
+	lineage := final.Lineage()
+	for i := len(lineage) - 1; i >= 0; i-- {
+		stage := lineage[i]
+		for j := range stage.Instructions {
+			inst := &stage.Instructions[j]
+			if inst.Command != "RUN" || inst.Shell == nil {
+				continue
+			}
+			for _, pkg := range pinnedPackages(inst.Shell) {
+				pkg.Distro, pkg.Release, pkg.Instruction = distro, release, inst
+				key := pkg.Format + "/" + pkg.Name
+				if k, ok := index[key]; ok {
+					packages[k] = pkg
+					continue
+				}
+				index[key] = len(packages)
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	return packages
+}
+
+// pinnedPackages returns the name=version arguments of the package installs
+// in a script, including scripts run with sh -c
+func pinnedPackages(script *shell.Script) []Package {
+	var packages []Package
+	for _, cmd := range script.Commands() {
+		if inline := cmd.InlineScript(); inline != nil {
+			packages = append(packages, pinnedPackages(inline)...)
+			continue
+		}
+		installer, ok := pinInstallers[cmd.EffectiveName()]
+		if !ok {
+			continue
+		}
+
+		// The first operand is the subcommand, the others are packages
+		var operands []string
+		args := cmd.Effective()[1:]
+		for k := 0; k < len(args); k++ {
+			switch {
+			case contains(installer.valueOptions, args[k]):
+				k++
+			case !strings.HasPrefix(args[k], "-"):
+				operands = append(operands, args[k])
+			}
+		}
+		if len(operands) == 0 || !contains(installer.install, operands[0]) {
+			continue
+		}
+		for _, arg := range operands[1:] {
+			name, version, ok := strings.Cut(arg, "=")
+			if !ok || name == "" || version == "" || strings.ContainsAny(arg, "$*?") {
+				continue
+			}
+			// apt accepts name:arch=version
+			name, _, _ = strings.Cut(name, ":")
+			packages = append(packages, Package{Name: name, Version: version, Format: installer.format})
+		}
+	}
+	return packages
+}
+
+// baseImageDistro returns the OSV ecosystem and release of the distro an
+// official base image is built on, such as Debian and 12 for
+// python:3.12-slim-bookworm, or empty strings when it is not known
+func baseImageDistro(image string) (string, string) {
+	for _, support := range catalog.DefaultLifecycle().Lookup(image) {
+		if distro, ok := lifecycleDistros[support.Product.Name]; ok {
+			return distro, support.Cycle.Cycle
+		}
+	}
+	if match, ok := catalog.Default().Lookup(image); ok {
+		// Variant distros read like "Debian 12" or "Alpine"
+		name, release, _ := strings.Cut(match.Variant.Distro, " ")
+		for _, distro := range lifecycleDistros {
+			if name == distro {
+				return distro, release
+			}
+		}
+	}
+	return "", ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package vuln
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+)
+
+// Paths of the package databases inside an image, without the leading slash
+const (
+	dpkgStatus    = "var/lib/dpkg/status"
+	dpkgStatusDir = "var/lib/dpkg/status.d/" // One file per package, as in distroless images
+	apkInstalled  = "lib/apk/db/installed"
+)
+
+// maxDatabaseSize limits the bytes read from one package database
+const maxDatabaseSize = 256 << 20
+
+var (
+	rpmDatabases   = []string{"var/lib/rpm/rpmdb.sqlite", "usr/lib/sysimage/rpm/rpmdb.sqlite"}
+	rpmBerkeleyDBs = []string{"var/lib/rpm/Packages", "usr/lib/sysimage/rpm/Packages.db"}
+	osReleasePaths = []string{"etc/os-release", "usr/lib/os-release"}
+	inventoryPaths = append(append(append([]string{dpkgStatus, apkInstalled}, rpmDatabases...), rpmBerkeleyDBs...), osReleasePaths...)
+	errBerkeleyRPM = fmt.Errorf("the rpm database of the image uses the Berkeley DB or NDB format, which is not supported; only rpmdb.sqlite, used since RHEL 9 and Fedora 36, is read")
+)
+
+// ImageInventory reads the dpkg, apk and rpm databases of an image and
+// returns its installed packages. Each package carries the layer that
+// installed its current version, found by replaying the databases layer by
+// layer.
+func ImageInventory(img *archive.Image) ([]Package, error) {
+	files := map[string][]byte{}
+	installed := map[string]Package{}
+
+	for _, layer := range img.Layers {
+		changed := false
+		err := layer.Walk(func(hdr *tar.Header, r *tar.Reader) error {
+			name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+			dir, base := path.Split(name)
+
+			if strings.HasPrefix(base, ".wh.") {
+				target := dir + strings.TrimPrefix(base, ".wh.")
+				for file := range files {
+					if file == target || strings.HasPrefix(file, target+"/") || base == ".wh..wh..opq" && strings.HasPrefix(file, dir) {
+						delete(files, file)
+						changed = true
+					}
+				}
+				return nil
+			}
+			if !isInventoryPath(name) || hdr.Typeflag != tar.TypeReg {
+				return nil
+			}
+			data, err := io.ReadAll(io.LimitReader(r, maxDatabaseSize))
+			if err != nil {
+				return fmt.Errorf("could not read /%s in layer %d: %v", name, layer.Index, err)
+			}
+			files[name] = data
+			changed = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+
+		packages, err := readDatabases(files)
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]Package{}
+		for _, pkg := range packages {
+			key := pkg.Format + "/" + pkg.Name
+			if previous, ok := installed[key]; ok && previous.Version == pkg.Version {
+				pkg.Layer, pkg.Instruction = previous.Layer, previous.Instruction
+			} else {
+				pkg.Layer, pkg.Instruction = layer, layer.Instruction()
+			}
+			current[key] = pkg
+		}
+		installed = current
+	}
+
+	packages := make([]Package, 0, len(installed))
+	for _, pkg := range installed {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages, nil
+}
+
+// isInventoryPath reports whether a file of a layer is read for the inventory
+func isInventoryPath(name string) bool {
+	if strings.HasPrefix(name, dpkgStatusDir) {
+		return !strings.Contains(strings.TrimPrefix(name, dpkgStatusDir), ".")
+	}
+	for _, p := range inventoryPaths {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// readDatabases parses the package databases visible after a layer
+func readDatabases(files map[string][]byte) ([]Package, error) {
+	release := osRelease{}
+	for _, p := range osReleasePaths {
+		if data, ok := files[p]; ok {
+			release = parseOSRelease(data)
+			break
+		}
+	}
+
+	var packages []Package
+	if data, ok := files[dpkgStatus]; ok {
+		packages = append(packages, parseDpkgStatus(data)...)
+	}
+	var statusFiles []string
+	for name := range files {
+		if strings.HasPrefix(name, dpkgStatusDir) {
+			statusFiles = append(statusFiles, name)
+		}
+	}
+	sort.Strings(statusFiles)
+	for _, name := range statusFiles {
+		packages = append(packages, parseDpkgStatus(files[name])...)
+	}
+	if data, ok := files[apkInstalled]; ok {
+		packages = append(packages, parseApkInstalled(data)...)
+	}
+
+	foundRPM := false
+	for _, p := range rpmDatabases {
+		if data, ok := files[p]; ok {
+			rpms, err := parseRPMDatabase(data)
+			if err != nil {
+				return nil, fmt.Errorf("could not read /%s: %v", p, err)
+			}
+			packages = append(packages, rpms...)
+			foundRPM = true
+			break
+		}
+	}
+	for _, p := range rpmBerkeleyDBs {
+		if _, ok := files[p]; ok && !foundRPM {
+			return nil, errBerkeleyRPM
+		}
+	}
+
+	for i := range packages {
+		packages[i].Distro, packages[i].Release = release.distro, release.release
+	}
+	return packages, nil
+}
+
+// parseDpkgStatus reads the installed packages of a dpkg status file
+func parseDpkgStatus(data []byte) []Package {
+	var packages []Package
+	for _, stanza := range stanzas(data) {
+		if !strings.HasSuffix(stanza["Status"], " installed") || stanza["Package"] == "" {
+			continue
+		}
+		pkg := Package{Name: stanza["Package"], Version: stanza["Version"], Format: FormatDpkg}
+		if source := stanza["Source"]; source != "" {
+			// Source: name (version) when the versions differ
+			name, version, _ := strings.Cut(source, " ")
+			pkg.Source = name
+			pkg.SourceVersion = strings.Trim(version, "()")
+		}
+		packages = append(packages, pkg)
+	}
+	return packages
+}
+
+// stanzas splits a Debian control file into its paragraphs of fields
+func stanzas(data []byte) []map[string]string {
+	var result []map[string]string
+	current := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(current) > 0 {
+				result = append(result, current)
+				current = map[string]string{}
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			// Continuation of a multi-line field such as Description
+		default:
+			if key, value, ok := strings.Cut(line, ":"); ok {
+				current[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if len(current) > 0 {
+		result = append(result, current)
+	}
+	return result
+}
+
+// parseApkInstalled reads the apk database, whose entries are single letter
+// fields such as P:name and V:version separated by blank lines
+func parseApkInstalled(data []byte) []Package {
+	var packages []Package
+	var pkg Package
+	flush := func() {
+		if pkg.Name != "" && pkg.Version != "" {
+			pkg.Format = FormatApk
+			if pkg.Source == pkg.Name {
+				pkg.Source = ""
+			}
+			packages = append(packages, pkg)
+		}
+		pkg = Package{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			pkg.Name = line[2:]
+		case 'V':
+			pkg.Version = line[2:]
+		case 'o':
+			pkg.Source = line[2:]
+		}
+	}
+	flush()
+	return packages
+}
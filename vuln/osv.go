@@ -0,0 +1,368 @@
+package vuln
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Advisory is a vulnerability in the OSV format, as published by
+// https://osv.dev and the Debian, Ubuntu, Alpine and Red Hat security trackers
+type Advisory struct {
+	ID        string      `json:"id"`
+	Aliases   []string    `json:"aliases"`
+	Upstream  []string    `json:"upstream"`
+	Related   []string    `json:"related"`
+	Summary   string      `json:"summary"`
+	Details   string      `json:"details"`
+	Withdrawn string      `json:"withdrawn"`
+	Severity  []Score     `json:"severity"`
+	Affected  []Affected  `json:"affected"`
+	Refs      []Reference `json:"references"`
+
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Score is a severity score such as a CVSS vector
+type Score struct {
+	Type  string `json:"type"` // CVSS_V3, CVSS_V4 or Ubuntu
+	Score string `json:"score"`
+}
+
+// Affected is a package an advisory applies to, with its affected versions
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"` // Such as Debian:12 or Alpine:v3.19
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges   []Range  `json:"ranges"`
+	Versions []string `json:"versions"`
+	Severity []Score  `json:"severity"` // Overrides the advisory's severity for this package
+
+	EcosystemSpecific struct {
+		Urgency string `json:"urgency"` // Debian
+	} `json:"ecosystem_specific"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Range is a list of events between which versions are affected
+type Range struct {
+	Type   string  `json:"type"` // Only ECOSYSTEM ranges apply to OS packages
+	Events []Event `json:"events"`
+}
+
+// Event starts or ends an affected range
+type Event struct {
+	Introduced   string `json:"introduced"`
+	Fixed        string `json:"fixed"`
+	LastAffected string `json:"last_affected"`
+}
+
+// Reference is a link from an advisory
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Finding is an advisory that affects an installed package
+type Finding struct {
+	Advisory *Advisory
+	Package  string // Name the advisory uses: the binary or the source package
+	Fixed    string // First fixed version, empty when there is no fix yet
+	Severity string // critical, high, medium or low; empty when unknown
+}
+
+// Database is a set of advisories indexed by distro and package name
+type Database struct {
+	advisories map[string][]*Advisory
+	count      int
+}
+
+// formatDistros are the OSV ecosystems a package of unknown distro is
+// matched against
+var formatDistros = map[string][]string{
+	FormatDpkg: {"Debian", "Ubuntu"},
+	FormatApk:  {"Alpine"},
+	FormatRPM:  {"Red Hat", "AlmaLinux", "Rocky Linux"},
+}
+
+// Load reads the advisories of a directory: OSV .json files and the .zip
+// archives of the osv.dev bulk exports, such as Debian/all.zip. Withdrawn
+// advisories are skipped.
+func Load(dir string) (*Database, error) {
+	db := &Database{advisories: map[string][]*Advisory{}}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := db.add(data); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		case ".zip":
+			if err := db.addZip(path); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading advisories: %v", err)
+	}
+	return db, nil
+}
+
+// addZip reads the .json advisories of a zip archive
+func (db *Database) addZip(path string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(file.Name), ".json") {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if err := db.add(data); err != nil {
+			return fmt.Errorf("%s: %v", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// add indexes an advisory under every package it affects
+func (db *Database) add(data []byte) error {
+	advisory := &Advisory{}
+	if err := json.Unmarshal(data, advisory); err != nil {
+		return fmt.Errorf("invalid OSV advisory: %v", err)
+	}
+	if advisory.ID == "" || advisory.Withdrawn != "" {
+		return nil
+	}
+
+	indexed := map[string]bool{}
+	for _, affected := range advisory.Affected {
+		base, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+		key := indexKey(base, affected.Package.Name)
+		if !indexed[key] {
+			db.advisories[key] = append(db.advisories[key], advisory)
+			indexed[key] = true
+		}
+	}
+	db.count++
+	return nil
+}
+
+// Len returns the number of advisories loaded
+func (db *Database) Len() int {
+	return db.count
+}
+
+// Match returns the advisories affecting a package, under its own name or
+// the name of its source package, sorted by ID
+func (db *Database) Match(pkg Package) []Finding {
+	distros := []string{pkg.Distro}
+	if pkg.Distro == "" {
+		distros = formatDistros[pkg.Format]
+	}
+	candidates := []struct{ name, version string }{{pkg.Name, pkg.Version}}
+	if pkg.Source != "" {
+		version := pkg.SourceVersion
+		if version == "" {
+			version = pkg.Version
+		}
+		candidates = append(candidates, struct{ name, version string }{pkg.Source, version})
+	}
+
+	var findings []Finding
+	seen := map[string]bool{}
+	for _, distro := range distros {
+		for _, candidate := range candidates {
+			for _, advisory := range db.advisories[indexKey(distro, candidate.name)] {
+				if seen[advisory.ID] {
+					continue
+				}
+				for _, affected := range advisory.Affected {
+					if affected.Package.Name != candidate.name || !ecosystemMatches(affected.Package.Ecosystem, distro, pkg.Release) {
+						continue
+					}
+					fixed, ok := affected.affects(pkg.Format, candidate.version)
+					if !ok {
+						continue
+					}
+					findings = append(findings, Finding{
+						Advisory: advisory,
+						Package:  candidate.name,
+						Fixed:    fixed,
+						Severity: advisory.severity(affected),
+					})
+					seen[advisory.ID] = true
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Advisory.ID < findings[j].Advisory.ID })
+	return findings
+}
+
+// affects reports whether a version is affected, and the version that fixes
+// it when one is known
+func (a Affected) affects(format, version string) (string, bool) {
+	for _, v := range a.Versions {
+		if v == version {
+			return "", true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.Type != "ECOSYSTEM" {
+			continue
+		}
+		affected := false
+		fixed := ""
+		for _, event := range r.Events {
+			switch {
+			case event.Introduced != "":
+				if event.Introduced == "0" || CompareVersions(format, version, event.Introduced) >= 0 {
+					affected = true
+				}
+			case event.Fixed != "":
+				if CompareVersions(format, version, event.Fixed) >= 0 {
+					affected = false
+				} else if affected && fixed == "" {
+					fixed = event.Fixed
+				}
+			case event.LastAffected != "":
+				if CompareVersions(format, version, event.LastAffected) > 0 {
+					affected = false
+				}
+			}
+		}
+		if affected {
+			return fixed, true
+		}
+	}
+	return "", false
+}
+
+// ecosystemMatches reports whether an advisory's ecosystem, such as
+// Debian:12 or Ubuntu:22.04:LTS, covers a distro release. An unknown release
+// matches every release; Ubuntu Pro advisories need a subscription to fix
+// and are left out.
+func ecosystemMatches(ecosystem, distro, release string) bool {
+	parts := strings.Split(ecosystem, ":")
+	if !strings.EqualFold(parts[0], distro) {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if part == "Pro" {
+			return false
+		}
+	}
+	if release == "" || len(parts) == 1 {
+		return true
+	}
+	for _, part := range parts[1:] {
+		if strings.TrimPrefix(part, "v") == release {
+			return true
+		}
+	}
+	return false
+}
+
+// severity rates an advisory from its CVSS v3 vector, the Ubuntu priority,
+// or the severity or urgency the distro gave
+func (a *Advisory) severity(affected Affected) string {
+	for _, score := range append(append([]Score(nil), affected.Severity...), a.Severity...) {
+		switch score.Type {
+		case "CVSS_V3":
+			if base, ok := cvss3BaseScore(score.Score); ok {
+				return cvssRating(base)
+			}
+		case "Ubuntu":
+			if rating := ratingOf(score.Score); rating != "" {
+				return rating
+			}
+		}
+	}
+	for _, word := range []string{affected.DatabaseSpecific.Severity, a.DatabaseSpecific.Severity, affected.EcosystemSpecific.Urgency} {
+		if rating := ratingOf(word); rating != "" {
+			return rating
+		}
+	}
+	return ""
+}
+
+// ratingOf normalizes the severity words distros use
+func ratingOf(word string) string {
+	word = strings.ToLower(strings.TrimSpace(word))
+	word = strings.TrimSuffix(word, "*") // Debian marks guessed urgencies with *
+	switch word {
+	case "critical":
+		return "critical"
+	case "high", "important":
+		return "high"
+	case "medium", "moderate":
+		return "medium"
+	case "low", "negligible", "unimportant":
+		return "low"
+	}
+	return ""
+}
+
+// CVEs returns the CVE IDs of an advisory: its own ID, aliases and upstream
+// advisories
+func (a *Advisory) CVEs() []string {
+	var cves []string
+	seen := map[string]bool{}
+	for _, id := range append(append([]string{a.ID}, a.Aliases...), a.Upstream...) {
+		// Distro trackers prefix CVE IDs, as in DEBIAN-CVE-2024-1234
+		if i := strings.Index(id, "CVE-"); i >= 0 {
+			id = id[i:]
+		} else {
+			continue
+		}
+		if !seen[id] {
+			cves = append(cves, id)
+			seen[id] = true
+		}
+	}
+	return cves
+}
+
+// URL links to the advisory on osv.dev
+func (a *Advisory) URL() string {
+	return "https://osv.dev/vulnerability/" + a.ID
+}
+
+func indexKey(distro, name string) string {
+	return strings.ToLower(distro) + "/" + name
+}
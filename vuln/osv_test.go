@@ -0,0 +1,125 @@
+package vuln
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffects(t *testing.T) {
+	introduced := func(v string) Event { return Event{Introduced: v} }
+	fixed := func(v string) Event { return Event{Fixed: v} }
+	lastAffected := func(v string) Event { return Event{LastAffected: v} }
+
+	tests := []struct {
+		name     string
+		format   string
+		versions []string
+		events   []Event
+		version  string
+		affected bool
+		fixed    string
+	}{
+		{"before the fix", FormatDpkg, nil, []Event{introduced("0"), fixed("1.2-1")}, "1.1-3", true, "1.2-1"},
+		{"at the fix", FormatDpkg, nil, []Event{introduced("0"), fixed("1.2-1")}, "1.2-1", false, ""},
+		{"after the fix", FormatDpkg, nil, []Event{introduced("0"), fixed("1.2-1")}, "1.2-1+deb12u1", false, ""},
+		{"before introduced", FormatDpkg, nil, []Event{introduced("1.0"), fixed("1.2")}, "0.9", false, ""},
+		{"backported fix", FormatDpkg, nil, []Event{introduced("0"), fixed("1.2-1~deb12u1")}, "1.2-1~deb11u1", true, "1.2-1~deb12u1"},
+		{"epoch above the fix", FormatDpkg, nil, []Event{introduced("0"), fixed("2.0")}, "1:1.0", false, ""},
+		{"no fix yet", FormatApk, nil, []Event{introduced("0")}, "3.1.4-r5", true, ""},
+		{"first of two ranges", FormatApk, nil, []Event{introduced("1.0"), fixed("1.2"), introduced("2.0"), fixed("2.3")}, "1.1", true, "1.2"},
+		{"between two ranges", FormatApk, nil, []Event{introduced("1.0"), fixed("1.2"), introduced("2.0"), fixed("2.3")}, "1.9", false, ""},
+		{"second of two ranges", FormatApk, nil, []Event{introduced("1.0"), fixed("1.2"), introduced("2.0"), fixed("2.3")}, "2.1", true, "2.3"},
+		{"after two ranges", FormatApk, nil, []Event{introduced("1.0"), fixed("1.2"), introduced("2.0"), fixed("2.3")}, "2.3-r1", false, ""},
+		{"release candidate before the fix", FormatApk, nil, []Event{introduced("0"), fixed("1.2.3-r0")}, "1.2.3_rc1-r0", true, "1.2.3-r0"},
+		{"at last_affected", FormatRPM, nil, []Event{introduced("0"), lastAffected("1.5-2.el9")}, "1.5-2.el9", true, ""},
+		{"after last_affected", FormatRPM, nil, []Event{introduced("0"), lastAffected("1.5-2.el9")}, "1.5-2.el9_1", false, ""},
+		{"listed version", FormatDpkg, []string{"1.0-1", "1.0-2"}, nil, "1.0-2", true, ""},
+		{"unlisted version", FormatDpkg, []string{"1.0-1", "1.0-2"}, nil, "1.0-3", false, ""},
+	}
+	for _, tt := range tests {
+		a := Affected{Versions: tt.versions}
+		if tt.events != nil {
+			a.Ranges = []Range{{Type: "ECOSYSTEM", Events: tt.events}}
+		}
+		fixed, affected := a.affects(tt.format, tt.version)
+		if affected != tt.affected || fixed != tt.fixed {
+			t.Errorf("%s: affects(%q) = %q, %v, want %q, %v", tt.name, tt.version, fixed, affected, tt.fixed, tt.affected)
+		}
+	}
+
+	// Commit ranges do not apply to OS packages
+	a := Affected{Ranges: []Range{{Type: "GIT", Events: []Event{introduced("0")}}}}
+	if _, affected := a.affects(FormatDpkg, "1.0"); affected {
+		t.Error("a GIT range affects a dpkg version, want only ECOSYSTEM ranges to apply")
+	}
+}
+
+func TestEcosystemMatches(t *testing.T) {
+	tests := []struct {
+		ecosystem, distro, release string
+		want                       bool
+	}{
+		{"Debian:12", "Debian", "12", true},
+		{"Debian:11", "Debian", "12", false},
+		{"Debian", "Debian", "12", true},
+		{"Debian:12", "Debian", "", true},
+		{"debian:12", "Debian", "12", true},
+		{"Alpine:v3.19", "Alpine", "3.19", true},
+		{"Alpine:v3.19", "Alpine", "3.20", false},
+		{"Alpine:v3.19", "Debian", "3.19", false},
+		{"Ubuntu:22.04:LTS", "Ubuntu", "22.04", true},
+		{"Ubuntu:Pro:22.04:LTS", "Ubuntu", "22.04", false},
+		{"Ubuntu:Pro:22.04:LTS", "Ubuntu", "", false},
+		{"Red Hat:9", "Red Hat", "9", true},
+	}
+	for _, tt := range tests {
+		if got := ecosystemMatches(tt.ecosystem, tt.distro, tt.release); got != tt.want {
+			t.Errorf("ecosystemMatches(%q, %q, %q) = %v, want %v", tt.ecosystem, tt.distro, tt.release, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	db := &Database{advisories: map[string][]*Advisory{}}
+	for _, advisory := range []string{
+		`{"id": "DSA-1", "affected": [{"package": {"ecosystem": "Debian:12", "name": "openssl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.0.11-1~deb12u2"}]}]}]}`,
+		`{"id": "DSA-2", "affected": [{"package": {"ecosystem": "Debian:11", "name": "openssl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.1.1w-0+deb11u1"}]}]}]}`,
+		`{"id": "DSA-3", "withdrawn": "2024-01-01T00:00:00Z", "affected": [{"package": {"ecosystem": "Debian:12", "name": "openssl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}]}]}]}`,
+		`{"id": "ALPINE-1", "affected": [{"package": {"ecosystem": "Alpine:v3.19", "name": "openssl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.1.4-r5"}]}]}]}`,
+	} {
+		if err := db.add([]byte(advisory)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		pkg  Package
+		want []string // Advisory IDs and the fixed versions they name
+	}{
+		{"binary package of the source",
+			Package{Name: "libssl3", Version: "3.0.11-1~deb12u1", Source: "openssl", Format: FormatDpkg, Distro: "Debian", Release: "12"},
+			[]string{"DSA-1", "3.0.11-1~deb12u2"}},
+		{"fixed", Package{Name: "openssl", Version: "3.0.11-1~deb12u2", Format: FormatDpkg, Distro: "Debian", Release: "12"}, nil},
+		{"other release", Package{Name: "openssl", Version: "3.0.11-1~deb12u1", Format: FormatDpkg, Distro: "Debian", Release: "13"}, nil},
+		{"unknown release",
+			Package{Name: "openssl", Version: "1.1.1n-0+deb11u5", Format: FormatDpkg, Distro: "Debian"},
+			[]string{"DSA-1", "3.0.11-1~deb12u2", "DSA-2", "1.1.1w-0+deb11u1"}},
+		{"unknown distro",
+			Package{Name: "openssl", Version: "3.1.4-r4", Format: FormatApk},
+			[]string{"ALPINE-1", "3.1.4-r5"}},
+		{"other distro", Package{Name: "openssl", Version: "3.1.4-r4", Format: FormatApk, Distro: "Wolfi"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, finding := range db.Match(tt.pkg) {
+			got = append(got, finding.Advisory.ID, finding.Fixed)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Match = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if db.Len() != 3 {
+		t.Errorf("Len() = %d, want 3 without the withdrawn advisory", db.Len())
+	}
+}
@@ -0,0 +1,99 @@
+package vuln
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/avirooppal/dock-slimscheck/archive"
+	"github.com/avirooppal/dock-slimscheck/parser"
+)
+
+// Package is an installed or pinned OS package
+type Package struct {
+	Name          string
+	Version       string
+	Source        string // Source package, which Debian and Alpine advisories name; empty when it is Name
+	SourceVersion string // Version of the source package, when it differs from Version
+	Format        string // FormatDpkg, FormatApk or FormatRPM
+
+	// Distro is the OSV ecosystem of the distro, such as Debian or Alpine,
+	// and Release its version, such as 12 or 3.19. Both are empty when
+	// unknown; an unknown release matches advisories for every release.
+	Distro  string
+	Release string
+
+	Layer       *archive.Layer      // Layer that installed this version, nil for Dockerfile pins
+	Instruction *parser.Instruction // Instruction that installed or pinned it, when known
+}
+
+// Ecosystem returns the OSV ecosystem of the package, such as Debian:12, or
+// "" when the distro is not known
+func (p Package) Ecosystem() string {
+	switch {
+	case p.Distro == "":
+		return ""
+	case p.Release == "":
+		return p.Distro
+	case p.Distro == "Alpine":
+		return p.Distro + ":v" + p.Release
+	}
+	return p.Distro + ":" + p.Release
+}
+
+// osRelease is the distro an /etc/os-release file describes
+type osRelease struct {
+	distro  string
+	release string
+}
+
+// osDistros maps os-release IDs to OSV ecosystem names, and whether
+// advisories name releases by major version only
+var osDistros = map[string]struct {
+	ecosystem string
+	major     bool
+}{
+	"debian":        {"Debian", false},
+	"ubuntu":        {"Ubuntu", false},
+	"alpine":        {"Alpine", false},
+	"rocky":         {"Rocky Linux", true},
+	"almalinux":     {"AlmaLinux", true},
+	"rhel":          {"Red Hat", true},
+	"opensuse-leap": {"openSUSE", false},
+	"sles":          {"SUSE", false},
+	"wolfi":         {"Wolfi", false},
+	"chainguard":    {"Chainguard", false},
+	"photon":        {"Photon OS", true},
+	"mageia":        {"Mageia", true},
+}
+
+// parseOSRelease reads the distro and release from an os-release file
+func parseOSRelease(data []byte) osRelease {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok {
+			fields[key] = strings.Trim(value, `"'`)
+		}
+	}
+
+	distro, ok := osDistros[fields["ID"]]
+	if !ok {
+		return osRelease{}
+	}
+	release := fields["VERSION_ID"]
+	switch {
+	case distro.major:
+		release, _, _ = strings.Cut(release, ".")
+	case distro.ecosystem == "Alpine":
+		// Alpine advisories name branches such as v3.19
+		parts := strings.SplitN(release, ".", 3)
+		if len(parts) >= 2 {
+			release = parts[0] + "." + parts[1]
+		}
+	case distro.ecosystem == "Wolfi" || distro.ecosystem == "Chainguard":
+		// Rolling distros have no releases
+		release = ""
+	}
+	return osRelease{distro: distro.ecosystem, release: release}
+}
@@ -0,0 +1,359 @@
+package vuln
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The rpm database of RHEL 9, Fedora 36 and later is a SQLite file holding
+// one header blob per package in its Packages table. This file reads just
+// enough of the SQLite format to walk that table; older Berkeley DB and NDB
+// databases are not supported.
+
+// RPM header tags read for the inventory
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagSourceRPM = 1044
+)
+
+// RPM header data types
+const (
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+// sqliteFile is an SQLite database read from memory
+type sqliteFile struct {
+	data     []byte
+	pageSize int
+	usable   int // Page size without the reserved bytes at the end of each page
+}
+
+// parseRPMDatabase reads the packages of an rpmdb.sqlite file
+func parseRPMDatabase(data []byte) ([]Package, error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := 0
+	err = db.walkTable(1, func(record []interface{}) error {
+		// sqlite_master: type, name, tbl_name, rootpage, sql
+		if len(record) >= 4 && record[0] == "table" && record[1] == "Packages" {
+			if page, ok := record[3].(int64); ok {
+				root = int(page)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == 0 {
+		return nil, fmt.Errorf("no Packages table")
+	}
+
+	var packages []Package
+	err = db.walkTable(root, func(record []interface{}) error {
+		// Packages: hnum, blob
+		if len(record) < 2 {
+			return nil
+		}
+		blob, ok := record[1].([]byte)
+		if !ok {
+			return nil
+		}
+		pkg, err := parseRPMHeader(blob)
+		if err != nil {
+			return err
+		}
+		// gpg-pubkey entries are imported signing keys, not packages
+		if pkg.Name != "" && pkg.Name != "gpg-pubkey" {
+			packages = append(packages, pkg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
+
+// openSQLite checks the header of an SQLite database
+func openSQLite(data []byte) (*sqliteFile, error) {
+	if len(data) < 100 || !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		return nil, fmt.Errorf("not an SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 {
+		return nil, fmt.Errorf("invalid SQLite page size %d", pageSize)
+	}
+	return &sqliteFile{data: data, pageSize: pageSize, usable: pageSize - int(data[20])}, nil
+}
+
+// page returns a page by its 1-based number
+func (db *sqliteFile) page(n int) ([]byte, error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("SQLite page %d is out of range", n)
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// walkTable calls fn with the decoded record of every row of the table
+// b-tree rooted at a page
+func (db *sqliteFile) walkTable(root int, fn func(record []interface{}) error) error {
+	pending := []int{root}
+	visited := map[int]bool{}
+	for len(pending) > 0 {
+		n := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[n] {
+			return fmt.Errorf("SQLite page %d is referenced twice", n)
+		}
+		visited[n] = true
+
+		page, err := db.page(n)
+		if err != nil {
+			return err
+		}
+		offset := 0
+		if n == 1 {
+			offset = 100 // The database header comes before the first page's
+		}
+		if offset+12 > len(page) {
+			return fmt.Errorf("SQLite page %d is truncated", n)
+		}
+		kind := page[offset]
+		cells := int(binary.BigEndian.Uint16(page[offset+3:]))
+
+		switch kind {
+		case 0x05: // Interior table page
+			pointers := offset + 12
+			if pointers+2*cells > len(page) {
+				return fmt.Errorf("SQLite page %d is truncated", n)
+			}
+			pending = append(pending, int(binary.BigEndian.Uint32(page[offset+8:])))
+			for i := cells - 1; i >= 0; i-- {
+				cell := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+				if cell+4 > len(page) {
+					return fmt.Errorf("SQLite page %d is corrupt", n)
+				}
+				pending = append(pending, int(binary.BigEndian.Uint32(page[cell:])))
+			}
+		case 0x0d: // Leaf table page
+			pointers := offset + 8
+			if pointers+2*cells > len(page) {
+				return fmt.Errorf("SQLite page %d is truncated", n)
+			}
+			for i := 0; i < cells; i++ {
+				cell := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+				payload, err := db.payload(page, cell)
+				if err != nil {
+					return fmt.Errorf("SQLite page %d: %v", n, err)
+				}
+				record, err := decodeRecord(payload)
+				if err != nil {
+					return fmt.Errorf("SQLite page %d: %v", n, err)
+				}
+				if err := fn(record); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("SQLite page %d is not a table page", n)
+		}
+	}
+	return nil
+}
+
+// payload returns the full payload of a leaf table cell, following its
+// overflow pages
+func (db *sqliteFile) payload(page []byte, cell int) ([]byte, error) {
+	if cell >= len(page) {
+		return nil, fmt.Errorf("cell out of range")
+	}
+	size, n := readVarint(page[cell:])
+	cell += n
+	_, n = readVarint(page[cell:]) // Row ID
+	cell += n
+
+	// How much of the payload is stored on the page, from the SQLite file
+	// format documentation
+	local := int(size)
+	maxLocal := db.usable - 35
+	if local > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (int(size)-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if cell+local > len(page) {
+		return nil, fmt.Errorf("cell overflows its page")
+	}
+	payload := append([]byte(nil), page[cell:cell+local]...)
+	if local == int(size) {
+		return payload, nil
+	}
+
+	if cell+local+4 > len(page) {
+		return nil, fmt.Errorf("cell overflows its page")
+	}
+	next := int(binary.BigEndian.Uint32(page[cell+local:]))
+	for len(payload) < int(size) {
+		if next == 0 {
+			return nil, fmt.Errorf("overflow chain ends early")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow))
+		chunk := overflow[4:db.usable]
+		if remaining := int(size) - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+	}
+	return payload, nil
+}
+
+// decodeRecord reads the columns of an SQLite record as nil, int64,
+// float64 bits, string or []byte values
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if int(headerSize) > len(payload) || n == 0 {
+		return nil, fmt.Errorf("invalid record header")
+	}
+	var types []int64
+	for offset := n; offset < int(headerSize); {
+		serial, n := readVarint(payload[offset:int(headerSize)])
+		if n == 0 {
+			return nil, fmt.Errorf("invalid record header")
+		}
+		types = append(types, int64(serial))
+		offset += n
+	}
+
+	intSizes := map[int64]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 6, 6: 8, 7: 8}
+	var record []interface{}
+	body := payload[headerSize:]
+	for _, serial := range types {
+		var size int
+		switch {
+		case serial == 0 || serial == 8 || serial == 9:
+			size = 0
+		case serial < 8:
+			size = intSizes[serial]
+		case serial >= 12:
+			size = int((serial - 12) / 2)
+		default:
+			return nil, fmt.Errorf("invalid serial type %d", serial)
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("record is truncated")
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case serial == 0:
+			record = append(record, nil)
+		case serial == 8 || serial == 9:
+			record = append(record, serial-8)
+		case serial < 7:
+			// Big-endian two's complement integer
+			n := int64(int8(value[0]))
+			for _, b := range value[1:] {
+				n = n<<8 | int64(b)
+			}
+			record = append(record, n)
+		case serial == 7:
+			record = append(record, binary.BigEndian.Uint64(value))
+		case serial%2 == 0:
+			record = append(record, value)
+		default:
+			record = append(record, string(value))
+		}
+	}
+	return record, nil
+}
+
+// readVarint reads an SQLite variable-length integer, returning it and its
+// length in bytes, or a length of zero when the data ends first
+func readVarint(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return v<<8 | uint64(data[i]), 9
+		}
+		v = v<<7 | uint64(data[i]&0x7f)
+		if data[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// parseRPMHeader reads the name and version of a package from an RPM header
+// blob: an index of 16-byte entries followed by the data they point into
+func parseRPMHeader(blob []byte) (Package, error) {
+	if len(blob) < 8 {
+		return Package{}, fmt.Errorf("rpm header is truncated")
+	}
+	entries := int(binary.BigEndian.Uint32(blob[0:4]))
+	dataLength := int(binary.BigEndian.Uint32(blob[4:8]))
+	start := 8 + 16*entries
+	if entries < 0 || dataLength < 0 || start+dataLength > len(blob) || start < 8 {
+		return Package{}, fmt.Errorf("rpm header is truncated")
+	}
+	store := blob[start : start+dataLength]
+
+	fields := map[int]string{}
+	for i := 0; i < entries; i++ {
+		entry := blob[8+16*i:]
+		tag := int(binary.BigEndian.Uint32(entry[0:4]))
+		kind := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || offset >= len(store) {
+			continue
+		}
+		switch {
+		case kind == rpmTypeString:
+			value := store[offset:]
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			fields[tag] = string(value)
+		case kind == rpmTypeInt32 && offset+4 <= len(store):
+			fields[tag] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(store[offset:])), 10)
+		}
+	}
+
+	version := fields[rpmTagVersion] + "-" + fields[rpmTagRelease]
+	if epoch := fields[rpmTagEpoch]; epoch != "" && epoch != "0" {
+		version = epoch + ":" + version
+	}
+	pkg := Package{Name: fields[rpmTagName], Version: version, Format: FormatRPM}
+	// SOURCERPM is name-version-release.src.rpm
+	if source := strings.TrimSuffix(fields[rpmTagSourceRPM], ".src.rpm"); source != "" {
+		parts := strings.Split(source, "-")
+		if len(parts) > 2 {
+			pkg.Source = strings.Join(parts[:len(parts)-2], "-")
+			if pkg.Source == pkg.Name {
+				pkg.Source = ""
+			}
+		}
+	}
+	return pkg, nil
+}
@@ -0,0 +1,333 @@
+package vuln
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Package database formats, which also decide how versions compare
+const (
+	FormatDpkg = "dpkg"
+	FormatApk  = "apk"
+	FormatRPM  = "rpm"
+)
+
+// CompareVersions orders two versions of a package format, returning a
+// negative number, zero or a positive number like strings.Compare
+func CompareVersions(format, a, b string) int {
+	switch format {
+	case FormatApk:
+		return compareApk(a, b)
+	case FormatRPM:
+		return compareRPM(a, b)
+	default:
+		return compareDpkg(a, b)
+	}
+}
+
+// compareDpkg implements dpkg --compare-versions for [epoch:]upstream[-revision]
+func compareDpkg(a, b string) int {
+	epochA, upstreamA, revisionA := splitDpkg(a)
+	epochB, upstreamB, revisionB := splitDpkg(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+	if c := verrevcmp(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return verrevcmp(revisionA, revisionB)
+}
+
+// splitDpkg splits a Debian version into its epoch, upstream version and
+// revision
+func splitDpkg(version string) (int, string, string) {
+	epoch := 0
+	if before, after, ok := strings.Cut(version, ":"); ok {
+		epoch, _ = strconv.Atoi(before)
+		version = after
+	}
+	revision := ""
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, revision = version[:i], version[i+1:]
+	}
+	return epoch, version, revision
+}
+
+// verrevcmp compares upstream versions or revisions the way dpkg does:
+// non-digit runs by character, with ~ sorting before everything, then digit
+// runs by value
+func verrevcmp(a, b string) int {
+	order := func(s string, i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		switch {
+		case isDigit(c):
+			return 0
+		case isLetter(c):
+			return int(c)
+		case c == '~':
+			return -1
+		}
+		return int(c) + 256
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) || j < len(b) && !isDigit(b[j]) {
+			if ac, bc := order(a, i), order(b, j); ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+// compareRPM orders [epoch:]version-release strings like rpm does
+func compareRPM(a, b string) int {
+	epochA, versionA, releaseA := splitRPM(a)
+	epochB, versionB, releaseB := splitRPM(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+	if c := rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+// splitRPM splits an RPM version into its epoch, version and release
+func splitRPM(version string) (int, string, string) {
+	epoch := 0
+	if before, after, ok := strings.Cut(version, ":"); ok {
+		epoch, _ = strconv.Atoi(before)
+		version = after
+	}
+	release := ""
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, release = version[:i], version[i+1:]
+	}
+	return epoch, version, release
+}
+
+// rpmvercmp compares alternating digit and letter segments, with ~ sorting
+// before and ^ after the end of a version
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	separator := func(c byte) bool {
+		return !isDigit(c) && !isLetter(c) && c != '~' && c != '^'
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && separator(a[i]) {
+			i++
+		}
+		for j < len(b) && separator(b[j]) {
+			j++
+		}
+
+		if i < len(a) && a[i] == '~' || j < len(b) && b[j] == '~' {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i < len(a) && a[i] == '^' || j < len(b) && b[j] == '^' {
+			switch {
+			case i >= len(a):
+				return -1
+			case j >= len(b):
+				return 1
+			case a[i] != '^':
+				return 1
+			case b[j] != '^':
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		numeric := isDigit(a[i])
+		class := isLetter
+		if numeric {
+			class = isDigit
+		}
+		startA, startB := i, j
+		for i < len(a) && class(a[i]) {
+			i++
+		}
+		for j < len(b) && class(b[j]) {
+			j++
+		}
+		segA, segB := a[startA:i], b[startB:j]
+		if segB == "" {
+			// Numeric segments are newer than alphabetic ones
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			segA, segB = strings.TrimLeft(segA, "0"), strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				return sign(len(segA) - len(segB))
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
+
+// apkSuffixes ranks the suffixes of Alpine versions; versions without a
+// suffix rank 0, between _rc and _cvs
+var apkSuffixes = map[string]int{
+	"alpha": -4,
+	"beta":  -3,
+	"pre":   -2,
+	"rc":    -1,
+	"cvs":   1,
+	"svn":   2,
+	"git":   3,
+	"hg":    4,
+	"p":     5,
+}
+
+// apkVersion is a parsed Alpine version such as 1.2.3a_rc1_p2-r4
+type apkVersion struct {
+	numbers  []int
+	letter   byte
+	suffixes [][2]int // Rank and number of each suffix
+	revision int
+}
+
+// compareApk orders Alpine package versions like apk version -t
+func compareApk(a, b string) int {
+	va, vb := parseApk(a), parseApk(b)
+	for k := 0; k < len(va.numbers) || k < len(vb.numbers); k++ {
+		switch {
+		case k >= len(va.numbers):
+			return -1
+		case k >= len(vb.numbers):
+			return 1
+		case va.numbers[k] != vb.numbers[k]:
+			return sign(va.numbers[k] - vb.numbers[k])
+		}
+	}
+	if va.letter != vb.letter {
+		return sign(int(va.letter) - int(vb.letter))
+	}
+	for k := 0; k < len(va.suffixes) || k < len(vb.suffixes); k++ {
+		var sa, sb [2]int
+		if k < len(va.suffixes) {
+			sa = va.suffixes[k]
+		}
+		if k < len(vb.suffixes) {
+			sb = vb.suffixes[k]
+		}
+		if sa[0] != sb[0] {
+			return sign(sa[0] - sb[0])
+		}
+		if sa[1] != sb[1] {
+			return sign(sa[1] - sb[1])
+		}
+	}
+	return sign(va.revision - vb.revision)
+}
+
+// parseApk splits an Alpine version into its parts
+func parseApk(version string) apkVersion {
+	var v apkVersion
+	if i := strings.LastIndex(version, "-r"); i >= 0 {
+		if revision, err := strconv.Atoi(version[i+2:]); err == nil {
+			v.revision = revision
+			version = version[:i]
+		}
+	}
+
+	main, suffixes, _ := strings.Cut(version, "_")
+	for _, part := range strings.Split(main, ".") {
+		digits := len(part) - len(strings.TrimLeft(part, "0123456789"))
+		n, _ := strconv.Atoi(part[:digits])
+		v.numbers = append(v.numbers, n)
+		if digits < len(part) && isLetter(part[digits]) {
+			v.letter = part[digits]
+		}
+	}
+	if suffixes == "" {
+		return v
+	}
+	for _, suffix := range strings.Split(suffixes, "_") {
+		name := strings.TrimRight(suffix, "0123456789")
+		n, _ := strconv.Atoi(suffix[len(name):])
+		v.suffixes = append(v.suffixes, [2]int{apkSuffixes[name], n})
+	}
+	return v
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
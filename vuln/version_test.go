@@ -0,0 +1,62 @@
+package vuln
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		format, a, b string
+		want         int
+	}{
+		// dpkg
+		{FormatDpkg, "1.0", "1.0", 0},
+		{FormatDpkg, "1.0", "1.0-0", 0},
+		{FormatDpkg, "0:1.0", "1.0", 0},
+		{FormatDpkg, "1.0~rc1", "1.0", -1},
+		{FormatDpkg, "1.0~~", "1.0~", -1},
+		{FormatDpkg, "1.0", "1.0+b1", -1},
+		{FormatDpkg, "1.0", "1.0a", -1},
+		{FormatDpkg, "1.9", "1.10", -1},
+		{FormatDpkg, "1:0.9", "2.0", 1},
+		{FormatDpkg, "1.0-1", "1.0-2", -1},
+		{FormatDpkg, "1.0-1~deb12u1", "1.0-1", -1},
+		{FormatDpkg, "2.36-9+deb12u4", "2.36-9+deb12u7", -1},
+		{FormatDpkg, "3.0.11-1~deb12u2", "3.0.11-1~deb12u10", -1},
+
+		// rpm
+		{FormatRPM, "1.0", "1.0", 0},
+		{FormatRPM, "1.0", "1.0.1", -1},
+		{FormatRPM, "1.0~rc1", "1.0", -1},
+		{FormatRPM, "1.0^git1", "1.0", 1},
+		{FormatRPM, "1.0^git1", "1.0.1", -1},
+		{FormatRPM, "1.0~rc1^git1", "1.0~rc1", 1},
+		{FormatRPM, "1:1.0-1", "2.0-1", 1},
+		{FormatRPM, "0:2.0-1", "2.0-1", 0},
+		{FormatRPM, "1.0-1.el9", "1.0-2.el9", -1},
+		{FormatRPM, "1.0-2.el9", "1.0-2.el9_1", -1},
+		{FormatRPM, "1.0a", "1.0", 1},
+		{FormatRPM, "1.a", "1.1", -1},
+		{FormatRPM, "1.010", "1.10", 0},
+
+		// apk
+		{FormatApk, "1.2.3-r0", "1.2.3-r0", 0},
+		{FormatApk, "1.2.3-r0", "1.2.3-r1", -1},
+		{FormatApk, "1.2.3-r9", "1.2.3-r10", -1},
+		{FormatApk, "1.2.9", "1.2.10", -1},
+		{FormatApk, "1.2.3_rc1", "1.2.3", -1},
+		{FormatApk, "1.2.3_p1", "1.2.3", 1},
+		{FormatApk, "1.2.3_alpha", "1.2.3_beta", -1},
+		{FormatApk, "1.2.3_pre1", "1.2.3_rc1", -1},
+		{FormatApk, "1.2.3_rc1", "1.2.3_rc2", -1},
+		{FormatApk, "1.2.3", "1.2.3a", -1},
+		{FormatApk, "1.2.3_p1-r0", "1.2.4-r0", -1},
+		{FormatApk, "3.1.4-r5", "3.1.4_p1-r0", -1},
+	}
+	for _, tt := range tests {
+		if got := sign(CompareVersions(tt.format, tt.a, tt.b)); got != tt.want {
+			t.Errorf("CompareVersions(%s, %q, %q) = %d, want %d", tt.format, tt.a, tt.b, got, tt.want)
+		}
+		if got := sign(CompareVersions(tt.format, tt.b, tt.a)); got != -tt.want {
+			t.Errorf("CompareVersions(%s, %q, %q) = %d, want %d", tt.format, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}